@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"go.opentelemetry.io/otel/trace/noop"
+	"log/slog"
+	"net/http"
+	"projekat/configuration"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"time"
+)
+
+// verifyAuditLog implements the audit-verify command. It walks the audit hash
+// chain stored in Consul and exits non-zero if any gap or tampering is found.
+func verifyAuditLog(cfg configuration.Configuration) int {
+	logger := slog.Default().With("command", "audit-verify")
+	tracer := noop.NewTracerProvider().Tracer("audit-verify")
+
+	consul, err := repositories.NewConsulClient(consulOptions(cfg.Storage), tracer)
+	if err != nil {
+		logger.Error("Failed to create Consul client", "error", err)
+		return 2
+	}
+	repo := repositories.NewAudit(consul, repositories.NewKeyspace(cfg.Storage.KeyPrefix), logger, tracer)
+
+	result, err := services.NewAuditService(repo, tracer).Verify(context.Background())
+	if err != nil {
+		logger.Error("Failed to read audit log", "error", err)
+		return 2
+	}
+
+	for _, problem := range result.Problems {
+		fmt.Println(problem)
+	}
+	if !result.Valid() {
+		fmt.Printf("audit log is NOT intact: %d problem(s) in %d event(s)\n", len(result.Problems), result.Events)
+		return 1
+	}
+	fmt.Printf("audit log is intact: %d event(s)\n", result.Events)
+	return 0
+}
+
+// rotateSecrets implements the rotate-secrets command. After a new master key
+// has been added to the key file and made active, it re-wraps the data keys of
+// every secret in every namespace so the old master key can be retired.
+func rotateSecrets(cfg configuration.Configuration) int {
+	logger := slog.Default().With("command", "rotate-secrets")
+	tracer := noop.NewTracerProvider().Tracer("rotate-secrets")
+
+	if cfg.Secrets.KeyFile == "" {
+		logger.Error("No master key file is configured")
+		return 2
+	}
+	secrets, err := services.LoadKeyring(cfg.Secrets.KeyFile)
+	if err != nil {
+		logger.Error("Failed to load master keys", "error", err)
+		return 2
+	}
+	consul, err := repositories.NewConsulClient(consulOptions(cfg.Storage), tracer)
+	if err != nil {
+		logger.Error("Failed to create Consul client", "error", err)
+		return 2
+	}
+	keyspace := repositories.NewKeyspace(cfg.Storage.KeyPrefix)
+	repo := repositories.New(consul, keyspace, logger, tracer)
+	repoCG := repositories.NewCG(consul, keyspace, logger, tracer)
+	repoNS := repositories.NewNS(consul, keyspace, logger, tracer)
+
+	namespaces, err := repoNS.ListNamespaces(context.Background())
+	if err != nil {
+		logger.Error("Failed to list namespaces", "error", err)
+		return 2
+	}
+	names := []string{model.DefaultNamespace}
+	for _, namespace := range namespaces {
+		if namespace.Name != model.DefaultNamespace {
+			names = append(names, namespace.Name)
+		}
+	}
+
+	rotated, rotatedGroups, failed := 0, 0, 0
+	for _, namespace := range names {
+		ctx := model.ContextWithNamespace(context.Background(), namespace)
+		configs, err := repo.ListConfigs(ctx)
+		if err != nil {
+			logger.Error("Failed to list configs", "namespace", namespace, "error", err)
+			return 2
+		}
+		for i := range configs {
+			changed, err := secrets.RewrapConfig(&configs[i])
+			if err == nil && changed {
+				err = repo.AddConfig(&configs[i], ctx)
+			}
+			if err != nil {
+				logger.Error("Failed to rotate secrets", "namespace", namespace, "name", configs[i].Name, "version", configs[i].Version, "error", err)
+				failed++
+				continue
+			}
+			if changed {
+				rotated++
+			}
+		}
+
+		groups, err := repoCG.ListConfigGroups(ctx)
+		if err != nil {
+			logger.Error("Failed to list config groups", "namespace", namespace, "error", err)
+			return 2
+		}
+		for i := range groups {
+			changed, err := secrets.RewrapConfigGroup(&groups[i])
+			if err == nil && changed {
+				err = repoCG.AddConfigGroup(&groups[i], ctx)
+			}
+			if err != nil {
+				logger.Error("Failed to rotate secrets", "namespace", namespace, "group", groups[i].Name, "version", groups[i].Version, "error", err)
+				failed++
+				continue
+			}
+			if changed {
+				rotatedGroups++
+			}
+		}
+	}
+
+	fmt.Printf("re-wrapped secrets of %d config(s) and %d group(s), %d failure(s)\n", rotated, rotatedGroups, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// healthcheck implements the healthcheck command used by the container
+// HEALTHCHECK. It asks the local server whether it is ready and exits
+// non-zero if it is not.
+func healthcheck(cfg configuration.Configuration) int {
+	logger := slog.Default().With("command", "healthcheck")
+
+	scheme := "http"
+	client := &http.Client{Timeout: cfg.Server.HealthTimeout + time.Second}
+	if cfg.TLS.Enabled() {
+		// The probe only talks to this container, whose certificate is issued
+		// for the public name rather than localhost.
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+
+	resp, err := client.Get(scheme + "://127.0.0.1:" + cfg.Server.Port + "/readyz")
+	if err != nil {
+		logger.Error("Health check failed", "error", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("Service is not ready", "status", resp.StatusCode)
+		return 1
+	}
+	return 0
+}
+
+// migrateKeys implements the migrate-keys command. It moves the service's data
+// from the key prefix given as its argument into the configured one, bringing
+// it up to the current layout version. Stop the service before running it. A
+// failed migration is resumed by running the command again.
+func migrateKeys(cfg configuration.Configuration, args []string) int {
+	logger := slog.Default().With("command", "migrate-keys")
+	tracer := noop.NewTracerProvider().Tracer("migrate-keys")
+
+	if len(args) != 1 {
+		logger.Error("Usage: migrate-keys [flags] <source-prefix>; use \"\" for the KV root")
+		return 2
+	}
+	from := repositories.NewKeyspace(args[0])
+	to := repositories.NewKeyspace(cfg.Storage.KeyPrefix)
+
+	consul, err := repositories.NewConsulClient(consulOptions(cfg.Storage), tracer)
+	if err != nil {
+		logger.Error("Failed to create Consul client", "error", err)
+		return 2
+	}
+	result, err := repositories.Migrate(context.Background(), consul, from, to)
+	if err != nil {
+		logger.Error("Failed to migrate keys", "from", from.Prefix(), "to", to.Prefix(), "error", err)
+		return 1
+	}
+	if result.Resumed {
+		logger.Info("Resumed an interrupted migration", "from", from.Prefix(), "to", to.Prefix())
+	}
+	fmt.Printf("moved %d key(s) from %q (layout v%d) to %q (layout v%d)\n", result.Keys, from.Prefix(), result.FromVersion, to.Prefix(), repositories.LayoutVersion)
+	return 0
+}
@@ -1,15 +1,771 @@
 package configuration
 
-import "os"
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/rs/cors"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"projekat/model"
+	"strconv"
+	"strings"
+	"time"
+)
 
+// Configuration is everything the service and its commands are configured
+// with. Load fills it from defaults, then the config file, then environment
+// variables, then flags, each overriding the one before. Secrets have no
+// flags, so they never show up in the process list; they come from the
+// environment, the config file or a file named by a *-file setting.
 type Configuration struct {
-	Address       string
-	JaegerAddress string
+	Environment       string                   `yaml:"environment"`
+	LogLevel          string                   `yaml:"logLevel"`
+	Server            ServerConfiguration      `yaml:"server"`
+	Storage           StorageConfiguration     `yaml:"storage"`
+	Tracing           TracingConfiguration     `yaml:"tracing"`
+	RateLimit         RateLimitConfiguration   `yaml:"rateLimit"`
+	Auth              AuthConfiguration        `yaml:"auth"`
+	Idempotency       IdempotencyConfiguration `yaml:"idempotency"`
+	TLS               TLSConfiguration         `yaml:"tls"`
+	CORS              CORSConfiguration        `yaml:"cors"`
+	Secrets           SecretsConfiguration     `yaml:"secrets"`
+	QuotaFile         string                   `yaml:"quotaFile"`
+	InventoryInterval time.Duration            `yaml:"inventoryInterval"`
+	Bootstrap         BootstrapConfiguration   `yaml:"bootstrap"`
 }
 
-func GetConfiguration() Configuration {
+type ServerConfiguration struct {
+	// Address is where clients reach the service, e.g. behind a proxy.
+	Address           string        `yaml:"address"`
+	Port              string        `yaml:"port"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	HealthTimeout     time.Duration `yaml:"healthTimeout"`
+}
+
+// StorageConfiguration locates the Consul agent. The timeouts apply per Consul
+// request, so a handler that reads and then writes gets both.
+type StorageConfiguration struct {
+	Host string `yaml:"host"`
+	Port string `yaml:"port"`
+	// KeyPrefix roots every key of the service, so several environments
+	// can share one Consul cluster. Empty keeps the keys at the KV root.
+	KeyPrefix string `yaml:"keyPrefix"`
+	// Token is the ACL token; TokenFile is read instead when set.
+	Token      string `yaml:"token"`
+	TokenFile  string `yaml:"tokenFile"`
+	Datacenter string `yaml:"datacenter"`
+	// Namespace and Partition are Consul Enterprise tenancy.
+	Namespace      string                  `yaml:"namespace"`
+	Partition      string                  `yaml:"partition"`
+	TLS            StorageTLSConfiguration `yaml:"tls"`
+	ConnectTimeout time.Duration           `yaml:"connectTimeout"`
+	ReadTimeout    time.Duration           `yaml:"readTimeout"`
+	ListTimeout    time.Duration           `yaml:"listTimeout"`
+	WriteTimeout   time.Duration           `yaml:"writeTimeout"`
+	Retry          RetryConfiguration      `yaml:"retry"`
+	Cache          CacheConfiguration      `yaml:"cache"`
+	Breaker        BreakerConfiguration    `yaml:"breaker"`
+	Snapshot       SnapshotConfiguration   `yaml:"snapshot"`
+}
+
+type StorageTLSConfiguration struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+// RetryConfiguration retries transient Consul failures with jittered
+// exponential backoff. Attempts includes the first try.
+type RetryConfiguration struct {
+	Attempts  int           `yaml:"attempts"`
+	BaseDelay time.Duration `yaml:"baseDelay"`
+	MaxDelay  time.Duration `yaml:"maxDelay"`
+}
+
+// CacheConfiguration bounds the read-through cache of configs and groups.
+// Entries are also dropped as soon as Consul reports a change.
+type CacheConfiguration struct {
+	Enabled bool          `yaml:"enabled"`
+	Size    int           `yaml:"size"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+// BreakerConfiguration stops calling Consul after FailureThreshold
+// consecutive failures and tries again after OpenTimeout. Meanwhile reads
+// are served stale and writes fail with 503.
+type BreakerConfiguration struct {
+	Enabled          bool          `yaml:"enabled"`
+	FailureThreshold int           `yaml:"failureThreshold"`
+	OpenTimeout      time.Duration `yaml:"openTimeout"`
+}
+
+// SnapshotConfiguration saves all configs, groups and namespaces to File every
+// Interval so they can be served while Consul is down. Empty File disables it.
+type SnapshotConfiguration struct {
+	File     string        `yaml:"file"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (s StorageConfiguration) Address() string {
+	return net.JoinHostPort(s.Host, s.Port)
+}
+
+type RateLimitConfiguration struct {
+	// Backend is "local" for a per-replica limit or "consul" to share it.
+	Backend  string        `yaml:"backend"`
+	Requests int           `yaml:"requests"`
+	Window   time.Duration `yaml:"window"`
+}
+
+type AuthConfiguration struct {
+	// APIKeysFile lists hashed API keys, as YAML when it ends in .yaml or
+	// .yml and as JSON otherwise.
+	APIKeysFile string `yaml:"apiKeysFile"`
+	// JWTSecret is the HMAC secret for JWTs; JWTSecretFile is read instead
+	// when set.
+	JWTSecret     string   `yaml:"jwtSecret"`
+	JWTSecretFile string   `yaml:"jwtSecretFile"`
+	JWKSFile      string   `yaml:"jwksFile"`
+	JWTIssuer     string   `yaml:"jwtIssuer"`
+	JWTAudience   string   `yaml:"jwtAudience"`
+	PublicPaths   []string `yaml:"publicPaths"`
+	PolicyFile    string   `yaml:"policyFile"`
+}
+
+// Secret returns the HMAC secret for JWTs, read from JWTSecretFile when it is
+// set. Surrounding whitespace in the file is ignored.
+func (a AuthConfiguration) Secret() ([]byte, error) {
+	if a.JWTSecretFile == "" {
+		return []byte(a.JWTSecret), nil
+	}
+	data, err := os.ReadFile(a.JWTSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWT secret file: %w", err)
+	}
+	return bytes.TrimSpace(data), nil
+}
+
+type IdempotencyConfiguration struct {
+	// Required rejects POST requests without an Idempotency-Key header.
+	Required bool `yaml:"required"`
+}
+
+type TLSConfiguration struct {
+	CertFile       string        `yaml:"certFile"`
+	KeyFile        string        `yaml:"keyFile"`
+	ClientCAFile   string        `yaml:"clientCAFile"`
+	ClientAuth     string        `yaml:"clientAuth"`
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+}
+
+func (t TLSConfiguration) Enabled() bool {
+	return t.CertFile != ""
+}
+
+type SecretsConfiguration struct {
+	KeyFile        string   `yaml:"keyFile"`
+	RedactPatterns []string `yaml:"redactPatterns"`
+}
+
+// BootstrapConfiguration names a directory of config and group files applied
+// at startup. Mode is skip-if-exists, overwrite or fail-on-conflict and
+// decides what happens to entries stored with different content.
+type BootstrapConfiguration struct {
+	Dir  string `yaml:"dir"`
+	Mode string `yaml:"mode"`
+}
+
+type CORSConfiguration struct {
+	AllowedOrigins   []string `yaml:"allowedOrigins"`
+	AllowedMethods   []string `yaml:"allowedMethods"`
+	AllowedHeaders   []string `yaml:"allowedHeaders"`
+	AllowCredentials bool     `yaml:"allowCredentials"`
+	MaxAge           int      `yaml:"maxAge"`
+}
+
+// corsDefaults are the per-environment CORS settings used when nothing else
+// sets them. Production allows no cross-origin calls.
+var corsDefaults = map[string]CORSConfiguration{
+	"development": {
+		AllowedOrigins:   []string{"http://localhost:8081"},
+		AllowedMethods:   []string{"GET", "PUT", "POST", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Idempotency-Key", "Authorization", "X-API-Key", "X-Request-ID", "Cache-Control"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	},
+	"production": {
+		AllowedMethods: []string{"GET", "POST", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "Idempotency-Key", "Authorization", "X-API-Key", "X-Request-ID", "Cache-Control"},
+		MaxAge:         600,
+	},
+}
+
+// Validate rejects CORS settings that would let any site make credentialed
+// requests on behalf of a logged-in user.
+func (c CORSConfiguration) Validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" && c.AllowCredentials {
+			return errors.New("CORS: wildcard origin cannot be combined with credentials")
+		}
+		if origin == "null" {
+			return errors.New("CORS: the null origin must not be allowed")
+		}
+	}
+	for _, header := range c.AllowedHeaders {
+		if header == "*" && c.AllowCredentials {
+			return errors.New("CORS: wildcard headers cannot be combined with credentials")
+		}
+	}
+	if c.MaxAge < 0 {
+		return errors.New("CORS: max age must not be negative")
+	}
+	return nil
+}
+
+// Options returns the rs/cors options for c. An empty origin list denies
+// every cross-origin request; rs/cors itself would read it as allow-all.
+func (c CORSConfiguration) Options(exposedHeaders []string) cors.Options {
+	options := cors.Options{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+		ExposedHeaders:   exposedHeaders,
+	}
+	if len(c.AllowedOrigins) == 0 {
+		options.AllowOriginFunc = func(string) bool { return false }
+	}
+	return options
+}
+
+// Defaults returns the configuration used for environment when no file,
+// variable or flag overrides it.
+func Defaults(environment string) Configuration {
+	cors, ok := corsDefaults[environment]
+	if !ok {
+		cors = corsDefaults["production"]
+	}
 	return Configuration{
-		Address:       os.Getenv("SERVICE_ADDRESS"),
-		JaegerAddress: os.Getenv("JAEGER_ADDRESS"),
+		Environment: environment,
+		LogLevel:    "info",
+		Server: ServerConfiguration{
+			Port:              "8000",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			HealthTimeout:     2 * time.Second,
+		},
+		Storage: StorageConfiguration{
+			Host:           "localhost",
+			Port:           "8500",
+			ConnectTimeout: 5 * time.Second,
+			ReadTimeout:    2 * time.Second,
+			ListTimeout:    5 * time.Second,
+			WriteTimeout:   3 * time.Second,
+			Retry: RetryConfiguration{
+				Attempts:  3,
+				BaseDelay: 100 * time.Millisecond,
+				MaxDelay:  time.Second,
+			},
+			Cache: CacheConfiguration{
+				Enabled: true,
+				Size:    1000,
+				TTL:     5 * time.Minute,
+			},
+			Breaker: BreakerConfiguration{
+				Enabled:          true,
+				FailureThreshold: 5,
+				OpenTimeout:      10 * time.Second,
+			},
+			Snapshot: SnapshotConfiguration{Interval: time.Minute},
+		},
+		Tracing: TracingConfiguration{
+			Exporter: TracingExporterOTLPGRPC,
+			// Only the local collector of the development setup is reached
+			// without TLS.
+			Insecure:    environment == "development",
+			SampleRatio: 1,
+			ServiceName: "alati_projekat",
+		},
+		RateLimit: RateLimitConfiguration{
+			Backend:  "local",
+			Requests: 10,
+			Window:   time.Minute,
+		},
+		Auth: AuthConfiguration{
+			PublicPaths: []string{"/metrics", "/swagger.yaml", "/docs", "/healthz", "/readyz"},
+		},
+		Idempotency: IdempotencyConfiguration{Required: true},
+		TLS: TLSConfiguration{
+			ClientAuth:     "none",
+			ReloadInterval: 30 * time.Second,
+		},
+		CORS:              cors,
+		Secrets:           SecretsConfiguration{RedactPatterns: model.DefaultSecretPatterns},
+		InventoryInterval: time.Minute,
+		Bootstrap:         BootstrapConfiguration{Mode: "skip-if-exists"},
+	}
+}
+
+// Options are the flags that control loading rather than the service.
+type Options struct {
+	// File is the YAML config file, from --config or CONFIG_FILE. TOML is
+	// not supported.
+	File string
+	// PrintConfig asks for the effective configuration to be printed.
+	PrintConfig bool
+	// Args are the arguments left after the flags.
+	Args []string
+}
+
+// Load builds the configuration from defaults, the YAML file named by
+// --config or CONFIG_FILE, environment variables and the flags in args, in
+// that order of precedence, and validates the result. A .toml file is
+// rejected rather than misread as YAML.
+func Load(args []string) (Configuration, Options, error) {
+	// The flags are parsed once up front only to find the file and the
+	// environment, whose defaults everything else overrides.
+	var scratch Configuration
+	var options Options
+	if err := newFlagSet(&scratch, &options).Parse(args); err != nil {
+		return Configuration{}, options, err
+	}
+	if options.File == "" {
+		options.File = os.Getenv("CONFIG_FILE")
+	}
+
+	var data []byte
+	if strings.EqualFold(filepath.Ext(options.File), ".toml") {
+		return Configuration{}, options, fmt.Errorf("config file %s: TOML is not supported, use YAML", options.File)
+	}
+	if options.File != "" {
+		var err error
+		data, err = os.ReadFile(options.File)
+		if err != nil {
+			return Configuration{}, options, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+
+	environment := "production"
+	var fromFile struct {
+		Environment string `yaml:"environment"`
+	}
+	if err := yaml.Unmarshal(data, &fromFile); err != nil {
+		return Configuration{}, options, fmt.Errorf("parsing config file %s: %w", options.File, err)
+	}
+	if fromFile.Environment != "" {
+		environment = fromFile.Environment
+	}
+	environment = getEnv("APP_ENV", environment)
+	if scratch.Environment != "" {
+		environment = scratch.Environment
+	}
+
+	cfg := Defaults(environment)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return Configuration{}, options, fmt.Errorf("parsing config file %s: %w", options.File, err)
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return Configuration{}, options, err
+	}
+	flags := newFlagSet(&cfg, &Options{})
+	if err := flags.Parse(args); err != nil {
+		return Configuration{}, options, err
+	}
+	options.Args = flags.Args()
+	cfg.Environment = environment
+	return cfg, options, cfg.Validate()
+}
+
+// applyEnv overrides cfg with every variable that is set. Variables keep the
+// names they had before the config file existed.
+func applyEnv(cfg *Configuration) error {
+	env := envReader{}
+	cfg.LogLevel = getEnv("LOG_LEVEL", cfg.LogLevel)
+
+	cfg.Server.Address = getEnv("SERVICE_ADDRESS", cfg.Server.Address)
+	cfg.Server.Port = getEnv("PORT", cfg.Server.Port)
+	env.duration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	env.duration("SERVER_READ_HEADER_TIMEOUT", &cfg.Server.ReadHeaderTimeout)
+	env.duration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	env.duration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	env.duration("HEALTH_TIMEOUT", &cfg.Server.HealthTimeout)
+
+	cfg.Storage.Host = getEnv("DB", cfg.Storage.Host)
+	cfg.Storage.Port = getEnv("DBPORT", cfg.Storage.Port)
+	cfg.Storage.KeyPrefix = getEnv("STORAGE_KEY_PREFIX", cfg.Storage.KeyPrefix)
+	cfg.Storage.Token = getEnv("CONSUL_HTTP_TOKEN", cfg.Storage.Token)
+	cfg.Storage.TokenFile = getEnv("CONSUL_HTTP_TOKEN_FILE", cfg.Storage.TokenFile)
+	cfg.Storage.Datacenter = getEnv("CONSUL_DATACENTER", cfg.Storage.Datacenter)
+	cfg.Storage.Namespace = getEnv("CONSUL_NAMESPACE", cfg.Storage.Namespace)
+	cfg.Storage.Partition = getEnv("CONSUL_PARTITION", cfg.Storage.Partition)
+	env.bool("CONSUL_HTTP_SSL", &cfg.Storage.TLS.Enabled)
+	cfg.Storage.TLS.CAFile = getEnv("CONSUL_CACERT", cfg.Storage.TLS.CAFile)
+	cfg.Storage.TLS.CertFile = getEnv("CONSUL_CLIENT_CERT", cfg.Storage.TLS.CertFile)
+	cfg.Storage.TLS.KeyFile = getEnv("CONSUL_CLIENT_KEY", cfg.Storage.TLS.KeyFile)
+	cfg.Storage.TLS.ServerName = getEnv("CONSUL_TLS_SERVER_NAME", cfg.Storage.TLS.ServerName)
+	verify := !cfg.Storage.TLS.InsecureSkipVerify
+	env.bool("CONSUL_HTTP_SSL_VERIFY", &verify)
+	cfg.Storage.TLS.InsecureSkipVerify = !verify
+	env.duration("STORAGE_CONNECT_TIMEOUT", &cfg.Storage.ConnectTimeout)
+	env.duration("STORAGE_READ_TIMEOUT", &cfg.Storage.ReadTimeout)
+	env.duration("STORAGE_LIST_TIMEOUT", &cfg.Storage.ListTimeout)
+	env.duration("STORAGE_WRITE_TIMEOUT", &cfg.Storage.WriteTimeout)
+	env.int("STORAGE_RETRY_ATTEMPTS", &cfg.Storage.Retry.Attempts)
+	env.duration("STORAGE_RETRY_BASE_DELAY", &cfg.Storage.Retry.BaseDelay)
+	env.duration("STORAGE_RETRY_MAX_DELAY", &cfg.Storage.Retry.MaxDelay)
+	env.bool("STORAGE_CACHE_ENABLED", &cfg.Storage.Cache.Enabled)
+	env.int("STORAGE_CACHE_SIZE", &cfg.Storage.Cache.Size)
+	env.duration("STORAGE_CACHE_TTL", &cfg.Storage.Cache.TTL)
+	env.bool("STORAGE_BREAKER_ENABLED", &cfg.Storage.Breaker.Enabled)
+	env.int("STORAGE_BREAKER_FAILURE_THRESHOLD", &cfg.Storage.Breaker.FailureThreshold)
+	env.duration("STORAGE_BREAKER_OPEN_TIMEOUT", &cfg.Storage.Breaker.OpenTimeout)
+	cfg.Storage.Snapshot.File = getEnv("STORAGE_SNAPSHOT_FILE", cfg.Storage.Snapshot.File)
+	env.duration("STORAGE_SNAPSHOT_INTERVAL", &cfg.Storage.Snapshot.Interval)
+
+	cfg.Tracing.Exporter = getEnv("TRACING_EXPORTER", cfg.Tracing.Exporter)
+	cfg.Tracing.Endpoint = getEnv("TRACING_ENDPOINT", cfg.Tracing.Endpoint)
+	env.bool("TRACING_INSECURE", &cfg.Tracing.Insecure)
+	cfg.Tracing.File = getEnv("TRACING_FILE", cfg.Tracing.File)
+	env.float("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+	cfg.Tracing.ServiceName = getEnv("TRACING_SERVICE_NAME", cfg.Tracing.ServiceName)
+
+	cfg.RateLimit.Backend = getEnv("RATE_LIMIT_BACKEND", cfg.RateLimit.Backend)
+	env.int("RATE_LIMIT_REQUESTS", &cfg.RateLimit.Requests)
+	env.duration("RATE_LIMIT_WINDOW", &cfg.RateLimit.Window)
+
+	cfg.Auth.APIKeysFile = getEnv("AUTH_API_KEYS_FILE", cfg.Auth.APIKeysFile)
+	cfg.Auth.JWTSecret = getEnv("AUTH_JWT_SECRET", cfg.Auth.JWTSecret)
+	cfg.Auth.JWTSecretFile = getEnv("AUTH_JWT_SECRET_FILE", cfg.Auth.JWTSecretFile)
+	cfg.Auth.JWKSFile = getEnv("AUTH_JWKS_FILE", cfg.Auth.JWKSFile)
+	cfg.Auth.JWTIssuer = getEnv("AUTH_JWT_ISSUER", cfg.Auth.JWTIssuer)
+	cfg.Auth.JWTAudience = getEnv("AUTH_JWT_AUDIENCE", cfg.Auth.JWTAudience)
+	cfg.Auth.PublicPaths = getEnvList("AUTH_PUBLIC_PATHS", cfg.Auth.PublicPaths)
+	cfg.Auth.PolicyFile = getEnv("AUTHZ_POLICY_FILE", cfg.Auth.PolicyFile)
+
+	env.bool("IDEMPOTENCY_REQUIRED", &cfg.Idempotency.Required)
+
+	cfg.TLS.CertFile = getEnv("TLS_CERT_FILE", cfg.TLS.CertFile)
+	cfg.TLS.KeyFile = getEnv("TLS_KEY_FILE", cfg.TLS.KeyFile)
+	cfg.TLS.ClientCAFile = getEnv("TLS_CLIENT_CA_FILE", cfg.TLS.ClientCAFile)
+	cfg.TLS.ClientAuth = getEnv("TLS_CLIENT_AUTH", cfg.TLS.ClientAuth)
+	env.duration("TLS_RELOAD_INTERVAL", &cfg.TLS.ReloadInterval)
+
+	cfg.CORS.AllowedOrigins = getEnvList("CORS_ALLOWED_ORIGINS", cfg.CORS.AllowedOrigins)
+	cfg.CORS.AllowedMethods = getEnvList("CORS_ALLOWED_METHODS", cfg.CORS.AllowedMethods)
+	cfg.CORS.AllowedHeaders = getEnvList("CORS_ALLOWED_HEADERS", cfg.CORS.AllowedHeaders)
+	env.bool("CORS_ALLOW_CREDENTIALS", &cfg.CORS.AllowCredentials)
+	env.int("CORS_MAX_AGE", &cfg.CORS.MaxAge)
+
+	cfg.Secrets.KeyFile = getEnv("SECRETS_KEY_FILE", cfg.Secrets.KeyFile)
+	cfg.Secrets.RedactPatterns = getEnvList("REDACT_PATTERNS", cfg.Secrets.RedactPatterns)
+	cfg.QuotaFile = getEnv("QUOTA_FILE", cfg.QuotaFile)
+	env.duration("INVENTORY_INTERVAL", &cfg.InventoryInterval)
+	cfg.Bootstrap.Dir = getEnv("BOOTSTRAP_DIR", cfg.Bootstrap.Dir)
+	cfg.Bootstrap.Mode = getEnv("BOOTSTRAP_MODE", cfg.Bootstrap.Mode)
+	return errors.Join(env.errs...)
+}
+
+// Validate reports every setting the service cannot start with.
+func (c Configuration) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "log level %q is not debug, info, warn or error", c.LogLevel)
+	check(validPort(c.Server.Port), "server port %q is not a valid port", c.Server.Port)
+	check(c.Storage.Host != "", "storage host must be set")
+	check(validPort(c.Storage.Port), "storage port %q is not a valid port", c.Storage.Port)
+	check(!strings.ContainsAny(c.Storage.KeyPrefix, " \t\n") && !strings.Contains(c.Storage.KeyPrefix, "//"), "storage key prefix %q must not contain whitespace or empty segments", c.Storage.KeyPrefix)
+	check(c.Storage.Token == "" || c.Storage.TokenFile == "", "storage token and token file must not both be set")
+	check(c.Storage.Token != model.MaskedValue, "storage token is the redaction mask %q; set the real token", model.MaskedValue)
+	storageTLS := c.Storage.TLS
+	check(storageTLS.Enabled || storageTLS.CAFile+storageTLS.CertFile+storageTLS.KeyFile == "", "storage TLS files are set but storage TLS is not enabled")
+	check((storageTLS.CertFile == "") == (storageTLS.KeyFile == ""), "storage TLS certificate and key files must be set together")
+	check(c.Storage.Retry.Attempts >= 1, "storage retry attempts must be at least 1")
+	check(c.Storage.Retry.BaseDelay >= 0 && c.Storage.Retry.MaxDelay >= 0, "storage retry delays must not be negative")
+	check(!c.Storage.Cache.Enabled || c.Storage.Cache.Size > 0, "storage cache size must be positive")
+	check(!c.Storage.Cache.Enabled || c.Storage.Cache.TTL > 0, "storage cache TTL must be positive")
+	check(!c.Storage.Breaker.Enabled || c.Storage.Breaker.FailureThreshold > 0, "storage breaker failure threshold must be positive")
+	check(!c.Storage.Breaker.Enabled || c.Storage.Breaker.OpenTimeout > 0, "storage breaker open timeout must be positive")
+	check(c.Storage.Snapshot.File == "" || c.Storage.Snapshot.Interval > 0, "storage snapshot interval must be positive")
+	for name, timeout := range map[string]time.Duration{
+		"server read timeout":        c.Server.ReadTimeout,
+		"server read header timeout": c.Server.ReadHeaderTimeout,
+		"server write timeout":       c.Server.WriteTimeout,
+		"server idle timeout":        c.Server.IdleTimeout,
+		"health timeout":             c.Server.HealthTimeout,
+		"storage connect timeout":    c.Storage.ConnectTimeout,
+		"storage read timeout":       c.Storage.ReadTimeout,
+		"storage list timeout":       c.Storage.ListTimeout,
+		"storage write timeout":      c.Storage.WriteTimeout,
+	} {
+		check(timeout >= 0, "%s must not be negative", name)
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingExporterOTLPGRPC, TracingExporterOTLPHTTP, TracingExporterStdout, TracingExporterNone:
+	default:
+		check(false, "unknown tracing exporter %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing sample ratio %v is not between 0 and 1", c.Tracing.SampleRatio)
+
+	check(c.RateLimit.Backend == "local" || c.RateLimit.Backend == "consul", "rate limit backend %q is not local or consul", c.RateLimit.Backend)
+	check(c.RateLimit.Requests > 0, "rate limit requests must be positive")
+	check(c.RateLimit.Window > 0, "rate limit window must be positive")
+
+	check(c.Auth.JWTSecret == "" || c.Auth.JWTSecretFile == "", "JWT secret and JWT secret file must not both be set")
+	check(c.Auth.JWTSecret != model.MaskedValue, "JWT secret is the redaction mask %q; set the real secret", model.MaskedValue)
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "TLS certificate and key files must be set together")
+	switch c.TLS.ClientAuth {
+	case "none", "request", "require":
+		check(c.TLS.ClientAuth == "none" || c.TLS.ClientCAFile != "", "TLS client authentication requires a client CA bundle")
+	default:
+		check(false, "TLS client auth %q is not none, request or require", c.TLS.ClientAuth)
+	}
+
+	if err := c.CORS.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.InventoryInterval > 0, "inventory interval must be positive")
+	switch c.Bootstrap.Mode {
+	case "skip-if-exists", "overwrite", "fail-on-conflict":
+	default:
+		check(false, "bootstrap mode %q is not skip-if-exists, overwrite or fail-on-conflict", c.Bootstrap.Mode)
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy that is safe to print or log.
+func (c Configuration) Redacted() Configuration {
+	if c.Auth.JWTSecret != "" {
+		c.Auth.JWTSecret = model.MaskedValue
+	}
+	if c.Storage.Token != "" {
+		c.Storage.Token = model.MaskedValue
+	}
+	return c
+}
+
+// Print writes the redacted configuration to w as YAML, in the format Load
+// reads. Validate rejects the masked secrets, so a printed configuration
+// that had any must have them set again before it is loaded.
+func (c Configuration) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+// newFlagSet binds a flag to every setting, named after its path in the
+// config file, with the current value of cfg as default.
+func newFlagSet(cfg *Configuration, options *Options) *flag.FlagSet {
+	fs := flag.NewFlagSet("projekat", flag.ContinueOnError)
+	fs.StringVar(&options.File, "config", "", "YAML config file")
+	fs.BoolVar(&options.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+
+	fs.StringVar(&cfg.Environment, "environment", cfg.Environment, "environment whose defaults apply (development or production)")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "log level")
+
+	fs.StringVar(&cfg.Server.Address, "server.address", cfg.Server.Address, "address clients reach the service at")
+	fs.StringVar(&cfg.Server.Port, "server.port", cfg.Server.Port, "port to listen on")
+	fs.DurationVar(&cfg.Server.ReadTimeout, "server.read-timeout", cfg.Server.ReadTimeout, "time to read a whole request")
+	fs.DurationVar(&cfg.Server.ReadHeaderTimeout, "server.read-header-timeout", cfg.Server.ReadHeaderTimeout, "time to read request headers")
+	fs.DurationVar(&cfg.Server.WriteTimeout, "server.write-timeout", cfg.Server.WriteTimeout, "time to write a response")
+	fs.DurationVar(&cfg.Server.IdleTimeout, "server.idle-timeout", cfg.Server.IdleTimeout, "time an idle keep-alive connection stays open")
+	fs.DurationVar(&cfg.Server.HealthTimeout, "server.health-timeout", cfg.Server.HealthTimeout, "time budget of each health check")
+
+	fs.StringVar(&cfg.Storage.Host, "storage.host", cfg.Storage.Host, "Consul host")
+	fs.StringVar(&cfg.Storage.Port, "storage.port", cfg.Storage.Port, "Consul port")
+	fs.StringVar(&cfg.Storage.KeyPrefix, "storage.key-prefix", cfg.Storage.KeyPrefix, "prefix of every Consul key the service stores")
+	fs.StringVar(&cfg.Storage.TokenFile, "storage.token-file", cfg.Storage.TokenFile, "file holding the Consul ACL token")
+	fs.StringVar(&cfg.Storage.Datacenter, "storage.datacenter", cfg.Storage.Datacenter, "Consul datacenter")
+	fs.StringVar(&cfg.Storage.Namespace, "storage.namespace", cfg.Storage.Namespace, "Consul Enterprise namespace")
+	fs.StringVar(&cfg.Storage.Partition, "storage.partition", cfg.Storage.Partition, "Consul Enterprise admin partition")
+	fs.BoolVar(&cfg.Storage.TLS.Enabled, "storage.tls.enabled", cfg.Storage.TLS.Enabled, "talk to Consul over HTTPS")
+	fs.StringVar(&cfg.Storage.TLS.CAFile, "storage.tls.ca-file", cfg.Storage.TLS.CAFile, "CA bundle for the Consul certificate")
+	fs.StringVar(&cfg.Storage.TLS.CertFile, "storage.tls.cert-file", cfg.Storage.TLS.CertFile, "client certificate for Consul")
+	fs.StringVar(&cfg.Storage.TLS.KeyFile, "storage.tls.key-file", cfg.Storage.TLS.KeyFile, "client key for Consul")
+	fs.StringVar(&cfg.Storage.TLS.ServerName, "storage.tls.server-name", cfg.Storage.TLS.ServerName, "name the Consul certificate is checked for")
+	fs.BoolVar(&cfg.Storage.TLS.InsecureSkipVerify, "storage.tls.insecure-skip-verify", cfg.Storage.TLS.InsecureSkipVerify, "skip verifying the Consul certificate")
+	fs.DurationVar(&cfg.Storage.ConnectTimeout, "storage.connect-timeout", cfg.Storage.ConnectTimeout, "time to connect to Consul")
+	fs.DurationVar(&cfg.Storage.ReadTimeout, "storage.read-timeout", cfg.Storage.ReadTimeout, "time budget of a Consul read")
+	fs.DurationVar(&cfg.Storage.ListTimeout, "storage.list-timeout", cfg.Storage.ListTimeout, "time budget of a Consul list")
+	fs.DurationVar(&cfg.Storage.WriteTimeout, "storage.write-timeout", cfg.Storage.WriteTimeout, "time budget of a Consul write")
+	fs.IntVar(&cfg.Storage.Retry.Attempts, "storage.retry.attempts", cfg.Storage.Retry.Attempts, "tries per Consul call, including the first")
+	fs.DurationVar(&cfg.Storage.Retry.BaseDelay, "storage.retry.base-delay", cfg.Storage.Retry.BaseDelay, "backoff before the first retry")
+	fs.DurationVar(&cfg.Storage.Retry.MaxDelay, "storage.retry.max-delay", cfg.Storage.Retry.MaxDelay, "longest backoff between retries")
+	fs.BoolVar(&cfg.Storage.Cache.Enabled, "storage.cache.enabled", cfg.Storage.Cache.Enabled, "cache config and group reads")
+	fs.IntVar(&cfg.Storage.Cache.Size, "storage.cache.size", cfg.Storage.Cache.Size, "entries kept in the storage cache")
+	fs.DurationVar(&cfg.Storage.Cache.TTL, "storage.cache.ttl", cfg.Storage.Cache.TTL, "longest time a cached entry is served")
+	fs.BoolVar(&cfg.Storage.Breaker.Enabled, "storage.breaker.enabled", cfg.Storage.Breaker.Enabled, "stop calling Consul while it keeps failing")
+	fs.IntVar(&cfg.Storage.Breaker.FailureThreshold, "storage.breaker.failure-threshold", cfg.Storage.Breaker.FailureThreshold, "consecutive failures that open the circuit")
+	fs.DurationVar(&cfg.Storage.Breaker.OpenTimeout, "storage.breaker.open-timeout", cfg.Storage.Breaker.OpenTimeout, "time before an open circuit lets a trial call through")
+	fs.StringVar(&cfg.Storage.Snapshot.File, "storage.snapshot.file", cfg.Storage.Snapshot.File, "local file of data served while Consul is down")
+	fs.DurationVar(&cfg.Storage.Snapshot.Interval, "storage.snapshot.interval", cfg.Storage.Snapshot.Interval, "time between storage snapshots")
+
+	fs.StringVar(&cfg.Tracing.Exporter, "tracing.exporter", cfg.Tracing.Exporter, "span exporter (otlp-grpc, otlp-http, stdout or none)")
+	fs.StringVar(&cfg.Tracing.Endpoint, "tracing.endpoint", cfg.Tracing.Endpoint, "collector endpoint")
+	fs.BoolVar(&cfg.Tracing.Insecure, "tracing.insecure", cfg.Tracing.Insecure, "disable TLS towards the collector")
+	fs.StringVar(&cfg.Tracing.File, "tracing.file", cfg.Tracing.File, "file receiving spans in stdout mode")
+	fs.Float64Var(&cfg.Tracing.SampleRatio, "tracing.sample-ratio", cfg.Tracing.SampleRatio, "fraction of new traces sampled")
+	fs.StringVar(&cfg.Tracing.ServiceName, "tracing.service-name", cfg.Tracing.ServiceName, "service name on spans")
+
+	fs.StringVar(&cfg.RateLimit.Backend, "rate-limit.backend", cfg.RateLimit.Backend, "rate limit backend (local or consul)")
+	fs.IntVar(&cfg.RateLimit.Requests, "rate-limit.requests", cfg.RateLimit.Requests, "requests allowed per window")
+	fs.DurationVar(&cfg.RateLimit.Window, "rate-limit.window", cfg.RateLimit.Window, "rate limit window")
+
+	fs.StringVar(&cfg.Auth.APIKeysFile, "auth.api-keys-file", cfg.Auth.APIKeysFile, "API key file (JSON or YAML)")
+	fs.StringVar(&cfg.Auth.JWTSecretFile, "auth.jwt-secret-file", cfg.Auth.JWTSecretFile, "file holding the HMAC secret for JWTs")
+	fs.StringVar(&cfg.Auth.JWKSFile, "auth.jwks-file", cfg.Auth.JWKSFile, "JWKS file for JWTs")
+	fs.StringVar(&cfg.Auth.JWTIssuer, "auth.jwt-issuer", cfg.Auth.JWTIssuer, "required JWT issuer")
+	fs.StringVar(&cfg.Auth.JWTAudience, "auth.jwt-audience", cfg.Auth.JWTAudience, "required JWT audience")
+	fs.Var((*listValue)(&cfg.Auth.PublicPaths), "auth.public-paths", "comma-separated paths that need no credentials")
+	fs.StringVar(&cfg.Auth.PolicyFile, "auth.policy-file", cfg.Auth.PolicyFile, "authorization policy file")
+
+	fs.BoolVar(&cfg.Idempotency.Required, "idempotency.required", cfg.Idempotency.Required, "reject POST requests without an Idempotency-Key")
+
+	fs.StringVar(&cfg.TLS.CertFile, "tls.cert-file", cfg.TLS.CertFile, "TLS certificate file")
+	fs.StringVar(&cfg.TLS.KeyFile, "tls.key-file", cfg.TLS.KeyFile, "TLS key file")
+	fs.StringVar(&cfg.TLS.ClientCAFile, "tls.client-ca-file", cfg.TLS.ClientCAFile, "CA bundle for client certificates")
+	fs.StringVar(&cfg.TLS.ClientAuth, "tls.client-auth", cfg.TLS.ClientAuth, "client certificate mode (none, request or require)")
+	fs.DurationVar(&cfg.TLS.ReloadInterval, "tls.reload-interval", cfg.TLS.ReloadInterval, "how often certificate files are checked")
+
+	fs.Var((*listValue)(&cfg.CORS.AllowedOrigins), "cors.allowed-origins", "comma-separated allowed origins")
+	fs.Var((*listValue)(&cfg.CORS.AllowedMethods), "cors.allowed-methods", "comma-separated allowed methods")
+	fs.Var((*listValue)(&cfg.CORS.AllowedHeaders), "cors.allowed-headers", "comma-separated allowed headers")
+	fs.BoolVar(&cfg.CORS.AllowCredentials, "cors.allow-credentials", cfg.CORS.AllowCredentials, "allow credentialed cross-origin requests")
+	fs.IntVar(&cfg.CORS.MaxAge, "cors.max-age", cfg.CORS.MaxAge, "seconds preflight responses are cached")
+
+	fs.StringVar(&cfg.Secrets.KeyFile, "secrets.key-file", cfg.Secrets.KeyFile, "master key file")
+	fs.Var((*listValue)(&cfg.Secrets.RedactPatterns), "secrets.redact-patterns", "comma-separated parameter name patterns to redact")
+	fs.StringVar(&cfg.QuotaFile, "quota-file", cfg.QuotaFile, "quota file")
+	fs.DurationVar(&cfg.InventoryInterval, "inventory-interval", cfg.InventoryInterval, "how often inventory metrics are refreshed")
+	fs.StringVar(&cfg.Bootstrap.Dir, "bootstrap.dir", cfg.Bootstrap.Dir, "directory of config and group files applied at startup")
+	fs.StringVar(&cfg.Bootstrap.Mode, "bootstrap.mode", cfg.Bootstrap.Mode, "what to do with stored entries that differ (skip-if-exists, overwrite or fail-on-conflict)")
+	return fs
+}
+
+// listValue is a comma-separated flag.
+type listValue []string
+
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	*l = splitList(value)
+	return nil
+}
+
+// envReader overrides settings from environment variables and collects the
+// ones that cannot be parsed.
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) parse(key string, parse func(string) error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	if err := parse(value); err != nil {
+		r.errs = append(r.errs, fmt.Errorf("%s=%q: %w", key, value, err))
+	}
+}
+
+func (r *envReader) int(key string, target *int) {
+	r.parse(key, func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err == nil {
+			*target = n
+		}
+		return err
+	})
+}
+
+func (r *envReader) bool(key string, target *bool) {
+	r.parse(key, func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err == nil {
+			*target = b
+		}
+		return err
+	})
+}
+
+func (r *envReader) float(key string, target *float64) {
+	r.parse(key, func(value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			*target = f
+		}
+		return err
+	})
+}
+
+func (r *envReader) duration(key string, target *time.Duration) {
+	r.parse(key, func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err == nil {
+			*target = d
+		}
+		return err
+	})
+}
+
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvList(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	return splitList(value)
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
 	}
+	return list
 }
@@ -0,0 +1,186 @@
+package configuration
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CertificateReloader serves the certificate and client CA bundle from disk
+// and swaps them in place when the files change or the process gets SIGHUP.
+// Established connections keep the certificate they were negotiated with.
+type CertificateReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mux      sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+	lastErr  error
+}
+
+func NewCertificateReloader(certFile string, keyFile string, clientCAFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		modTimes:     make(map[string]time.Time),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertificateReloader) Reload() error {
+	cert, pool, err := r.load()
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.lastErr = err
+	if err != nil {
+		return err
+	}
+	r.cert = cert
+	r.clientCA = pool
+	for _, file := range r.files() {
+		if info, err := os.Stat(file); err == nil {
+			r.modTimes[file] = info.ModTime()
+		}
+	}
+	return nil
+}
+
+func (r *CertificateReloader) load() (*tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading TLS key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading client CA bundle: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, errors.New("client CA bundle contains no certificates")
+		}
+	}
+	return &cert, pool, nil
+}
+
+// Check reports the error of the last reload, if it failed. The previous
+// certificates are still served in that case, but the files on disk are
+// broken and the next restart would fail.
+func (r *CertificateReloader) Check(ctx context.Context) error {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.lastErr
+}
+
+func (r *CertificateReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
+
+func (r *CertificateReloader) changed() bool {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err == nil && !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the certificates when a file's modification time changes or
+// SIGHUP is received, until stop is closed. A failed reload keeps serving the
+// previous certificates.
+func (r *CertificateReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			r.reloadAndLog("SIGHUP")
+		case <-ticker.C:
+			if r.changed() {
+				r.reloadAndLog("file change")
+			}
+		}
+	}
+}
+
+func (r *CertificateReloader) reloadAndLog(reason string) {
+	if err := r.Reload(); err != nil {
+		slog.Error("Failed to reload TLS certificates", "reason", reason, "error", err)
+		return
+	}
+	slog.Info("Reloaded TLS certificates", "reason", reason)
+}
+
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig builds the server configuration. clientAuth is one of "none",
+// "request" (verify a certificate if one is presented) or "require".
+func (r *CertificateReloader) TLSConfig(clientAuth string) (*tls.Config, error) {
+	var mode tls.ClientAuthType
+	switch clientAuth {
+	case "", "none":
+		mode = tls.NoClientCert
+	case "request":
+		mode = tls.VerifyClientCertIfGiven
+	case "require":
+		mode = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown TLS client auth mode %q", clientAuth)
+	}
+	if mode != tls.NoClientCert && r.clientCAFile == "" {
+		return nil, errors.New("TLS client authentication requires a client CA bundle")
+	}
+
+	base := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+		ClientAuth:     mode,
+	}
+	// Resolve the client CA pool per handshake so a reloaded bundle applies to
+	// new connections.
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mux.RLock()
+		defer r.mux.RUnlock()
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = r.clientCA
+		return cfg, nil
+	}
+	return base, nil
+}
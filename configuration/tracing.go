@@ -0,0 +1,174 @@
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracing exporters selectable with TRACING_EXPORTER.
+const (
+	TracingExporterOTLPGRPC = "otlp-grpc"
+	TracingExporterOTLPHTTP = "otlp-http"
+	TracingExporterStdout   = "stdout"
+	TracingExporterNone     = "none"
+)
+
+// exportTimeout bounds a single export so an unreachable collector cannot
+// stall the batcher or shutdown for long.
+const exportTimeout = 10 * time.Second
+
+type TracingConfiguration struct {
+	// Exporter is one of the TracingExporter* constants.
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the collector as host:port or URL. Empty uses the OTLP
+	// default or OTEL_EXPORTER_OTLP_ENDPOINT.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure disables TLS towards a host:port endpoint. It is on by
+	// default only in the development environment.
+	Insecure bool `yaml:"insecure"`
+	// File receives spans in stdout mode; empty writes to standard output.
+	File string `yaml:"file"`
+	// SampleRatio is the fraction of new traces that are sampled. Requests
+	// that carry a parent follow the parent's decision.
+	SampleRatio float64 `yaml:"sampleRatio"`
+	ServiceName string  `yaml:"serviceName"`
+}
+
+// NewTracerProvider builds a tracer provider exporting to the configured
+// exporter. Exporters connect lazily, so a collector that is down does not
+// fail startup; spans are dropped until it becomes reachable, which the
+// returned status reports. In "none" mode spans are still created, so trace
+// IDs keep appearing in logs, and the status is nil.
+func NewTracerProvider(cfg TracingConfiguration) (*sdktrace.TracerProvider, *ExporterStatus, error) {
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, nil, fmt.Errorf("tracing sample ratio %v is not between 0 and 1", cfg.SampleRatio)
+	}
+
+	r, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(cfg.ServiceName),
+		),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating tracing resource: %w", err)
+	}
+
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(r),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+	exporter, err := newSpanExporter(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	var status *ExporterStatus
+	if exporter != nil {
+		status = &ExporterStatus{}
+		exporter = statusExporter{exporter, status}
+		options = append(options, sdktrace.WithBatcher(exporter, sdktrace.WithExportTimeout(exportTimeout)))
+	}
+	return sdktrace.NewTracerProvider(options...), status, nil
+}
+
+// ExporterStatus remembers whether the most recent span export succeeded.
+type ExporterStatus struct {
+	mux     sync.RWMutex
+	lastErr error
+}
+
+// Check returns the error of the last export, if it failed. A nil status,
+// as returned in "none" mode, is always healthy.
+func (s *ExporterStatus) Check(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.lastErr
+}
+
+type statusExporter struct {
+	sdktrace.SpanExporter
+	status *ExporterStatus
+}
+
+func (e statusExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.status.mux.Lock()
+	e.status.lastErr = err
+	e.status.mux.Unlock()
+	return err
+}
+
+func newSpanExporter(cfg TracingConfiguration) (sdktrace.SpanExporter, error) {
+	isURL := strings.Contains(cfg.Endpoint, "://")
+
+	switch cfg.Exporter {
+	case TracingExporterOTLPGRPC:
+		options := []otlptracegrpc.Option{otlptracegrpc.WithTimeout(exportTimeout)}
+		if isURL {
+			options = append(options, otlptracegrpc.WithEndpointURL(cfg.Endpoint))
+		} else if cfg.Endpoint != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure && !isURL {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(context.Background(), options...)
+	case TracingExporterOTLPHTTP:
+		options := []otlptracehttp.Option{otlptracehttp.WithTimeout(exportTimeout)}
+		if isURL {
+			options = append(options, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		} else if cfg.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure && !isURL {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(context.Background(), options...)
+	case TracingExporterStdout:
+		if cfg.File == "" {
+			return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		}
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening tracing file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		return fileExporter{exporter, file}, nil
+	case TracingExporterNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+}
+
+// fileExporter closes the span file once the exporter has flushed.
+type fileExporter struct {
+	*stdouttrace.Exporter
+	file *os.File
+}
+
+func (e fileExporter) Shutdown(ctx context.Context) error {
+	err := e.Exporter.Shutdown(ctx)
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
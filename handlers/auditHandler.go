@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"projekat/httperr"
+	"projekat/model"
+	"projekat/services"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+type AuditHandler struct {
+	Service *services.AuditService
+	Tracer  trace.Tracer
+}
+
+type AuditPage struct {
+	Events []model.AuditEvent `json:"events"`
+	// Next is the cursor for the following page, empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+func NewAuditHandler(service *services.AuditService, tracer trace.Tracer) AuditHandler {
+	return AuditHandler{
+		service,
+		tracer,
+	}
+}
+
+// swagger:route GET /audit audit listAuditEvents
+// List audit events
+//
+// responses:
+//
+//	400: ErrorResponse
+//	200: AuditPage
+func (h *AuditHandler) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.Tracer.Start(r.Context(), "AuditHandler.GetAuditEvents")
+	defer span.End()
+
+	query := r.URL.Query()
+
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			recordError(span, err, http.StatusBadRequest)
+			httperr.Write(w, r, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	limit := defaultAuditPageSize
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxAuditPageSize {
+			recordError(span, fmt.Errorf("invalid limit %q", value), http.StatusBadRequest)
+			httperr.Write(w, r, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	var cursor uint64
+	if value := query.Get("cursor"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			recordError(span, err, http.StatusBadRequest)
+			httperr.Write(w, r, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = parsed
+	}
+
+	span.SetAttributes(
+		attribute.String("audit.resource", query.Get("resource")),
+		attribute.Int64("audit.after", int64(cursor)),
+		attribute.Int("audit.limit", limit),
+	)
+
+	events, next, err := h.Service.Query(query.Get("resource"), since, cursor, limit, ctx)
+	if err != nil {
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		httperr.Write(w, r, "Failed to read audit log", status)
+		return
+	}
+
+	span.SetAttributes(model.AttrResultCount.Int(len(events)))
+	page := AuditPage{Events: events}
+	if next != 0 {
+		page.Next = strconv.FormatUint(next, 10)
+	}
+	renderJSON(ctx, w, page)
+	span.SetStatus(codes.Ok, "")
+}
@@ -9,9 +9,10 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"io"
-	"log"
+	"log/slog"
 	"mime"
 	"net/http"
+	"projekat/httperr"
 	"projekat/model"
 	"projekat/services"
 	"strconv"
@@ -28,6 +29,7 @@ type AddConfigToGroupRequest struct {
 		Name       string            `json:"name"`
 		Labels     map[string]string `json:"labels"`
 		Parameters map[string]string `json:"parameters"`
+		Secrets    []string          `json:"secrets"`
 	}
 	ConfigGroup struct {
 		Name           string                 `json:"name"`
@@ -61,7 +63,7 @@ func (ch *ConfigForGroupHandler) renderer(ctx context.Context, w http.ResponseWr
 	js, err := json.Marshal(v)
 	if err != nil {
 
-		span.SetStatus(codes.Error, err.Error())
+		recordError(span, err, http.StatusInternalServerError)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -69,7 +71,7 @@ func (ch *ConfigForGroupHandler) renderer(ctx context.Context, w http.ResponseWr
 	w.Header().Set("Content-Type", "application/json")
 
 	if _, err := w.Write(js); err != nil {
-		span.SetStatus(codes.Error, err.Error())
+		recordError(span, err, http.StatusInternalServerError)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
@@ -82,34 +84,34 @@ func (ch *ConfigForGroupHandler) AddToConfigGroup(w http.ResponseWriter, req *ht
 	groupName := vars["groupName"]
 	groupVersionStr := vars["groupVersion"]
 
-	log.Printf("The version for configGroup is %s", groupVersionStr)
+	slog.DebugContext(ctx, "Adding config to group", "group", groupName, "version", groupVersionStr)
 
 	groupVersion, err := strconv.ParseFloat(groupVersionStr, 32)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "invalid groupVersion", http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, "invalid groupVersion", http.StatusBadRequest)
 		return
 	}
 
 	contentType := req.Header.Get("Content-Type")
 	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "an error has occurred: "+err.Error(), http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, "an error has occurred: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 	if mediaType != "application/json" {
-		span.SetStatus(codes.Error, err.Error())
 		err := errors.New("expect application/json Content-Type")
-		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		recordError(span, err, http.StatusUnsupportedMediaType)
+		httperr.Write(w, req, err.Error(), http.StatusUnsupportedMediaType)
 		return
 	}
 
 	// Read the entire request body
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "failed to read request body: "+err.Error(), http.StatusInternalServerError)
+		recordError(span, err, http.StatusInternalServerError)
+		httperr.Write(w, req, "failed to read request body: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -122,16 +124,25 @@ func (ch *ConfigForGroupHandler) AddToConfigGroup(w http.ResponseWriter, req *ht
 	var addToGroupReq AddConfigToGroupRequest
 	err = json.NewDecoder(req.Body).Decode(&addToGroupReq)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "failed to decode JSON request body: "+err.Error(), http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, "failed to decode JSON request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	span.SetAttributes(model.GroupAttributes(ctx, groupName, float32(groupVersion))...)
+	span.SetAttributes(model.AttrConfigName.String(addToGroupReq.ConfigForGroup.Name), model.LabelsAttribute(addToGroupReq.ConfigForGroup.Labels))
+
 	// Assuming addToGroupReq.ConfigForGroup is of type model.ConfigForGroup
-	err = ch.Service.AddToConfigGroup(addToGroupReq.ConfigForGroup.Name, addToGroupReq.ConfigForGroup.Labels, addToGroupReq.ConfigForGroup.Parameters, groupName, float32(groupVersion), ctx)
+	member := addToGroupReq.ConfigForGroup
+	err = ch.Service.AddToConfigGroupWithSecrets(member.Name, member.Labels, member.Parameters, member.Secrets, groupName, float32(groupVersion), ctx)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "Failed to add configuration to configuration group: "+err.Error(), http.StatusInternalServerError)
+		if status := renderQuotaError(w, req, err); status != 0 {
+			recordError(span, err, status)
+			return
+		}
+		status := secretErrorStatus(err, httperr.Status(err, http.StatusInternalServerError))
+		recordError(span, err, status)
+		httperr.Write(w, req, "Failed to add configuration to configuration group: "+err.Error(), status)
 		return
 	}
 
@@ -149,16 +160,19 @@ func (ch *ConfigForGroupHandler) DeleteFromConfigGroup(w http.ResponseWriter, re
 
 	versionFloat1, err := strconv.ParseFloat(groupVersion, 64)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, err.Error(), http.StatusBadRequest)
 		return
 	}
 	groupVersion32 := float32(versionFloat1)
+	span.SetAttributes(model.GroupAttributes(ctx, groupName, groupVersion32)...)
+	span.SetAttributes(model.AttrConfigName.String(configForGroupName))
 
 	err = ch.Service.DeleteFromConfigGroup(configForGroupName, groupName, groupVersion32, ctx)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "Failed to delete configuration from configuration group: "+err.Error(), http.StatusInternalServerError)
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		httperr.Write(w, req, "Failed to delete configuration from configuration group: "+err.Error(), status)
 		return
 	}
 
@@ -175,13 +189,13 @@ func (ch *ConfigForGroupHandler) GetConfigsByLabels(w http.ResponseWriter, req *
 	groupVersionStr := vars["groupVersion"]
 	labelsStr := vars["labels"]
 
-	log.Printf("groupName: %s, groupVersion: %s, labels: %s", groupName, groupVersionStr, labelsStr)
+	slog.DebugContext(ctx, "Getting configs by labels", "group", groupName, "version", groupVersionStr, "labels", labelsStr)
 
 	// Parse groupVersion from string to float32
 	groupVersion, err := strconv.ParseFloat(groupVersionStr, 32)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "invalid groupVersion", http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, "invalid groupVersion", http.StatusBadRequest)
 		return
 	}
 	groupVersion32 := float32(groupVersion)
@@ -195,14 +209,20 @@ func (ch *ConfigForGroupHandler) GetConfigsByLabels(w http.ResponseWriter, req *
 		}
 	}
 
+	span.SetAttributes(model.GroupAttributes(ctx, groupName, groupVersion32)...)
+	span.SetAttributes(model.LabelsAttribute(labelMap))
+
 	// Call the service method to get configurations by labels
 	configs, err := ch.Service.GetConfigsByLabels(groupName, groupVersion32, labelMap, ctx)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "Failed to get configurations by labels from configuration group: "+err.Error(), http.StatusInternalServerError)
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		httperr.Write(w, req, "Failed to get configurations by labels from configuration group: "+err.Error(), status)
 		return
 	}
 
+	span.SetAttributes(model.AttrResultCount.Int(len(configs)))
+
 	// Prepare response
 	configMap := make(map[string]interface{})
 	for _, config := range configs {
@@ -223,8 +243,8 @@ func (ch *ConfigForGroupHandler) DeleteConfigsByLabels(w http.ResponseWriter, re
 
 	versionFloat1, err := strconv.ParseFloat(groupVersion, 64)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, err.Error(), http.StatusBadRequest)
 		return
 	}
 	groupVersion32 := float32(versionFloat1)
@@ -237,10 +257,14 @@ func (ch *ConfigForGroupHandler) DeleteConfigsByLabels(w http.ResponseWriter, re
 		}
 	}
 
+	span.SetAttributes(model.GroupAttributes(ctx, groupName, groupVersion32)...)
+	span.SetAttributes(model.LabelsAttribute(labelMap))
+
 	err = ch.Service.DeleteConfigsByLabels(groupName, groupVersion32, labelMap, ctx)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "Failed to delete configuration from configuration group: "+err.Error(), http.StatusInternalServerError)
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		httperr.Write(w, req, "Failed to delete configuration from configuration group: "+err.Error(), status)
 		return
 	}
 	ch.renderer(ctx, w, map[string]string{"message": "Configuration deleted from group successfully"})
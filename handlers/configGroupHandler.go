@@ -3,17 +3,17 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
-	"log"
+	"log/slog"
 	"mime"
 	"net/http"
+	"projekat/httperr"
 	"projekat/model"
 	"projekat/services"
 	"strconv"
-	"strings"
 )
 
 type ConfigGroupHandler struct {
@@ -29,41 +29,48 @@ func NewConfigGroupHandler(service services.ConfigGroupService, tracer trace.Tra
 }
 
 func (ch *ConfigGroupHandler) CreateConfigGroup(w http.ResponseWriter, req *http.Request) {
-	log.Println("Entered CreateConfigGroup")
 	ctx, span := ch.Tracer.Start(req.Context(), "ConfigGroupHandler.CreateConfigGroup")
 	defer span.End()
 
 	contentType := req.Header.Get("Content-Type")
 	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, err.Error(), http.StatusBadRequest)
 		return
 	}
 	if mediaType != "application/json" {
-		span.SetStatus(codes.Error, err.Error())
 		err := errors.New("expect application/json Content-Type")
-		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		recordError(span, err, http.StatusUnsupportedMediaType)
+		httperr.Write(w, req, err.Error(), http.StatusUnsupportedMediaType)
 		return
 	}
 	var configGroup model.ConfigGroup
 	err = json.NewDecoder(req.Body).Decode(&configGroup)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	span.SetAttributes(model.GroupAttributes(ctx, configGroup.Name, configGroup.Version)...)
+	span.SetAttributes(attribute.Int("config_group.members", len(configGroup.Configurations)))
+
 	err = ch.Service.AddConfigGroup(configGroup.Name, configGroup.Version, configGroup.Configurations, ctx)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
 		// Log the error for debugging purposes
-		log.Printf("Error adding config group: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Error adding config group", "error", err)
+		if status := renderQuotaError(w, req, err); status != 0 {
+			recordError(span, err, status)
+			return
+		}
+		status := secretErrorStatus(err, httperr.Status(err, http.StatusInternalServerError))
+		recordError(span, err, status)
+		httperr.Write(w, req, err.Error(), status)
 		return
 	}
 	//renderJSON(req.Context(), w, configGroup)
-	renderJSON(ctx, w, configGroup)
+	renderJSON(ctx, w, configGroup.Redacted())
 	span.SetStatus(codes.Ok, "")
 }
 
@@ -77,25 +84,27 @@ func (c *ConfigGroupHandler) GetConfigGroup(w http.ResponseWriter, r *http.Reque
 
 	versionFloat, err := strconv.ParseFloat(version, 64) // ParseFloat returns float64
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "Invalid version number", http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, r, "Invalid version number", http.StatusBadRequest)
 		return
 	}
 	// Convert float64 to float32
 	version32 := float32(versionFloat)
+	span.SetAttributes(model.GroupAttributes(ctx, name, version32)...)
 
 	config, err := c.Service.GetConfigGroup(name, version32, ctx)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		errMsg := fmt.Sprintf("configGroup '%s' with version %.2f not found", name, version)
-		if strings.Contains(err.Error(), errMsg) {
-			http.Error(w, "Configuration group not found", http.StatusNotFound)
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		if status == http.StatusNotFound {
+			httperr.Write(w, r, "Configuration group not found", status)
 		} else {
-			http.Error(w, "Failed to retrieve configuration group", http.StatusInternalServerError)
+			httperr.Write(w, r, "Failed to retrieve configuration group", status)
 		}
 		return
 	}
 
+	span.SetAttributes(attribute.Int("config_group.members", len(config.Configurations)))
 	//renderJSON(r.Context(), w, config)
 	renderJSON(ctx, w, config)
 	span.SetStatus(codes.Ok, "")
@@ -111,23 +120,30 @@ func (ch *ConfigGroupHandler) DeleteConfigGroup(w http.ResponseWriter, req *http
 	version := mux.Vars(req)["version"]
 	versionFloat, err := strconv.ParseFloat(version, 64)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, err.Error(), http.StatusBadRequest)
 		return
 	}
 	version32 := float32(versionFloat)
+	span.SetAttributes(model.GroupAttributes(ctx, name, version32)...)
 
 	configGroup, err := ch.Service.GetConfigGroup(name, version32, ctx)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "Configuration group not found: "+err.Error(), http.StatusNotFound)
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		if status == http.StatusNotFound {
+			httperr.Write(w, req, "Configuration group not found: "+err.Error(), status)
+		} else {
+			httperr.Write(w, req, "Failed to retrieve configuration group: "+err.Error(), status)
+		}
 		return
 	}
 
 	err = ch.Service.DeleteConfigGroup(configGroup.Name, configGroup.Version, ctx)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "Failed to delete configuration group: "+err.Error(), http.StatusInternalServerError)
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		httperr.Write(w, req, "Failed to delete configuration group: "+err.Error(), status)
 		return
 	}
 
@@ -5,25 +5,26 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"io"
-	"log"
+	"log/slog"
 	"mime"
 	"net/http"
+	"projekat/httperr"
 	"projekat/model"
 	"projekat/services"
 	"strconv"
-	"strings"
 )
 
 type ConfigHandler struct {
-	logger  *log.Logger
+	logger  *slog.Logger
 	Service services.ConfigService
 	Tracer  trace.Tracer
 }
 
-func NewConfigHandler(l *log.Logger, s services.ConfigService, tracer trace.Tracer) *ConfigHandler {
+func NewConfigHandler(l *slog.Logger, s services.ConfigService, tracer trace.Tracer) *ConfigHandler {
 	return &ConfigHandler{l, s, tracer}
 }
 
@@ -41,7 +42,7 @@ func decodeBody(ctx context.Context, r io.Reader) (*model.Config, error) {
 func renderJSON(ctx context.Context, w http.ResponseWriter, v interface{}) {
 	js, err := json.Marshal(v)
 	if err != nil {
-		log.Println("There has been an internal error.")
+		slog.ErrorContext(ctx, "Error marshalling response", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -49,53 +50,85 @@ func renderJSON(ctx context.Context, w http.ResponseWriter, v interface{}) {
 	_, err = w.Write(js)
 	if err != nil {
 		// Log the error instead of returning it
-		log.Println("Error writing response:", err)
+		slog.ErrorContext(ctx, "Error writing response", "error", err)
 	}
 }
 
-func (c *ConfigHandler) Get(w http.ResponseWriter, r *http.Request) {
-	log.Println("Entering Get handler") // Log entry
+// recordError records err on span as an exception. The span is marked failed
+// only when the response status is a server error: a 4xx is the client's
+// mistake, not the service's.
+func recordError(span trace.Span, err error, status int) {
+	span.RecordError(err)
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// renderQuotaError writes a 413 when the request itself is too large and a 403
+// when the namespace is full, and returns the status. It returns 0 if err is
+// not a quota error.
+func renderQuotaError(w http.ResponseWriter, r *http.Request, err error) int {
+	var quotaErr *services.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return 0
+	}
+	status := http.StatusForbidden
+	if quotaErr.TooLarge {
+		status = http.StatusRequestEntityTooLarge
+	}
+	quota := quotaErr.QuotaExceeded
+	httperr.WriteResponse(w, r, model.ErrorResponse{Message: quotaErr.Error(), Quota: &quota}, status)
+	return status
+}
+
+// secretErrorStatus returns 400 for secrets that cannot be encrypted because
+// no keyring is configured or the named parameter is missing, and status
+// otherwise.
+func secretErrorStatus(err error, status int) int {
+	if errors.Is(err, services.ErrNoKeyring) || errors.Is(err, services.ErrSecretNotFound) {
+		return http.StatusBadRequest
+	}
+	return status
+}
 
+func (c *ConfigHandler) Get(w http.ResponseWriter, r *http.Request) {
 	ctx, span := c.Tracer.Start(r.Context(), "ConfigHandler.Get")
 	defer span.End()
 
 	name := mux.Vars(r)["name"]
 	version := mux.Vars(r)["version"]
-	log.Printf("Received request for config: name=%s, version=%s", name, version) // Log request details
+	c.logger.DebugContext(ctx, "Received request for config", "name", name, "version", version) // Log request details
 
 	versionFloat, err := strconv.ParseFloat(version, 64) // ParseFloat returns float64
 	if err != nil {
-		log.Printf("Error parsing version: %v", err) // Log error
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "Invalid version number", http.StatusBadRequest)
+		c.logger.DebugContext(ctx, "Error parsing version", "error", err) // Log error
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, r, "Invalid version number", http.StatusBadRequest)
 		return
 	}
-	log.Printf("Parsed version: %f", versionFloat) // Log parsed version
-
 	// Convert float64 to float32
 	version32 := float32(versionFloat)
-	log.Printf("Converted version to float32: %f", version32) // Log converted version
+	span.SetAttributes(model.ConfigAttributes(ctx, name, version32)...)
 
 	config, err := c.Service.GetConfig(name, version32, ctx)
 	if err != nil {
-		log.Printf("Error getting config: %v", err) // Log error
-		span.SetStatus(codes.Error, err.Error())
-		if strings.Contains(err.Error(), "config not found") {
-			http.Error(w, "Configuration not found", http.StatusNotFound)
+		c.logger.ErrorContext(ctx, "Error getting config", "error", err) // Log error
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		if status == http.StatusNotFound {
+			httperr.Write(w, r, "Configuration not found", status)
 		} else {
-			http.Error(w, "Failed to retrieve configuration", http.StatusInternalServerError)
+			httperr.Write(w, r, "Failed to retrieve configuration", status)
 		}
 		return
 	}
-	log.Printf("Retrieved config: %+v", config) // Log retrieved config
+	c.logger.DebugContext(ctx, "Retrieved config", "config", config.Redacted()) // Log retrieved config
 
 	renderJSON(ctx, w, config)
 	span.SetStatus(codes.Ok, "")
-	log.Println("Successfully processed Get handler") // Log successful completion
 }
 
 func (ch *ConfigHandler) CreatePostHandler(w http.ResponseWriter, req *http.Request) {
-	log.Println("Entering Post handler")
 	ctx, span := ch.Tracer.Start(req.Context(), "ConfigHandler.CreatePostHandler")
 	defer span.End()
 
@@ -103,39 +136,48 @@ func (ch *ConfigHandler) CreatePostHandler(w http.ResponseWriter, req *http.Requ
 	contentType := req.Header.Get("Content-Type")
 	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		log.Printf("Error parsing Content-Type header: %v", err)
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		ch.logger.DebugContext(ctx, "Error parsing Content-Type header", "error", err)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, err.Error(), http.StatusBadRequest)
 		return
 	}
 	if mediaType != "application/json" {
 		err := errors.New("expect application/json Content-Type")
-		log.Printf("Invalid media type: %s", mediaType)
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		ch.logger.DebugContext(ctx, "Invalid media type", "mediaType", mediaType)
+		recordError(span, err, http.StatusUnsupportedMediaType)
+		httperr.Write(w, req, err.Error(), http.StatusUnsupportedMediaType)
 		return
 	}
 
 	// Decode request body into model.Config
 	config, err := decodeBody(req.Context(), req.Body)
 	if err != nil {
-		log.Printf("Error decoding request body: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		ch.logger.DebugContext(ctx, "Error decoding request body", "error", err)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, err.Error(), http.StatusBadRequest)
 		return
 	}
-	log.Printf("Decoded config: %+v", config)
+	ch.logger.DebugContext(ctx, "Decoded config", "name", config.Name, "version", config.Version)
+	span.SetAttributes(model.ConfigAttributes(ctx, config.Name, config.Version)...)
+	span.SetAttributes(attribute.Int("config.parameters", len(config.Parameters)), attribute.Int("config.secrets", len(config.Secrets)))
 
 	// Call service to add configuration
-	err = ch.Service.AddConfig(config.Name, config.Version, config.Parameters, ctx)
+	err = ch.Service.AddConfigWithSecrets(config.Name, config.Version, config.Parameters, config.Secrets, ctx)
 	if err != nil {
-		log.Printf("Error adding config: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ch.logger.ErrorContext(ctx, "Error adding config", "error", err)
+		if status := renderQuotaError(w, req, err); status != 0 {
+			recordError(span, err, status)
+			return
+		}
+		status := secretErrorStatus(err, httperr.Status(err, http.StatusInternalServerError))
+		recordError(span, err, status)
+		httperr.Write(w, req, err.Error(), status)
 		return
 	}
 
-	// Render response as JSON
+	// Render response as JSON, never echoing secrets back
+	config.Parameters = services.MaskConfig(config).Parameters
 	renderJSON(ctx, w, config)
-	log.Println("Successfully processed CreatePostHandler")
 	span.SetStatus(codes.Ok, "")
 }
 
@@ -146,22 +188,30 @@ func (ch *ConfigHandler) DelPostHandler(w http.ResponseWriter, req *http.Request
 	version := mux.Vars(req)["version"]
 	versionFloat, err := strconv.ParseFloat(version, 64)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, err.Error(), http.StatusBadRequest)
 		return
 	}
 	version32 := float32(versionFloat)
+	span.SetAttributes(model.ConfigAttributes(ctx, name, version32)...)
 
 	config, err := ch.Service.GetConfig(name, version32, ctx)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "Configuration not found: "+err.Error(), http.StatusNotFound)
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		if status == http.StatusNotFound {
+			httperr.Write(w, req, "Configuration not found: "+err.Error(), status)
+		} else {
+			httperr.Write(w, req, "Failed to retrieve configuration: "+err.Error(), status)
+		}
 		return
 	}
 
 	err = ch.Service.DeleteConfig(config.Name, config.Version, ctx)
 	if err != nil {
-		http.Error(w, "Failed to delete configuration: "+err.Error(), http.StatusInternalServerError)
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		httperr.Write(w, req, "Failed to delete configuration: "+err.Error(), status)
 		return
 	}
 
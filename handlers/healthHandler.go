@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"projekat/model"
+	"projekat/services"
+)
+
+type HealthHandler struct {
+	Service services.HealthService
+}
+
+func NewHealthHandler(service services.HealthService) HealthHandler {
+	return HealthHandler{service}
+}
+
+// Live reports that the process is running and able to serve requests. It
+// checks no dependencies, so an outage elsewhere never gets it restarted.
+func (h HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	renderHealth(w, http.StatusOK, map[string]string{"status": services.HealthUp})
+}
+
+// Ready answers 503 while any required dependency is down so load balancers
+// stop routing traffic here. Optional dependencies never affect it.
+func (h HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.Service.Check(r.Context())
+	renderHealth(w, healthStatusCode(report), map[string]string{"status": report.Status})
+}
+
+// Health returns the status and latency of every dependency. Error messages
+// are left out unless the caller is authenticated.
+func (h HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	report := h.Service.Check(r.Context())
+	if _, ok := model.PrincipalFromContext(r.Context()); !ok {
+		report = report.WithoutErrors()
+	}
+	renderHealth(w, healthStatusCode(report), report)
+}
+
+func healthStatusCode(report services.HealthReport) int {
+	if report.Healthy() {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
+
+func renderHealth(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"mime"
+	"net/http"
+	"projekat/httperr"
+	"projekat/model"
+	"projekat/services"
+)
+
+type NamespaceHandler struct {
+	Service services.NamespaceService
+	Tracer  trace.Tracer
+}
+
+func NewNamespaceHandler(service services.NamespaceService, tracer trace.Tracer) NamespaceHandler {
+	return NamespaceHandler{
+		service,
+		tracer,
+	}
+}
+
+func (nh *NamespaceHandler) CreateNamespace(w http.ResponseWriter, req *http.Request) {
+	ctx, span := nh.Tracer.Start(req.Context(), "NamespaceHandler.CreateNamespace")
+	defer span.End()
+
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if mediaType != "application/json" {
+		err := errors.New("expect application/json Content-Type")
+		recordError(span, err, http.StatusUnsupportedMediaType)
+		httperr.Write(w, req, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	var namespace model.Namespace
+	if err := dec.Decode(&namespace); err != nil {
+		recordError(span, err, http.StatusBadRequest)
+		httperr.Write(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	span.SetAttributes(model.AttrNamespace.String(namespace.Name))
+
+	err = nh.Service.AddNamespace(&namespace, ctx)
+	if err != nil {
+		var message string
+		var status int
+		switch {
+		case errors.Is(err, services.ErrInvalidNamespace):
+			message, status = err.Error(), http.StatusBadRequest
+		case errors.Is(err, services.ErrNamespaceExists):
+			message, status = err.Error(), http.StatusConflict
+		default:
+			slog.ErrorContext(ctx, "Error adding namespace", "error", err)
+			message, status = "Failed to add namespace", httperr.Status(err, http.StatusInternalServerError)
+		}
+		recordError(span, err, status)
+		httperr.Write(w, req, message, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	renderJSON(ctx, w, namespace)
+	span.SetStatus(codes.Ok, "")
+}
+
+func (nh *NamespaceHandler) GetNamespace(w http.ResponseWriter, req *http.Request) {
+	ctx, span := nh.Tracer.Start(req.Context(), "NamespaceHandler.GetNamespace")
+	defer span.End()
+
+	span.SetAttributes(model.AttrNamespace.String(mux.Vars(req)["namespace"]))
+	namespace, err := nh.Service.GetNamespace(mux.Vars(req)["namespace"], ctx)
+	if err != nil {
+		message, status := "Namespace not found", http.StatusNotFound
+		if !errors.Is(err, services.ErrNamespaceNotFound) {
+			message, status = "Failed to look up namespace", httperr.Status(err, http.StatusServiceUnavailable)
+		}
+		recordError(span, err, status)
+		httperr.Write(w, req, message, status)
+		return
+	}
+
+	renderJSON(ctx, w, namespace)
+	span.SetStatus(codes.Ok, "")
+}
+
+func (nh *NamespaceHandler) ListNamespaces(w http.ResponseWriter, req *http.Request) {
+	ctx, span := nh.Tracer.Start(req.Context(), "NamespaceHandler.ListNamespaces")
+	defer span.End()
+
+	namespaces, err := nh.Service.ListNamespaces(ctx)
+	if err != nil {
+		status := httperr.Status(err, http.StatusInternalServerError)
+		recordError(span, err, status)
+		httperr.Write(w, req, "Failed to list namespaces", status)
+		return
+	}
+
+	span.SetAttributes(model.AttrResultCount.Int(len(namespaces)))
+	renderJSON(ctx, w, namespaces)
+	span.SetStatus(codes.Ok, "")
+}
+
+func (nh *NamespaceHandler) DeleteNamespace(w http.ResponseWriter, req *http.Request) {
+	ctx, span := nh.Tracer.Start(req.Context(), "NamespaceHandler.DeleteNamespace")
+	defer span.End()
+
+	span.SetAttributes(model.AttrNamespace.String(mux.Vars(req)["namespace"]))
+	err := nh.Service.DeleteNamespace(mux.Vars(req)["namespace"], ctx)
+	if err != nil {
+		var message string
+		var status int
+		switch {
+		case errors.Is(err, services.ErrNamespaceNotFound):
+			message, status = err.Error(), http.StatusNotFound
+		case errors.Is(err, services.ErrNamespaceNotEmpty), errors.Is(err, services.ErrNamespaceReserved):
+			message, status = err.Error(), http.StatusConflict
+		default:
+			message, status = "Failed to delete namespace: "+err.Error(), httperr.Status(err, http.StatusInternalServerError)
+		}
+		recordError(span, err, status)
+		httperr.Write(w, req, message, status)
+		return
+	}
+
+	renderJSON(ctx, w, map[string]string{"message": "Namespace deleted successfully"})
+	span.SetStatus(codes.Ok, "")
+}
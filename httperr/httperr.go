@@ -0,0 +1,41 @@
+// Package httperr maps errors from the service and storage layers to HTTP
+// responses, so handlers and middleware answer the same failure the same way.
+package httperr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"projekat/model"
+)
+
+// Status returns 404 for entries that do not exist, 504 for storage calls
+// that ran out of their time budget, 503 for ones cancelled by shutdown or a
+// client that went away or refused by the open storage circuit, and status
+// for anything else.
+func Status(err error, status int) int {
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled), errors.Is(err, model.ErrStorageUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return status
+}
+
+// Write renders message as a JSON error body carrying the request ID.
+func Write(w http.ResponseWriter, r *http.Request, message string, status int) {
+	WriteResponse(w, r, model.ErrorResponse{Message: message}, status)
+}
+
+// WriteResponse renders response, which may carry details of the failure, as
+// a JSON error body with the request ID filled in.
+func WriteResponse(w http.ResponseWriter, r *http.Request, response model.ErrorResponse, status int) {
+	response.RequestID = model.RequestIDFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -16,19 +16,16 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
+	"flag"
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/jaeger"
 	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
-	"golang.org/x/time/rate"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -38,118 +35,302 @@ import (
 	"projekat/model"
 	"projekat/repositories"
 	"projekat/services"
+	"strings"
 	"syscall"
 	"time"
 )
 
 func main() {
-
-	dbHost := os.Getenv("DB")
-	dbPort := os.Getenv("DBPORT")
-
-	if dbHost == "" || dbPort == "" {
-		log.Fatal("DB and DBPORT environment variables must be set")
+	// Commands take their flags after the command name.
+	command, args := "", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	cfg, options, err := configuration.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if len(options.Args) > 0 && command != "migrate-keys" {
+		log.Fatalf("Unexpected arguments: %s", strings.Join(options.Args, " "))
+	}
+	if options.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("Failed to print configuration: %v", err)
+		}
+		return
 	}
 
-	// Set Consul address
-	consulAddress := "http://" + dbHost + ":" + dbPort
-	os.Setenv("CONSUL_HTTP_ADDR", consulAddress)
-
-	port := os.Getenv("PORT") // set port for consul
-	if len(port) == 0 {
-		port = "8000"
+	// Commands keep stdout for their report.
+	logOutput := os.Stdout
+	if command != "" {
+		logOutput = os.Stderr
+	}
+	logger, err := configuration.NewLogger(cfg.LogLevel, logOutput)
+	if err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	switch command {
+	case "":
+	case "audit-verify":
+		os.Exit(verifyAuditLog(cfg))
+	case "rotate-secrets":
+		os.Exit(rotateSecrets(cfg))
+	case "healthcheck":
+		os.Exit(healthcheck(cfg))
+	case "migrate-keys":
+		os.Exit(migrateKeys(cfg, options.Args))
+	default:
+		fatal("Unknown command "+command, nil)
 	}
-	logger := log.New(os.Stdout, "[config-api] ", log.LstdFlags)
 
 	// For Tracing
-	cfg := configuration.GetConfiguration()
 	ctx := context.Background()
-	exp, err := newExporter(cfg.JaegerAddress)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("Tracing error", "error", err)
+	}))
+	tp, exporterStatus, err := configuration.NewTracerProvider(cfg.Tracing)
 	if err != nil {
-		log.Fatalf("failed to initialize exporter: %v", err)
+		fatal("Failed to initialize tracing", err)
 	}
-	tp := newTraceProvider(exp)
-	defer func() { _ = tp.Shutdown(ctx) }()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = tp.Shutdown(ctx)
+	}()
 	otel.SetTracerProvider(tp)
 	otel.SetTextMapPropagator(propagation.TraceContext{})
-	tracer := tp.Tracer("alati_projekat")
+	tracer := tp.Tracer(instrumentationName)
 
-	repo, err := repositories.New(logger, tracer) // new consul repo for configs
+	// Every repository is wrapped so storage latency and errors are measured
+	// separately from the handlers.
+	metricsService := services.NewMetricsService()
+	storageMetrics := metricsService.Storage
+	// All repositories share one Consul client and its connection pool.
+	storageOptions := consulOptions(cfg.Storage)
+	if cfg.Storage.Breaker.Enabled {
+		breakerOptions := repositories.BreakerOptions{FailureThreshold: cfg.Storage.Breaker.FailureThreshold, OpenTimeout: cfg.Storage.Breaker.OpenTimeout}
+		storageOptions.Breaker = repositories.NewCircuitBreaker(breakerOptions, metricsService.Breaker)
+	}
+	consul, err := repositories.NewConsulClient(storageOptions, tracer)
 	if err != nil {
-		logger.Fatal("Failed to create repository:", err)
+		fatal("Failed to create Consul client", err)
+	}
+	keyspace := repositories.NewKeyspace(cfg.Storage.KeyPrefix)
+
+	// Config and group reads are cached in front of the instrumentation, so
+	// storage metrics only count calls that reach Consul. While the circuit
+	// is open they are served stale from the cache or the snapshot file.
+	background, stopBackground := context.WithCancel(ctx)
+	defer stopBackground()
+	var cache *repositories.StorageCache
+	if cfg.Storage.Cache.Enabled {
+		cacheOptions := repositories.CacheOptions{Size: cfg.Storage.Cache.Size, TTL: cfg.Storage.Cache.TTL}
+		cache = repositories.NewStorageCache(consul, keyspace, cacheOptions, metricsService.Cache, logger)
+		go cache.Watch(background)
 	}
+	var snapshot *repositories.SnapshotFile
+	if cfg.Storage.Snapshot.File != "" {
+		snapshot = repositories.NewSnapshotFile(cfg.Storage.Snapshot.File, consul, keyspace, logger)
+		if err := snapshot.Load(); err != nil {
+			logger.Warn("Failed to load storage snapshot", "file", cfg.Storage.Snapshot.File, "error", err)
+		}
+		go snapshot.Run(background, cfg.Storage.Snapshot.Interval)
+	}
+
+	consulRepo := repositories.New(consul, keyspace, logger, tracer) // new consul repo for configs
+	repo := repositories.CacheConfigRepository(repositories.InstrumentConfigRepository(consulRepo, "consul", storageMetrics), cache)
+	repo = repositories.FallbackConfigRepository(repo, keyspace, cache, snapshot)
+
+	consulRepoCG := repositories.NewCG(consul, keyspace, logger, tracer) // consul for configGroup
+	repoCG := repositories.CacheConfigGroupRepository(repositories.InstrumentConfigGroupRepository(consulRepoCG, "consul", storageMetrics), cache)
+	repoCG = repositories.FallbackConfigGroupRepository(repoCG, keyspace, cache, snapshot)
+
+	consulRepoCFG := repositories.NewCFG(consul, keyspace, logger, tracer)
+	repoCFG := repositories.CacheConfigForGroupRepository(repositories.InstrumentConfigForGroupRepository(consulRepoCFG, "consul", storageMetrics), cache)
+	repoCFG = repositories.FallbackConfigForGroupRepository(repoCFG, keyspace, cache, snapshot)
 
-	repoCG, err2 := repositories.NewCG(logger, tracer) // consul for configGroup
-	if err2 != nil {
-		logger.Fatal("Failed to create repository for configGroup:", err)
+	// Only a keyspace written with another layout stops the service. While
+	// Consul is unreachable the check is retried and reads are served stale.
+	runStartupTask(background, "Storage layout check", func(err error) bool {
+		return errors.Is(err, repositories.ErrLayoutVersion)
+	}, func(ctx context.Context) error {
+		return repositories.EnsureLayout(ctx, consul, keyspace)
+	})
+
+	//repo2 := repositories.NewConfigGroupInMemRepository()
+
+	consulRepoAudit := repositories.NewAudit(consul, keyspace, logger, tracer)
+	auditService := services.NewAuditService(repositories.InstrumentAuditRepository(consulRepoAudit, "consul", storageMetrics), tracer)
+	auditService.SetMetrics(metricsService)
+
+	consulRepoNS := repositories.NewNS(consul, keyspace, logger, tracer)
+	repoNS := repositories.FallbackNamespaceRepository(repositories.InstrumentNamespaceRepository(consulRepoNS, "consul", storageMetrics), keyspace, snapshot)
+	namespaceService := services.NewNamespaceService(repoNS).WithAudit(auditService).WithTracer(tracer)
+
+	var quotaPolicy *services.QuotaPolicy
+	if cfg.QuotaFile != "" {
+		quotaPolicy, err = services.LoadQuotaPolicy(cfg.QuotaFile)
+		if err != nil {
+			fatal("Failed to load quotas", err)
+		}
 	}
+	quotaService := services.NewQuotaService(repo, repoCG, namespaceService, quotaPolicy, metricsService)
+	quotaService.SetTracer(tracer)
+	inventory := services.NewInventoryCollector(repo, repoCG, namespaceService)
+	metricsService.Registry.MustRegister(inventory)
 
-	repoCFG, err3 := repositories.NewCFG(logger, tracer)
-	if err3 != nil {
-		logger.Fatal("Failed to create repository for configForGroup:", err3)
+	if err := model.SetSecretPatterns(cfg.Secrets.RedactPatterns); err != nil {
+		fatal("Invalid redact patterns", err)
 	}
 
-	//repo2 := repositories.NewConfigGroupInMemRepository()
+	var secretService *services.SecretService
+	if cfg.Secrets.KeyFile != "" {
+		secretService, err = services.LoadKeyring(cfg.Secrets.KeyFile)
+		if err != nil {
+			fatal("Failed to load master keys", err)
+		}
+		auditService.SetStateKey(secretService.StateKey())
+	}
 
-	service := services.NewConfigService(repo)
-	service1 := services.NewConfigForGroupService(repoCFG)
-	service.Hello()
-	params := make(map[string]string)
-	params["username"] = "pera"
-	params["password"] = "pera"
-	configs := model.NewConfig("db_config", 2.0, params)
-	err = service.AddConfig(configs.Name, configs.Version, configs.Parameters, ctx)
-	if err != nil {
-		return
+	service := services.NewConfigService(repo).WithAudit(auditService).WithQuota(quotaService).WithSecrets(secretService).WithTracer(tracer)
+	service1 := services.NewConfigForGroupService(repoCFG).WithAudit(auditService, repoCG).WithQuota(quotaService, repoCG).WithSecrets(secretService).WithTracer(tracer)
+	service2 := services.NewConfigGroupService(repoCG).WithAudit(auditService).WithQuota(quotaService).WithSecrets(secretService).WithTracer(tracer)
+	// Invalid or conflicting files stop the service; storage errors are
+	// retried in the background, which is safe as entries already stored
+	// are left alone.
+	if cfg.Bootstrap.Dir != "" {
+		bootstrap := services.NewBootstrapService(service, service2, namespaceService)
+		runStartupTask(background, "Bootstrap", func(err error) bool {
+			var quotaErr *services.QuotaError
+			return errors.Is(err, services.ErrBootstrapInvalid) || errors.Is(err, services.ErrBootstrapConflict) || errors.As(err, &quotaErr)
+		}, func(ctx context.Context) error {
+			report, err := bootstrap.Apply(cfg.Bootstrap.Dir, cfg.Bootstrap.Mode, ctx)
+			if report != nil {
+				logger.Info("Bootstrap finished", "dir", cfg.Bootstrap.Dir, "mode", cfg.Bootstrap.Mode, "report", report)
+			}
+			return err
+		})
 	}
 
-	var limiter = rate.NewLimiter(0.167, 10) //For testing
-	name := "db_config"
-	version := float32(2.0)
-	config, err := repo.GetConfig(name, version, ctx)
-	if err != nil {
-		fmt.Println("Error:", err)
-	} else {
-		fmt.Println("Config:", config)
+	var rateLimitRepo model.RateLimitRepository
+	if cfg.RateLimit.Backend == "consul" {
+		repoRL := repositories.NewRL(consul, keyspace, logger, tracer)
+		rateLimitRepo = repositories.InstrumentRateLimitRepository(repoRL, "consul", storageMetrics)
 	}
+	limiter := services.NewRateLimitService(rateLimitRepo, cfg.RateLimit.Requests, cfg.RateLimit.Window, tracer)
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
-	idempotencyService := services.NewIdempotencyService(*repo, tracer)
+	namespaceMiddleware := middleware2.NewNamespaces(namespaceService)
+
+	idempotencyService := services.NewIdempotencyService(repositories.InstrumentIdempotencyRepository(consulRepo, "consul", storageMetrics), tracer)
 	idempotencyMiddleware := middleware2.NewIdempotency(&idempotencyService, tracer)
-	metricsService := services.NewMetricsService()
+	idempotencyMiddleware.SetAudit(auditService)
+	idempotencyMiddleware.SetRequired(cfg.Idempotency.Required)
 	metricsMiddleware := middleware2.NewMetrics(metricsService)
 
+	jwtSecret, err := cfg.Auth.Secret()
+	if err != nil {
+		fatal("Failed to read the JWT secret", err)
+	}
+	jwtVerifier, err := services.NewJWTVerifier(jwtSecret, cfg.Auth.JWKSFile, cfg.Auth.JWTIssuer, cfg.Auth.JWTAudience)
+	if err != nil {
+		fatal("Failed to load JWT verification keys", err)
+	}
+	authService, err := services.NewAuthService(cfg.Auth.APIKeysFile, jwtVerifier)
+	if err != nil {
+		fatal("Failed to load API keys", err)
+	}
+	if cfg.TLS.Enabled() && cfg.TLS.ClientAuth != "none" {
+		authService.EnableClientCertificates()
+	}
+	authMiddleware := middleware2.NewAuth(authService, cfg.Auth.PublicPaths)
+
+	var authz *middleware2.Authorization
+	if cfg.Auth.PolicyFile != "" {
+		policy, err := services.LoadPolicy(cfg.Auth.PolicyFile)
+		if err != nil {
+			fatal("Failed to load authorization policy", err)
+		}
+		authzService, err := services.NewAuthorizationService(policy)
+		if err != nil {
+			fatal("Invalid authorization policy", err)
+		}
+		authz = middleware2.NewAuthorization(authzService)
+	} else {
+		logger.Warn("No authorization policy configured, every caller may read and write but secrets cannot be revealed")
+		authz = middleware2.NewOpenAuthorization()
+	}
+	authz.SetAudit(auditService)
+
 	router := mux.NewRouter()
 	router.StrictSlash(true)
 	router.Use(otelmux.Middleware("alati_projekat"))
+	router.Use(middleware2.AdaptRequestIDHandler)
+	// Metrics come before the middleware that can answer a request itself.
+	// Requests no route matches skip the router's middleware and are
+	// counted as route="unmatched".
+	router.Use(func(next http.Handler) http.Handler {
+		return middleware2.AdaptPrometheusHandler(next, metricsMiddleware)
+	})
+	router.NotFoundHandler = middleware2.AdaptPrometheusHandler(http.NotFoundHandler(), metricsMiddleware)
+	router.MethodNotAllowedHandler = middleware2.AdaptPrometheusHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}), metricsMiddleware)
+	router.Use(middleware2.AdaptCacheControlHandler)
+	router.Use(middleware2.AdaptStaleHandler)
+
+	if authService.Enabled() {
+		router.Use(func(next http.Handler) http.Handler {
+			return middleware2.AdaptAuthHandler(next, authMiddleware)
+		})
+	} else {
+		logger.Warn("No API keys or JWT keys configured, authentication is disabled")
+	}
 
 	router.Use(func(next http.Handler) http.Handler {
-		return middleware2.AdaptIdempotencyHandler(next, idempotencyMiddleware)
+		return middleware2.AdaptNamespaceHandler(next, namespaceMiddleware)
 	})
 
 	router.Use(func(next http.Handler) http.Handler {
-		return middleware2.AdaptPrometheusHandler(next, metricsMiddleware)
+		return middleware2.AdaptIdempotencyHandler(next, idempotencyMiddleware)
 	})
 
 	server := handlers.NewConfigHandler(logger, service, tracer)
 
 	server1 := handlers.NewConfigForGroupHandler(service1, tracer)
-	service2 := services.NewConfigGroupService(repoCG)
 	server2 := handlers.NewConfigGroupHandler(service2, tracer)
+	server3 := handlers.NewAuditHandler(auditService, tracer)
+	server4 := handlers.NewNamespaceHandler(namespaceService, tracer)
+
+	router.Handle("/ns/", middleware2.RateLimit(limiter, authz.Require(model.ActionAdmin, model.ResourceNamespace, "", server4.CreateNamespace))).Methods("POST")
+	router.Handle("/ns/", middleware2.RateLimit(limiter, authz.Require(model.ActionRead, model.ResourceNamespace, "", server4.ListNamespaces))).Methods("GET")
+	router.Handle("/ns/{namespace}/", middleware2.RateLimit(limiter, authz.Require(model.ActionRead, model.ResourceNamespace, "namespace", server4.GetNamespace))).Methods("GET")
+	router.Handle("/ns/{namespace}/", middleware2.RateLimit(limiter, authz.Require(model.ActionAdmin, model.ResourceNamespace, "namespace", server4.DeleteNamespace))).Methods("DELETE")
+
+	routes := func(r *mux.Router) {
+		r.Handle("/config/", middleware2.RateLimit(limiter, authz.Require(model.ActionWrite, model.ResourceConfig, "", server.CreatePostHandler))).Methods("POST")
+		r.Handle("/config/{name}/{version}/", middleware2.RateLimit(limiter, authz.Require(model.ActionRead, model.ResourceConfig, "name", server.Get))).Methods("GET")
+		r.Handle("/config/{name}/{version}/", middleware2.RateLimit(limiter, authz.Require(model.ActionDelete, model.ResourceConfig, "name", server.DelPostHandler))).Methods("DELETE")
+		r.Handle("/configGroup/", middleware2.RateLimit(limiter, authz.Require(model.ActionWrite, model.ResourceGroup, "", server2.CreateConfigGroup))).Methods("POST")
+		r.Handle("/configGroup/{name}/{version}/", middleware2.RateLimit(limiter, authz.Require(model.ActionRead, model.ResourceGroup, "name", server2.GetConfigGroup))).Methods("GET")
+		r.Handle("/configGroup/{name}/{version}/", middleware2.RateLimit(limiter, authz.Require(model.ActionDelete, model.ResourceGroup, "name", server2.DeleteConfigGroup))).Methods("DELETE")
+		r.Handle("/config/configGroup/{groupName}/{groupVersion}/", middleware2.RateLimit(limiter, authz.Require(model.ActionWrite, model.ResourceGroup, "groupName", server1.AddToConfigGroup))).Methods("POST")
+		r.Handle("/config/{name}/{groupName}/{groupVersion}/", middleware2.RateLimit(limiter, authz.Require(model.ActionWrite, model.ResourceGroup, "groupName", server1.DeleteFromConfigGroup))).Methods("DELETE")
+
+		r.Handle("/configGroup/{groupName}/{groupVersion}/{labels}", middleware2.RateLimit(limiter, authz.Require(model.ActionWrite, model.ResourceGroup, "groupName", server1.DeleteConfigsByLabels))).Methods("DELETE")
+		r.Handle("/configGroup/{groupName}/{groupVersion}/{labels}", middleware2.RateLimit(limiter, authz.Require(model.ActionRead, model.ResourceGroup, "groupName", server1.GetConfigsByLabels))).Methods("GET")
+	}
+	routes(router)
+	routes(router.PathPrefix("/ns/{namespace}").Subrouter())
 
-	router.Handle("/config/", middleware2.RateLimit(limiter, server.CreatePostHandler)).Methods("POST")
-	router.Handle("/config/{name}/{version}/", middleware2.RateLimit(limiter, server.Get)).Methods("GET")
-	router.Handle("/config/{name}/{version}/", middleware2.RateLimit(limiter, server.DelPostHandler)).Methods("DELETE")
-	router.Handle("/configGroup/", middleware2.RateLimit(limiter, server2.CreateConfigGroup)).Methods("POST")
-	router.Handle("/configGroup/{name}/{version}/", middleware2.RateLimit(limiter, server2.GetConfigGroup)).Methods("GET")
-	router.Handle("/configGroup/{name}/{version}/", middleware2.RateLimit(limiter, server2.DeleteConfigGroup)).Methods("DELETE")
-	router.Handle("/config/configGroup/{groupName}/{groupVersion}/", middleware2.RateLimit(limiter, server1.AddToConfigGroup)).Methods("POST")
-	router.Handle("/config/{name}/{groupName}/{groupVersion}/", middleware2.RateLimit(limiter, server1.DeleteFromConfigGroup)).Methods("DELETE")
-
-	router.Handle("/configGroup/{groupName}/{groupVersion}/{labels}", middleware2.RateLimit(limiter, server1.DeleteConfigsByLabels)).Methods("DELETE")
-	router.Handle("/configGroup/{groupName}/{groupVersion}/{labels}", middleware2.RateLimit(limiter, server1.GetConfigsByLabels)).Methods("GET")
+	router.Handle("/audit", middleware2.RateLimit(limiter, authz.Require(model.ActionAdmin, model.ResourceAudit, "", server3.GetAuditEvents))).Methods("GET")
 	//router.HandleFunc("/swagger.yaml", middleware2.SwaggerHandler).Methods("GET")
 	//router.PathPrefix("/").Handler(http.StripPrefix("/", http.FileServer(http.Dir("./"))))
 
@@ -162,62 +343,179 @@ func main() {
 
 	router.Handle("/metrics", metricsMiddleware.MetricsHandler()).Methods("GET")
 
+	// Health
+	var reloader *configuration.CertificateReloader
+	if cfg.TLS.Enabled() {
+		reloader, err = configuration.NewCertificateReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile)
+		if err != nil {
+			fatal("Failed to load TLS certificates", err)
+		}
+	}
+	consulRepoHealth := repositories.NewHealth(consul, keyspace, logger, tracer)
+	repoHealth := repositories.InstrumentHealthRepository(consulRepoHealth, "consul", storageMetrics)
+	repoHealth = repositories.ShareHealthRepository(repoHealth, cfg.Server.HealthTimeout)
+	healthService := services.NewHealthService(cfg.Server.HealthTimeout)
+	if cache != nil || snapshot != nil {
+		// Reads are served stale while Consul is down, so an outage degrades
+		// the replicas instead of taking all of them out of rotation.
+		healthService = healthService.
+			WithOptionalCheck("consul", repoHealth.CheckLeader).
+			WithOptionalCheck("storage", repoHealth.CheckReadWrite)
+	} else {
+		healthService = healthService.
+			WithCheck("consul", repoHealth.CheckLeader).
+			WithCheck("storage", repoHealth.CheckReadWrite)
+	}
+	healthService = healthService.WithOptionalCheck("tracing", exporterStatus.Check)
+	if secretService != nil {
+		healthService = healthService.WithCheck("secrets", secretService.Check)
+	}
+	if reloader != nil {
+		healthService = healthService.WithCheck("tls", reloader.Check)
+	}
+	healthHandler := handlers.NewHealthHandler(healthService)
+	router.HandleFunc("/healthz", healthHandler.Live).Methods("GET")
+	router.HandleFunc("/readyz", healthHandler.Ready).Methods("GET")
+	router.HandleFunc("/health", healthHandler.Health).Methods("GET")
+
 	// CORS
-	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "PUT", "POST", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"*"},
-		AllowCredentials: true,
-	})
+	corsHandler := cors.New(cfg.CORS.Options([]string{middleware2.RequestIDHeader, "Warning", middleware2.StaleSinceHeader}))
 
 	// start server
+	// Request contexts derive from baseCtx, which is cancelled once graceful
+	// shutdown gives up, so storage calls still in flight stop with it.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	srv := &http.Server{
-		Addr:    "0.0.0.0:" + port,
-		Handler: corsHandler.Handler(router),
+		Addr:              "0.0.0.0:" + cfg.Server.Port,
+		Handler:           corsHandler.Handler(router),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+
+	stopWatchers := make(chan struct{})
+	defer close(stopWatchers)
+	go inventory.Watch(cfg.InventoryInterval, stopWatchers)
+	if reloader != nil {
+		srv.TLSConfig, err = reloader.TLSConfig(cfg.TLS.ClientAuth)
+		if err != nil {
+			fatal("Invalid TLS configuration", err)
+		}
+		go reloader.Watch(cfg.TLS.ReloadInterval, stopWatchers)
 	}
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil {
+		var err error
+		if srv.TLSConfig != nil {
+			// Certificates come from TLSConfig.GetCertificate.
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
-				log.Fatal(err)
+				fatal("Server failed", err)
 			}
 		}
 	}()
 
 	<-quit
-	log.Println("Service shutting down...")
+	logger.Info("Service shutting down...")
 
 	// gracefully stop server
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal(err)
+	err = srv.Shutdown(ctx)
+	cancelRequests()
+	if err != nil {
+		fatal("Graceful shutdown failed", err)
 	}
-	log.Println("Server stopped")
+	logger.Info("Server stopped")
 }
 
-func newExporter(address string) (*jaeger.Exporter, error) {
-	exp, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(address)))
-	if err != nil {
-		return nil, err
+// consulOptions describes the Consul client shared by the repositories.
+func consulOptions(storage configuration.StorageConfiguration) repositories.ConsulOptions {
+	return repositories.ConsulOptions{
+		Address:    storage.Address(),
+		Token:      storage.Token,
+		TokenFile:  storage.TokenFile,
+		Datacenter: storage.Datacenter,
+		Namespace:  storage.Namespace,
+		Partition:  storage.Partition,
+		TLS: repositories.ConsulTLS{
+			Enabled:            storage.TLS.Enabled,
+			CAFile:             storage.TLS.CAFile,
+			CertFile:           storage.TLS.CertFile,
+			KeyFile:            storage.TLS.KeyFile,
+			ServerName:         storage.TLS.ServerName,
+			InsecureSkipVerify: storage.TLS.InsecureSkipVerify,
+		},
+		ConnectTimeout: storage.ConnectTimeout,
+		Timeouts: repositories.StorageTimeouts{
+			Read:  storage.ReadTimeout,
+			List:  storage.ListTimeout,
+			Write: storage.WriteTimeout,
+		},
+		Retry: repositories.RetryPolicy{
+			Attempts:  storage.Retry.Attempts,
+			BaseDelay: storage.Retry.BaseDelay,
+			MaxDelay:  storage.Retry.MaxDelay,
+		},
 	}
-	return exp, nil
 }
 
-func newTraceProvider(exp sdktrace.SpanExporter) *sdktrace.TracerProvider {
-	r, err := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("alati_projekat"),
-		),
-	)
-	if err != nil {
-		log.Fatalf("failed to create resource: %v", err)
+// startupRetryInterval is how often startup tasks that failed on a transient
+// error are retried.
+const startupRetryInterval = 10 * time.Second
+
+// instrumentationName is the scope of the service's own spans. The service
+// name is a resource attribute set by the tracer provider.
+const instrumentationName = "projekat"
+
+// runStartupTask runs task and, when it fails with a transient error, keeps
+// retrying it in the background until it succeeds or ctx is done. Errors
+// that permanent reports as such are fatal.
+func runStartupTask(ctx context.Context, name string, permanent func(error) bool, task func(ctx context.Context) error) {
+	err := task(ctx)
+	if err == nil {
+		return
+	}
+	if permanent(err) {
+		fatal(name+" failed", err)
 	}
+	slog.Warn(name+" failed, retrying in the background", "error", err)
+	go func() {
+		ticker := time.NewTicker(startupRetryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := task(ctx)
+			switch {
+			case err == nil:
+				slog.Info(name + " succeeded")
+				return
+			case permanent(err):
+				fatal(name+" failed", err)
+			default:
+				slog.Warn(name+" failed, retrying in the background", "error", err)
+			}
+		}
+	}()
+}
 
-	return sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exp),
-		sdktrace.WithResource(r),
-	)
+// fatal logs msg at error level and exits, like log.Fatal.
+func fatal(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, "error", err)
+	} else {
+		slog.Error(msg)
+	}
+	os.Exit(1)
 }
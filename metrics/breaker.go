@@ -0,0 +1,36 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Breaker metrics track the state of the storage circuit breaker.
+type Breaker struct {
+	State       prometheus.Gauge
+	Transitions *prometheus.CounterVec
+	Rejected    prometheus.Counter
+}
+
+func NewBreaker(registerer prometheus.Registerer) *Breaker {
+	m := &Breaker{
+		State: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "storage_circuit_state",
+				Help: "State of the storage circuit breaker: 0 closed, 1 half-open, 2 open.",
+			},
+		),
+		Transitions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "storage_circuit_transitions_total",
+				Help: "Storage circuit breaker state changes by the state entered.",
+			},
+			[]string{"state"},
+		),
+		Rejected: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "storage_circuit_rejected_total",
+				Help: "Consul calls refused without being sent because the circuit was open.",
+			},
+		),
+	}
+	registerer.MustRegister(m.State, m.Transitions, m.Rejected)
+	return m
+}
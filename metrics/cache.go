@@ -0,0 +1,54 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Cache metrics count cache lookups by repository ("config", "config_group")
+// and evictions by reason (size, invalidated).
+type Cache struct {
+	Hits      *prometheus.CounterVec
+	Misses    *prometheus.CounterVec
+	Bypasses  *prometheus.CounterVec
+	Evictions *prometheus.CounterVec
+	Entries   prometheus.Gauge
+}
+
+func NewCache(registerer prometheus.Registerer) *Cache {
+	m := &Cache{
+		Hits: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "storage_cache_hits_total",
+				Help: "Reads answered from the storage cache.",
+			},
+			[]string{"repository"},
+		),
+		Misses: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "storage_cache_misses_total",
+				Help: "Reads the storage cache had to pass to Consul.",
+			},
+			[]string{"repository"},
+		),
+		Bypasses: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "storage_cache_bypasses_total",
+				Help: "Reads that skipped the storage cache because of Cache-Control: no-cache.",
+			},
+			[]string{"repository"},
+		),
+		Evictions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "storage_cache_evictions_total",
+				Help: "Entries removed from the storage cache by reason (size, invalidated).",
+			},
+			[]string{"reason"},
+		),
+		Entries: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "storage_cache_entries",
+				Help: "Entries currently held by the storage cache.",
+			},
+		),
+	}
+	registerer.MustRegister(m.Hits, m.Misses, m.Bypasses, m.Evictions, m.Entries)
+	return m
+}
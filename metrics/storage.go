@@ -0,0 +1,46 @@
+// Package metrics defines the Prometheus collectors of the storage layer, so
+// the repositories that update them and the services that register them
+// share the types without depending on each other.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Storage metrics are shared by every instrumented repository. All of them are
+// labelled with the backend ("consul", "inmem", ...), the repository and the
+// operation, so storage latency can be told apart from handler latency.
+type Storage struct {
+	Duration    *prometheus.HistogramVec
+	Errors      *prometheus.CounterVec
+	PayloadSize *prometheus.HistogramVec
+}
+
+func NewStorage(registerer prometheus.Registerer) *Storage {
+	labels := []string{"backend", "repository", "operation"}
+	m := &Storage{
+		Duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "storage_operation_duration_seconds",
+				Help:    "Duration of repository operations.",
+				Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+			},
+			labels,
+		),
+		Errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "storage_operation_errors_total",
+				Help: "Failed repository operations by error type (not_found, timeout, canceled, unavailable, other).",
+			},
+			append(labels, "error_type"),
+		),
+		PayloadSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "storage_payload_size_bytes",
+				Help:    "JSON size of values written to or read from a repository, sampled per operation.",
+				Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+			},
+			labels,
+		),
+	}
+	registerer.MustRegister(m.Duration, m.Errors, m.PayloadSize)
+	return m
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"projekat/httperr"
+	"projekat/model"
+	"projekat/services"
+	"strings"
+)
+
+type Auth struct {
+	service     *services.AuthService
+	publicPaths []string
+}
+
+func NewAuth(service *services.AuthService, publicPaths []string) *Auth {
+	return &Auth{
+		service:     service,
+		publicPaths: publicPaths,
+	}
+}
+
+func (a *Auth) isPublic(path string) bool {
+	for _, public := range a.publicPaths {
+		if path == public || strings.HasPrefix(path, strings.TrimSuffix(public, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Auth) authenticate(r *http.Request) (*model.Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.service.AuthenticateAPIKey(key)
+	}
+
+	scheme, credentials, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found {
+		// Only chains verified against the client CA during the handshake count.
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			return a.service.AuthenticateCertificate(r.TLS.VerifiedChains[0][0])
+		}
+		return nil, services.ErrUnauthenticated
+	}
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		return a.service.AuthenticateBearer(strings.TrimSpace(credentials))
+	case "apikey":
+		return a.service.AuthenticateAPIKey(strings.TrimSpace(credentials))
+	default:
+		return nil, services.ErrUnauthenticated
+	}
+}
+
+func AdaptAuthHandler(handler http.Handler, auth *Auth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || auth.isPublic(r.URL.Path) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := auth.authenticate(r)
+		if err != nil {
+			if !errors.Is(err, services.ErrUnauthenticated) {
+				slog.ErrorContext(r.Context(), "Error authenticating request", "error", err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="config-api"`)
+			httperr.Write(w, r, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.String("enduser.id", principal.Subject),
+			attribute.String("enduser.auth_method", principal.Method),
+		)
+		handler.ServeHTTP(w, r.WithContext(model.ContextWithPrincipal(r.Context(), principal)))
+	})
+}
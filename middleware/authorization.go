@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"net/http"
+	"projekat/httperr"
+	"projekat/model"
+	"projekat/services"
+)
+
+type Authorization struct {
+	service *services.AuthorizationService
+	audit   *services.AuditService
+	// open is set when no policy is configured on purpose.
+	open bool
+}
+
+// NewAuthorization returns a middleware that enforces service. It panics on
+// a nil service, which can only be a wiring bug; use NewOpenAuthorization to
+// run without a policy.
+func NewAuthorization(service *services.AuthorizationService) *Authorization {
+	if service == nil {
+		panic("middleware: NewAuthorization called without an authorization service")
+	}
+	return &Authorization{service: service}
+}
+
+// NewOpenAuthorization returns a middleware for deployments without a policy.
+// Every request is let through, but secrets are never revealed.
+func NewOpenAuthorization() *Authorization {
+	return &Authorization{open: true}
+}
+
+// SetAudit records every denied request in the audit log.
+func (a *Authorization) SetAudit(audit *services.AuditService) {
+	a.audit = audit
+}
+
+// resourceName reads the resource name from the route variable nameVar or,
+// when nameVar is empty, from the "name" field of the JSON request body.
+func resourceName(r *http.Request, nameVar string) string {
+	if nameVar != "" {
+		return mux.Vars(r)[nameVar]
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return ""
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var named struct {
+		Name string `json:"name"`
+	}
+	_ = json.Unmarshal(body, &named)
+	return named.Name
+}
+
+// revealRequested reports whether the caller asked for decrypted secrets.
+func revealRequested(r *http.Request) bool {
+	return r.URL.Query().Get("reveal") == "true"
+}
+
+func (a *Authorization) Require(action string, resource string, nameVar string, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	if a == nil || (a.service == nil && !a.open) {
+		// Fail closed rather than hand out access nobody granted.
+		return func(w http.ResponseWriter, r *http.Request) {
+			slog.ErrorContext(r.Context(), "Authorization is not configured", "action", action, "resource", resource)
+			httperr.Write(w, r, "Authorization is not configured", http.StatusInternalServerError)
+		}
+	}
+	if a.open {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if revealRequested(r) {
+				httperr.Write(w, r, "Revealing secrets requires an authorization policy", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+		}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := model.PrincipalFromContext(r.Context())
+		name := resourceName(r, nameVar)
+		namespace := model.NamespaceFromContext(r.Context())
+
+		if !a.service.Authorize(principal, action, resource, name, namespace) {
+			a.deny(w, r, principal, action, resource, name)
+			return
+		}
+
+		if revealRequested(r) {
+			if !a.service.Authorize(principal, model.ActionReveal, resource, name, namespace) {
+				a.deny(w, r, principal, model.ActionReveal, resource, name)
+				return
+			}
+			r = r.WithContext(model.ContextWithReveal(r.Context()))
+		}
+
+		next(w, r)
+	}
+}
+
+func (a *Authorization) deny(w http.ResponseWriter, r *http.Request, principal *model.Principal, action string, resource string, name string) {
+	subject := services.AnonymousSubject
+	if principal != nil {
+		subject = principal.Subject
+	}
+	if err := a.audit.Record(model.AuditActionAccessDenied, services.AccessResource(resource, name, r.Context())+"#"+action, nil, nil, r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "Error recording denied request", "action", action, "resource", resource, "name", name, "subject", subject, "error", err)
+	}
+	trace.SpanFromContext(r.Context()).AddEvent("authorization.denied", trace.WithAttributes(
+		attribute.String("enduser.id", subject),
+		attribute.String("authz.action", action),
+		attribute.String("authz.resource", resource),
+		attribute.String("authz.name", name),
+	))
+
+	httperr.Write(w, r, "Permission denied", http.StatusForbidden)
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"projekat/model"
+	"strings"
+)
+
+// AdaptCacheControlHandler lets a caller skip the repository caches for one
+// request by sending Cache-Control: no-cache (or the HTTP/1.0 Pragma:
+// no-cache). The response is still stored, so the next cached read is fresh.
+func AdaptCacheControlHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasNoCache(r.Header.Values("Cache-Control")) || hasNoCache(r.Header.Values("Pragma")) {
+			r = r.WithContext(model.ContextWithCacheBypass(r.Context()))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func hasNoCache(values []string) bool {
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -3,25 +3,41 @@ package middleware
 import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"net/http"
+	"projekat/httperr"
 	"projekat/model"
 	"projekat/services"
 	"sync"
 )
 
 type Idempotency struct {
-	mux     sync.Mutex
-	service *services.IdempotencyService
-	Tracer  trace.Tracer
+	mux      sync.Mutex
+	service  *services.IdempotencyService
+	audit    *services.AuditService
+	required bool
+	Tracer   trace.Tracer
 }
 
 func NewIdempotency(idempotencyService *services.IdempotencyService, tracer trace.Tracer) *Idempotency {
 	return &Idempotency{
-		service: idempotencyService,
-		Tracer:  tracer,
+		service:  idempotencyService,
+		required: true,
+		Tracer:   tracer,
 	}
 }
 
+// SetAudit records every rejected replay of an already processed request.
+func (i *Idempotency) SetAudit(audit *services.AuditService) {
+	i.audit = audit
+}
+
+// SetRequired controls whether POST requests without an Idempotency-Key are
+// rejected. When they are not, they are served without replay protection.
+func (i *Idempotency) SetRequired(required bool) {
+	i.required = required
+}
+
 func AdaptIdempotencyHandler(handler http.Handler, idempotencyMiddleware *Idempotency) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -35,26 +51,37 @@ func AdaptIdempotencyHandler(handler http.Handler, idempotencyMiddleware *Idempo
 			newRequest := model.IdempotencyRequest{}
 			newRequest.SetKey(idempotencyKey)
 
+			if idempotencyKey == "" && !idempotencyMiddleware.required {
+				handler.ServeHTTP(w, r)
+				return
+			}
 			if idempotencyKey == "" {
 				span.SetStatus(codes.Unset, "Key missing")
-				http.Error(w, "Idempotency-Key header is missing", http.StatusBadRequest)
+				httperr.Write(w, r, "Idempotency-Key header is missing", http.StatusBadRequest)
 				return
 			}
 
 			processed, err := idempotencyMiddleware.service.Get(idempotencyKey, ctx)
 			if err != nil {
 				span.SetStatus(codes.Error, err.Error())
-				http.Error(w, "Error checking idempotency: "+err.Error(), http.StatusInternalServerError)
+				httperr.Write(w, r, "Error checking idempotency: "+err.Error(), httperr.Status(err, http.StatusInternalServerError))
 				return
 			}
 
-			if processed {
+			if processed != nil {
+				if err := idempotencyMiddleware.audit.Record(model.AuditActionIdempotentReplay, r.URL.Path, nil, nil, ctx); err != nil {
+					slog.ErrorContext(ctx, "Error recording idempotent replay", "error", err)
+				}
 				span.SetStatus(codes.Ok, "")
-				w.WriteHeader(http.StatusConflict)
-				w.Write([]byte("Request already sent."))
+				message := "Request already sent."
+				if processed.RequestID != "" {
+					message = "Request already sent as " + processed.RequestID + "."
+				}
+				httperr.Write(w, r, message, http.StatusConflict)
 				return
 			}
 
+			newRequest.RequestID = model.RequestIDFromContext(ctx)
 			idempotencyMiddleware.service.Add(&newRequest, ctx)
 			handler.ServeHTTP(w, r)
 			return
@@ -1,11 +1,13 @@
 package middleware
 
 import (
+	"context"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"log"
+	"log/slog"
 	"net/http"
 	"projekat/services"
+	"strconv"
 	"time"
 )
 
@@ -20,62 +22,91 @@ func NewMetrics(service *services.MetricsService) *Metrics {
 type ResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	size       int
 }
 
 func (r *ResponseWriter) WriteHeader(status int) {
-	log.Printf("Setting response status code to: %d", status)
 	r.statusCode = status
 	r.ResponseWriter.WriteHeader(status)
 }
 
+func (r *ResponseWriter) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// unresolvedNamespace labels requests answered before the namespace
+// middleware ran, such as unmatched routes and failed authentication.
+const unresolvedNamespace = "none"
+
+type metricsNamespaceKey struct{}
+
+// labelNamespace tells Count, which runs before the namespace is known, which
+// namespace the request was served in.
+func labelNamespace(ctx context.Context, namespace string) {
+	if label, ok := ctx.Value(metricsNamespaceKey{}).(*string); ok {
+		*label = namespace
+	}
+}
+
+// Count records the request metrics. It runs ahead of the other middleware,
+// so responses they write are counted too.
 func (m *Metrics) Count(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Request received for:", r.URL.Path)
+		namespace := unresolvedNamespace
+		r = r.WithContext(context.WithValue(r.Context(), metricsNamespaceKey{}, &namespace))
+		ctx := r.Context()
+		slog.DebugContext(ctx, "Request received", "method", r.Method, "path", r.URL.Path)
 		start := time.Now()
 
-		route := mux.CurrentRoute(r)
-		if route == nil {
-			log.Println("No current route found for request")
+		path := "unmatched"
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				path = template
+			} else {
+				slog.DebugContext(ctx, "Error getting path template", "error", err)
+			}
 		}
 
-		path, err := route.GetPathTemplate()
-		if err != nil {
-			log.Printf("Error getting path template: %v", err)
-		}
-		log.Printf("Path template: %s", path)
+		inFlight := m.service.HttpRequestsInFlight.WithLabelValues(r.Method, path)
+		inFlight.Inc()
+		defer inFlight.Dec()
 
-		rw := &ResponseWriter{w, http.StatusOK}
+		rw := &ResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(rw, r)
 
 		duration := time.Since(start).Seconds()
-		log.Printf("Processed request for %s in %f seconds", path, duration)
-
 		statusCode := rw.statusCode
-		log.Printf("Response status code: %d", statusCode)
+		slog.InfoContext(ctx, "Request processed", "method", r.Method, "path", r.URL.Path, "status", statusCode, "duration", duration)
 
+		status := strconv.Itoa(statusCode)
+		m.service.HttpRequests.WithLabelValues(r.Method, path, namespace, status).Inc()
+		m.service.HttpRequestDuration.WithLabelValues(r.Method, path, namespace, status).Observe(duration)
+		requestSize := r.ContentLength
+		if requestSize < 0 {
+			requestSize = 0
+		}
+		m.service.HttpRequestSize.WithLabelValues(r.Method, path, namespace, status).Observe(float64(requestSize))
+		m.service.HttpResponseSize.WithLabelValues(r.Method, path, namespace, status).Observe(float64(rw.size))
+
+		// Deprecated aliases, kept until dashboards move to the metrics above.
 		if statusCode >= 200 && statusCode < 400 {
 			m.service.HttpSuccessfulRequests.WithLabelValues().Inc()
-			log.Println("Incremented successful requests counter")
 		} else if statusCode >= 400 && statusCode < 600 {
 			m.service.HttpUnsuccessfulRequests.WithLabelValues().Inc()
-			log.Println("Incremented unsuccessful requests counter")
 		}
-
 		m.service.HttpTotalRequests.WithLabelValues().Inc()
-		log.Println("Incremented total requests counter")
 		m.service.AverageRequestDuration.WithLabelValues(r.Method, path).Set(duration)
-		log.Printf("Set average request duration for %s %s", r.Method, path)
 		m.service.RequestsPerTimeUnit.WithLabelValues(r.Method, path, "seconds").Inc()
-		log.Printf("Incremented requests per time unit for %s %s", r.Method, path)
+		slog.DebugContext(ctx, "Updated request metrics", "method", r.Method, "route", path, "namespace", namespace, "status", status)
 	})
 }
 
 func (m *Metrics) MetricsHandler() http.Handler {
-	log.Println("Metrics handler invoked")
 	return promhttp.HandlerFor(m.service.Registry, promhttp.HandlerOpts{})
 }
 
 func AdaptPrometheusHandler(handler http.Handler, metrics *Metrics) http.Handler {
-	log.Println("Adapting handler with Prometheus metrics")
 	return metrics.Count(handler)
 }
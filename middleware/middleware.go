@@ -1,38 +1,27 @@
 package middleware
 
 import (
-	"encoding/json"
-	"golang.org/x/time/rate"
 	"net/http"
+	"projekat/httperr"
+	"projekat/services"
 )
 
-func RateLimit(limiter *rate.Limiter, next func(w http.ResponseWriter, r *http.Request)) http.Handler {
+// rateLimitBucket is shared by every route, so all endpoints draw from the
+// same budget across replicas.
+const rateLimitBucket = "global"
+
+func RateLimit(limiter *services.RateLimitService, next func(w http.ResponseWriter, r *http.Request)) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !limiter.Allow() {
-			message := map[string]string{
-				"message": "Rate limit exceeded, try again later!",
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusTooManyRequests)
-			err := json.NewEncoder(w).Encode(message)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			}
+		if !limiter.Allow(rateLimitBucket, r.Context()) {
+			httperr.Write(w, r, "Rate limit exceeded, try again later!", http.StatusTooManyRequests)
 		} else {
 			next(w, r)
 		}
 	})
 }
 
+// SwaggerHandler serves the API spec. CORS headers come from the CORS handler
+// wrapping the router, like for every other route.
 func SwaggerHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS, DELETE, POST, PUT")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key, Allow")
-
-	// Handle preflight requests
-	if r.Method == "OPTIONS" {
-		return
-	}
-
 	http.ServeFile(w, r, "./swagger.yaml")
 }
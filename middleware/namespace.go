@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"projekat/httperr"
+	"projekat/model"
+	"projekat/services"
+)
+
+type Namespaces struct {
+	service services.NamespaceService
+}
+
+func NewNamespaces(service services.NamespaceService) *Namespaces {
+	return &Namespaces{service}
+}
+
+// AdaptNamespaceHandler puts the {namespace} route variable, or the default
+// namespace for un-prefixed routes, into the request context. Requests for a
+// namespace that was never created get a 404; any other lookup failure means
+// the namespace cannot be checked and gets a 503.
+func AdaptNamespaceHandler(handler http.Handler, namespaces *Namespaces) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace, ok := mux.Vars(r)["namespace"]
+		if !ok {
+			namespace = model.DefaultNamespace
+		}
+
+		if namespace != model.DefaultNamespace {
+			if _, err := namespaces.service.GetNamespace(namespace, r.Context()); err != nil {
+				if errors.Is(err, services.ErrNamespaceNotFound) {
+					httperr.Write(w, r, "Namespace not found", http.StatusNotFound)
+				} else {
+					httperr.Write(w, r, "Failed to look up namespace", httperr.Status(err, http.StatusServiceUnavailable))
+				}
+				return
+			}
+		}
+
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("config.namespace", namespace))
+		labelNamespace(r.Context(), namespace)
+		handler.ServeHTTP(w, r.WithContext(model.ContextWithNamespace(r.Context(), namespace)))
+	})
+}
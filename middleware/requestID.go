@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"projekat/model"
+	"regexp"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits caller supplied IDs to what is safe to log and echo.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// AdaptRequestIDHandler puts the caller's X-Request-ID, or a generated one,
+// and the matched route template into the request context so every log line,
+// audit event and idempotency key of the request can be correlated. The ID is
+// attached to the request span and echoed in the response header and in error
+// bodies.
+func AdaptRequestIDHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.request_id", requestID))
+
+		ctx := model.ContextWithRequestID(r.Context(), requestID)
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				ctx = model.ContextWithRoute(ctx, template)
+			}
+		}
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
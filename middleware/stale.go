@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"projekat/model"
+	"time"
+)
+
+// StaleSinceHeader carries when the data of a stale response was last read
+// from storage.
+const StaleSinceHeader = "X-Config-Stale-Since"
+
+// AdaptStaleHandler marks responses built from cached or snapshot data while
+// storage was unavailable with a Warning: 110 header and StaleSinceHeader.
+func AdaptStaleHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, staleness := model.ContextWithStaleness(r.Context())
+		handler.ServeHTTP(&staleResponseWriter{ResponseWriter: w, staleness: staleness}, r.WithContext(ctx))
+	})
+}
+
+// staleResponseWriter adds the headers just before they are sent, once the
+// handler has read its data.
+type staleResponseWriter struct {
+	http.ResponseWriter
+	staleness   *model.Staleness
+	wroteHeader bool
+}
+
+func (w *staleResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if since := w.staleness.Since(); !since.IsZero() {
+			w.Header().Set("Warning", `110 - "Response is Stale"`)
+			w.Header().Set(StaleSinceHeader, since.UTC().Format(time.RFC3339))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *staleResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	AuditActionCreate            = "create"
+	AuditActionDelete            = "delete"
+	AuditActionGroupMemberAdd    = "group_member_add"
+	AuditActionGroupMemberDelete = "group_member_delete"
+	AuditActionLabelDelete       = "label_delete"
+	AuditActionIdempotentReplay  = "idempotent_replay"
+	AuditActionAccessDenied      = "access_denied"
+)
+
+// AuditEvent is one link of the audit hash chain. Hash covers every other
+// field, including PrevHash, so altering or removing an event breaks the chain.
+type AuditEvent struct {
+	Sequence   uint64    `json:"sequence"`
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	Resource   string    `json:"resource"`
+	RequestID  string    `json:"requestId,omitempty"`
+	TraceID    string    `json:"traceId,omitempty"`
+	BeforeHash string    `json:"beforeHash,omitempty"`
+	AfterHash  string    `json:"afterHash,omitempty"`
+	PrevHash   string    `json:"prevHash"`
+	Hash       string    `json:"hash"`
+}
+
+// AuditHead points at the last event of the chain.
+type AuditHead struct {
+	Sequence uint64 `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+type AuditRepository interface {
+	// GetHead returns the current head and its modify index, which is 0 while
+	// the chain is empty.
+	GetHead(ctx context.Context) (*AuditHead, uint64, error)
+	// Append stores event and advances the head to it, provided the head was
+	// not modified since headIndex. It returns false if another writer won.
+	Append(event *AuditEvent, headIndex uint64, ctx context.Context) (bool, error)
+	// ListEvents returns all events ordered by sequence.
+	ListEvents(ctx context.Context) ([]AuditEvent, error)
+	// ListEventRange returns the events with a sequence number from first to
+	// last, ordered by sequence. It reads only those events.
+	ListEventRange(first uint64, last uint64, ctx context.Context) ([]AuditEvent, error)
+}
@@ -0,0 +1,16 @@
+package model
+
+import "context"
+
+type cacheBypassKey struct{}
+
+// ContextWithCacheBypass marks a request that asked for fresh data with
+// Cache-Control: no-cache, so repository caches read through to storage.
+func ContextWithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+func CacheBypassFromContext(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
@@ -15,6 +15,10 @@ type ConfigForGroup struct {
 	// Parameters of the ConfigForGroup
 	// in: map[string]string
 	Parameters map[string]string `json:"parameters"`
+
+	// Names of the parameters that are stored encrypted
+	// in: []string
+	Secrets []string `json:"secrets,omitempty"`
 }
 
 func NewConfigForGroup(name string, labels map[string]string, parameters map[string]string) *ConfigForGroup {
@@ -15,6 +15,10 @@ type ConfigGroup struct {
 	// Configurations of the ConfigGroup
 	// in: []ConfigForGroup
 	Configurations []ConfigForGroup `json:"configurations"`
+
+	// Subject of the principal that created the ConfigGroup, empty when anonymous
+	// in: string
+	Owner string `json:"owner,omitempty"`
 }
 
 func NewConfigGroup(name string, version float32, configurations []ConfigForGroup) *ConfigGroup {
@@ -29,4 +33,5 @@ type ConfigGroupRepository interface {
 	GetConfigGroup(name string, version float32, ctx context.Context) (*ConfigGroup, error)
 	AddConfigGroup(configGroup *ConfigGroup, ctx context.Context) error
 	DeleteConfigGroup(name string, version float32, ctx context.Context) error
+	ListConfigGroups(ctx context.Context) ([]ConfigGroup, error)
 }
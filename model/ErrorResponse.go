@@ -0,0 +1,17 @@
+package model
+
+// ErrorResponse is the JSON body of every error response. RequestID lets a
+// client quote the request when reporting a problem.
+type ErrorResponse struct {
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+	// Quota is set when a write was rejected by a quota.
+	Quota *QuotaExceeded `json:"quota,omitempty"`
+}
+
+// QuotaExceeded names the limit a rejected write would have exceeded.
+type QuotaExceeded struct {
+	Limit     string `json:"limit"`
+	Max       int64  `json:"max"`
+	Requested int64  `json:"requested"`
+}
@@ -0,0 +1,11 @@
+package model
+
+import "context"
+
+// HealthRepository probes the storage backend on behalf of readiness checks.
+type HealthRepository interface {
+	// CheckLeader fails when the backend has no reachable leader.
+	CheckLeader(ctx context.Context) error
+	// CheckReadWrite writes a probe value and reads it back.
+	CheckReadWrite(ctx context.Context) error
+}
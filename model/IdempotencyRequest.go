@@ -4,6 +4,8 @@ import "context"
 
 type IdempotencyRequest struct {
 	Key string `json:"key"`
+	// RequestID of the request that first used the key
+	RequestID string `json:"requestId,omitempty"`
 }
 
 func (i *IdempotencyRequest) SetKey(key string) {
@@ -11,6 +13,7 @@ func (i *IdempotencyRequest) SetKey(key string) {
 }
 
 type IdempotencyRepository interface {
-	Add(i *IdempotencyRequest, ctx context.Context) error
-	Get(key string, ctx context.Context) (bool, error)
+	AddIdempotencyRequest(req *IdempotencyRequest, ctx context.Context) (*IdempotencyRequest, error)
+	// GetIdempotencyRequestByKey returns nil if the key was never used.
+	GetIdempotencyRequestByKey(key string, ctx context.Context) (*IdempotencyRequest, error)
 }
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"context"
+	"regexp"
+)
+
+// DefaultNamespace holds everything created through the routes without a
+// /ns/{namespace} prefix. Its keys keep the original un-prefixed layout.
+const DefaultNamespace = "default"
+
+var namespaceNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// swagger:model Namespace
+type Namespace struct {
+	// Name of the Namespace
+	// in: string
+	Name string `json:"name"`
+
+	// Description of the Namespace
+	// in: string
+	Description string `json:"description,omitempty"`
+
+	// Quota of the Namespace, zero values mean unlimited
+	// in: Quota
+	Quota Quota `json:"quota"`
+}
+
+// Quota limits what can be stored in a namespace. A zero field is unlimited.
+type Quota struct {
+	MaxConfigs            int   `json:"maxConfigs,omitempty" yaml:"maxConfigs"`
+	MaxVersionsPerConfig  int   `json:"maxVersionsPerConfig,omitempty" yaml:"maxVersionsPerConfig"`
+	MaxGroups             int   `json:"maxGroups,omitempty" yaml:"maxGroups"`
+	MaxMembersPerGroup    int   `json:"maxMembersPerGroup,omitempty" yaml:"maxMembersPerGroup"`
+	MaxParametersPerEntry int   `json:"maxParametersPerEntry,omitempty" yaml:"maxParametersPerEntry"`
+	MaxTotalBytes         int64 `json:"maxTotalBytes,omitempty" yaml:"maxTotalBytes"`
+}
+
+func ValidNamespaceName(name string) bool {
+	return namespaceNamePattern.MatchString(name)
+}
+
+type NamespaceRepository interface {
+	GetNamespace(name string, ctx context.Context) (*Namespace, error)
+	ListNamespaces(ctx context.Context) ([]Namespace, error)
+	AddNamespace(namespace *Namespace, ctx context.Context) error
+	DeleteNamespace(name string, ctx context.Context) error
+	// IsNamespaceEmpty reports whether no configs or groups are stored under it.
+	IsNamespaceEmpty(name string, ctx context.Context) (bool, error)
+}
+
+type namespaceKey struct{}
+
+func ContextWithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+func NamespaceFromContext(ctx context.Context) string {
+	if namespace, ok := ctx.Value(namespaceKey{}).(string); ok && namespace != "" {
+		return namespace
+	}
+	return DefaultNamespace
+}
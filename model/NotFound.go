@@ -0,0 +1,7 @@
+package model
+
+import "errors"
+
+// ErrNotFound is matched by the errors repositories return for an entry that
+// does not exist, so callers can tell it apart from a storage failure.
+var ErrNotFound = errors.New("not found")
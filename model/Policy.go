@@ -0,0 +1,42 @@
+package model
+
+const (
+	ActionRead   = "read"
+	ActionWrite  = "write"
+	ActionDelete = "delete"
+	ActionAdmin  = "admin"
+	ActionReveal = "reveal"
+
+	ResourceConfig    = "config"
+	ResourceGroup     = "group"
+	ResourceAudit     = "audit"
+	ResourceNamespace = "namespace"
+)
+
+// Permission grants actions on every resource of the given type whose name
+// matches one of the Names glob patterns, in every namespace matching one of
+// the Namespaces patterns. Without Namespaces only the default namespace is
+// covered.
+type Permission struct {
+	Resource   string   `yaml:"resource" json:"resource"`
+	Names      []string `yaml:"names" json:"names"`
+	Namespaces []string `yaml:"namespaces" json:"namespaces"`
+	Actions    []string `yaml:"actions" json:"actions"`
+}
+
+type Role struct {
+	Name        string       `yaml:"name" json:"name"`
+	Permissions []Permission `yaml:"permissions" json:"permissions"`
+}
+
+// RoleBinding assigns roles to principals by subject, in addition to the roles
+// carried by the principal's credentials.
+type RoleBinding struct {
+	Subjects []string `yaml:"subjects" json:"subjects"`
+	Roles    []string `yaml:"roles" json:"roles"`
+}
+
+type Policy struct {
+	Roles    []Role        `yaml:"roles" json:"roles"`
+	Bindings []RoleBinding `yaml:"bindings" json:"bindings"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import "context"
+
+const (
+	AuthMethodAPIKey = "api_key"
+	AuthMethodJWT    = "jwt"
+	AuthMethodMTLS   = "mtls"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string   `json:"subject"`
+	Method  string   `json:"method"`
+	Roles   []string `json:"roles,omitempty"`
+}
+
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// SubjectFromContext returns the subject of the authenticated caller, or the
+// empty string for anonymous requests.
+func SubjectFromContext(ctx context.Context) string {
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		return principal.Subject
+	}
+	return ""
+}
+
+type revealKey struct{}
+
+// ContextWithReveal marks that the caller asked for, and is allowed to see,
+// decrypted secret parameters.
+func ContextWithReveal(ctx context.Context) context.Context {
+	return context.WithValue(ctx, revealKey{}, true)
+}
+
+func RevealFromContext(ctx context.Context) bool {
+	reveal, _ := ctx.Value(revealKey{}).(bool)
+	return reveal
+}
@@ -0,0 +1,9 @@
+package model
+
+import "context"
+
+type RateLimitRepository interface {
+	GetCounter(key string, ctx context.Context) (count uint64, index uint64, err error)
+	SetCounter(key string, count uint64, index uint64, ctx context.Context) (bool, error)
+	DeleteCounter(key string, ctx context.Context) error
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// MaskedValue replaces secret parameter values wherever they would otherwise
+// leave the service in clear text.
+const MaskedValue = "******"
+
+// DefaultSecretPatterns are the parameter name patterns treated as secret when
+// REDACT_PATTERNS is not set. Patterns use path.Match syntax and are matched
+// case-insensitively.
+var DefaultSecretPatterns = []string{
+	"*password*", "*passwd*", "*secret*", "*token*", "*credential*",
+	"*apikey*", "*api_key*", "*api-key*", "*private_key*", "*privatekey*",
+}
+
+var (
+	secretPatternsMu sync.RWMutex
+	secretPatterns   = DefaultSecretPatterns
+)
+
+// SetSecretPatterns replaces the parameter name patterns used for redaction.
+func SetSecretPatterns(patterns []string) error {
+	lowered := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid secret pattern %q: %w", pattern, err)
+		}
+		lowered[i] = strings.ToLower(pattern)
+	}
+	secretPatternsMu.Lock()
+	secretPatterns = lowered
+	secretPatternsMu.Unlock()
+	return nil
+}
+
+// IsSecretParameter reports whether the parameter is flagged as secret
+// explicitly or its name matches one of the secret patterns.
+func IsSecretParameter(name string, secrets []string) bool {
+	for _, secret := range secrets {
+		if secret == name {
+			return true
+		}
+	}
+	lowered := strings.ToLower(name)
+	secretPatternsMu.RLock()
+	defer secretPatternsMu.RUnlock()
+	for _, pattern := range secretPatterns {
+		if matched, _ := path.Match(pattern, lowered); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactParameters returns a copy of parameters with every secret value
+// replaced by MaskedValue.
+func RedactParameters(parameters map[string]string, secrets []string) map[string]string {
+	if parameters == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(parameters))
+	for name, value := range parameters {
+		if IsSecretParameter(name, secrets) {
+			value = MaskedValue
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
+
+// Redacted returns a copy of the config that is safe to log or return to a
+// caller without reveal access.
+func (c *Config) Redacted() *Config {
+	if c == nil {
+		return nil
+	}
+	redacted := *c
+	redacted.Parameters = RedactParameters(c.Parameters, c.Secrets)
+	return &redacted
+}
+
+func (c *ConfigForGroup) Redacted() *ConfigForGroup {
+	if c == nil {
+		return nil
+	}
+	redacted := *c
+	redacted.Parameters = RedactParameters(c.Parameters, c.Secrets)
+	return &redacted
+}
+
+func (g *ConfigGroup) Redacted() *ConfigGroup {
+	if g == nil {
+		return nil
+	}
+	redacted := *g
+	if g.Configurations != nil {
+		redacted.Configurations = make([]ConfigForGroup, len(g.Configurations))
+		for i := range g.Configurations {
+			redacted.Configurations[i] = *g.Configurations[i].Redacted()
+		}
+	}
+	return &redacted
+}
@@ -0,0 +1,16 @@
+package model
+
+import "context"
+
+type routeKey struct{}
+
+// ContextWithRoute records the path template of the matched route, such as
+// /config/{name}/{version}/.
+func ContextWithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+func RouteFromContext(ctx context.Context) string {
+	route, _ := ctx.Value(routeKey{}).(string)
+	return route
+}
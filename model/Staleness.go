@@ -0,0 +1,48 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrStorageUnavailable is returned without calling storage while its
+// circuit breaker is open.
+var ErrStorageUnavailable = errors.New("storage unavailable: circuit breaker is open")
+
+// Staleness records that a response was built from data that could not be
+// checked against storage, and how old that data is.
+type Staleness struct {
+	mu    sync.Mutex
+	since time.Time
+}
+
+type stalenessKey struct{}
+
+func ContextWithStaleness(ctx context.Context) (context.Context, *Staleness) {
+	staleness := &Staleness{}
+	return context.WithValue(ctx, stalenessKey{}, staleness), staleness
+}
+
+// MarkStale records that the request was served data last read from storage
+// at since. The oldest time wins when several reads were stale.
+func MarkStale(ctx context.Context, since time.Time) {
+	staleness, ok := ctx.Value(stalenessKey{}).(*Staleness)
+	if !ok {
+		return
+	}
+	staleness.mu.Lock()
+	defer staleness.mu.Unlock()
+	if staleness.since.IsZero() || since.Before(staleness.since) {
+		staleness.since = since
+	}
+}
+
+// Since returns when the stale data was read, or the zero time if the
+// request was served fresh data.
+func (s *Staleness) Since() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.since
+}
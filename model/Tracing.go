@@ -0,0 +1,50 @@
+package model
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"sort"
+	"strings"
+)
+
+// Span attribute keys shared by handler, service and repository spans.
+const (
+	AttrNamespace     = attribute.Key("config.namespace")
+	AttrConfigName    = attribute.Key("config.name")
+	AttrConfigVersion = attribute.Key("config.version")
+	AttrGroupName     = attribute.Key("config_group.name")
+	AttrGroupVersion  = attribute.Key("config_group.version")
+	AttrLabels        = attribute.Key("config_group.labels")
+	AttrResultCount   = attribute.Key("db.result_count")
+	AttrStorageKey    = attribute.Key("db.consul.key")
+	AttrValueSize     = attribute.Key("db.consul.value_size")
+)
+
+// ConfigAttributes identifies a config version in the namespace of ctx.
+func ConfigAttributes(ctx context.Context, name string, version float32) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		AttrNamespace.String(NamespaceFromContext(ctx)),
+		AttrConfigName.String(name),
+		AttrConfigVersion.Float64(float64(version)),
+	}
+}
+
+// GroupAttributes identifies a config group version in the namespace of ctx.
+func GroupAttributes(ctx context.Context, name string, version float32) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		AttrNamespace.String(NamespaceFromContext(ctx)),
+		AttrGroupName.String(name),
+		AttrGroupVersion.Float64(float64(version)),
+	}
+}
+
+// LabelsAttribute renders labels as sorted key:value pairs so equal selectors
+// always produce the same attribute.
+func LabelsAttribute(labels map[string]string) attribute.KeyValue {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+":"+value)
+	}
+	sort.Strings(pairs)
+	return AttrLabels.String(strings.Join(pairs, ";"))
+}
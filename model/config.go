@@ -15,6 +15,14 @@ type Config struct {
 	// Parameters of the Config
 	// in: map[string]string
 	Parameters map[string]string `json:"parameters"`
+
+	// Names of the parameters that are stored encrypted
+	// in: []string
+	Secrets []string `json:"secrets,omitempty"`
+
+	// Subject of the principal that created the Config, empty when anonymous
+	// in: string
+	Owner string `json:"owner,omitempty"`
 }
 
 func NewConfig(name string, version float32, parameters map[string]string) *Config {
@@ -29,4 +37,5 @@ type ConfigRepository interface {
 	GetConfig(name string, version float32, ctx context.Context) (*Config, error)
 	AddConfig(config *Config, ctx context.Context) error
 	DeleteConfig(name string, version float32, ctx context.Context) error
+	ListConfigs(ctx context.Context) ([]Config, error)
 }
@@ -43,3 +43,13 @@ func (m *MockConfigRepository) DeleteConfigGroup(name string, version float32, c
 	args := m.Called(ctx, name, version)
 	return args.Error(0)
 }
+
+func (m *MockConfigRepository) ListConfigs(ctx context.Context) ([]model.Config, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.Config), args.Error(1)
+}
+
+func (m *MockConfigRepository) ListConfigGroups(ctx context.Context) ([]model.ConfigGroup, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.ConfigGroup), args.Error(1)
+}
@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/consul/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"projekat/model"
+)
+
+type AuditConsulRepository struct {
+	cli    *api.Client
+	keys   Keyspace
+	logger *slog.Logger
+	Tracer trace.Tracer
+}
+
+func NewAudit(client *api.Client, keys Keyspace, logger *slog.Logger, tracer trace.Tracer) *AuditConsulRepository {
+	return &AuditConsulRepository{cli: client, keys: keys, logger: logger, Tracer: tracer}
+}
+
+func (a AuditConsulRepository) GetHead(ctx context.Context) (*model.AuditHead, uint64, error) {
+	ctx, span := a.Tracer.Start(ctx, "AuditConsulRepository.GetHead", storageAttributes("get", model.AttrStorageKey.String(a.keys.key(auditHead))))
+	defer span.End()
+
+	pair, _, err := a.cli.KV().Get(a.keys.key(auditHead), queryOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, 0, err
+	}
+	if pair == nil {
+		span.SetStatus(codes.Ok, "Audit log is empty")
+		return &model.AuditHead{}, 0, nil
+	}
+
+	span.SetAttributes(model.AttrValueSize.Int(len(pair.Value)))
+	head := &model.AuditHead{}
+	if err := json.Unmarshal(pair.Value, head); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, 0, err
+	}
+
+	span.SetStatus(codes.Ok, "Success")
+	return head, pair.ModifyIndex, nil
+}
+
+// Append writes the event and the new head in one Consul transaction, with a
+// check-and-set on the head so concurrent writers cannot fork the chain.
+func (a AuditConsulRepository) Append(event *model.AuditEvent, headIndex uint64, ctx context.Context) (bool, error) {
+	ctx, span := a.Tracer.Start(ctx, "AuditConsulRepository.Append", storageAttributes("txn", attribute.Int64("audit.sequence", int64(event.Sequence))))
+	defer span.End()
+
+	eventData, err := json.Marshal(event)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+	headData, err := json.Marshal(model.AuditHead{Sequence: event.Sequence, Hash: event.Hash})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+
+	span.SetAttributes(
+		model.AttrStorageKey.String(a.keys.constructAuditEventKey(event.Sequence)),
+		model.AttrValueSize.Int(len(eventData)+len(headData)),
+	)
+	ops := api.KVTxnOps{
+		&api.KVTxnOp{Verb: api.KVCAS, Key: a.keys.key(auditHead), Value: headData, Index: headIndex},
+		&api.KVTxnOp{Verb: api.KVCAS, Key: a.keys.constructAuditEventKey(event.Sequence), Value: eventData, Index: 0},
+	}
+	ok, _, _, err := a.cli.KV().Txn(ops, queryOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+
+	span.SetStatus(codes.Ok, "Success")
+	return ok, nil
+}
+
+func (a AuditConsulRepository) ListEvents(ctx context.Context) ([]model.AuditEvent, error) {
+	ctx, span := a.Tracer.Start(ctx, "AuditConsulRepository.ListEvents", storageAttributes("list", model.AttrStorageKey.String(a.keys.key(auditEventsPrefix))))
+	defer span.End()
+
+	// Keys are zero-padded sequence numbers, so Consul returns them in order.
+	pairs, _, err := a.cli.KV().List(a.keys.key(auditEventsPrefix), queryOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	events := make([]model.AuditEvent, 0, len(pairs))
+	for _, pair := range pairs {
+		var event model.AuditEvent
+		if err := json.Unmarshal(pair.Value, &event); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("audit event %s: %w", pair.Key, err)
+		}
+		events = append(events, event)
+	}
+
+	span.SetAttributes(model.AttrResultCount.Int(len(events)))
+	span.SetStatus(codes.Ok, "Success")
+	return events, nil
+}
+
+// ListEventRange reads the events by key in transactions, as sequence numbers
+// are contiguous, instead of listing the whole log.
+func (a AuditConsulRepository) ListEventRange(first uint64, last uint64, ctx context.Context) ([]model.AuditEvent, error) {
+	ctx, span := a.Tracer.Start(ctx, "AuditConsulRepository.ListEventRange", storageAttributes("txn",
+		attribute.Int64("audit.first", int64(first)),
+		attribute.Int64("audit.last", int64(last)),
+	))
+	defer span.End()
+
+	var events []model.AuditEvent
+	for start := max(first, 1); start <= last; start += maxTxnOps {
+		end := min(last, start+maxTxnOps-1)
+		ops := make(api.KVTxnOps, 0, end-start+1)
+		for sequence := start; sequence <= end; sequence++ {
+			ops = append(ops, &api.KVTxnOp{Verb: api.KVGetOrEmpty, Key: a.keys.constructAuditEventKey(sequence)})
+		}
+		ok, response, _, err := a.cli.KV().Txn(ops, queryOptions(ctx))
+		if err == nil && !ok {
+			err = txnError(ops, response)
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		for _, pair := range response.Results {
+			// Missing events come back without a value.
+			if pair == nil || len(pair.Value) == 0 {
+				continue
+			}
+			var event model.AuditEvent
+			if err := json.Unmarshal(pair.Value, &event); err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return nil, fmt.Errorf("audit event %s: %w", pair.Key, err)
+			}
+			events = append(events, event)
+		}
+	}
+
+	span.SetAttributes(model.AttrResultCount.Int(len(events)))
+	span.SetStatus(codes.Ok, "Success")
+	return events, nil
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+	"projekat/model"
+	"sync"
+)
+
+type AuditInMemRepository struct {
+	mux       sync.Mutex
+	Events    []model.AuditEvent
+	head      model.AuditHead
+	headIndex uint64
+}
+
+func (a *AuditInMemRepository) GetHead(ctx context.Context) (*model.AuditHead, uint64, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	head := a.head
+	return &head, a.headIndex, nil
+}
+
+func (a *AuditInMemRepository) Append(event *model.AuditEvent, headIndex uint64, ctx context.Context) (bool, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if headIndex != a.headIndex {
+		return false, nil
+	}
+	a.Events = append(a.Events, *event)
+	a.head = model.AuditHead{Sequence: event.Sequence, Hash: event.Hash}
+	a.headIndex++
+	return true, nil
+}
+
+func (a *AuditInMemRepository) ListEvents(ctx context.Context) ([]model.AuditEvent, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	events := make([]model.AuditEvent, len(a.Events))
+	copy(events, a.Events)
+	return events, nil
+}
+
+func (a *AuditInMemRepository) ListEventRange(first uint64, last uint64, ctx context.Context) ([]model.AuditEvent, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	var events []model.AuditEvent
+	for _, event := range a.Events {
+		if event.Sequence >= first && event.Sequence <= last {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func NewAuditInMemRepository() *AuditInMemRepository {
+	return &AuditInMemRepository{}
+}
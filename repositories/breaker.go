@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"projekat/metrics"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states, also the values of the storage_circuit_state gauge.
+const (
+	CircuitClosed = iota
+	CircuitHalfOpen
+	CircuitOpen
+)
+
+var circuitStateNames = map[int]string{
+	CircuitClosed:   "closed",
+	CircuitHalfOpen: "half_open",
+	CircuitOpen:     "open",
+}
+
+// BreakerOptions configure the circuit breaker: it opens after
+// FailureThreshold consecutive failed Consul calls and lets one trial call
+// through once OpenTimeout has passed.
+type BreakerOptions struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+// CircuitBreaker stops Consul calls after repeated failures so requests fail
+// fast, or are served stale data, instead of waiting on every timeout.
+type CircuitBreaker struct {
+	options BreakerOptions
+	metrics *metrics.Breaker
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	// probing is set while the single half-open trial call is in flight.
+	probing bool
+	// generation changes with every state change. Calls are tagged with the
+	// generation they were let through in, so a slow call from an earlier
+	// state cannot close, open or free the trial slot of the current one.
+	generation uint64
+}
+
+func NewCircuitBreaker(options BreakerOptions, breakerMetrics *metrics.Breaker) *CircuitBreaker {
+	if breakerMetrics == nil {
+		breakerMetrics = metrics.NewBreaker(prometheus.NewRegistry())
+	}
+	return &CircuitBreaker{options: options, metrics: breakerMetrics}
+}
+
+// State returns the current state, moving an open circuit to half-open once
+// its timeout has passed.
+func (b *CircuitBreaker) State() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expireOpen()
+	return b.state
+}
+
+// allow reports whether a call may be sent and the generation to report its
+// outcome with. In the half-open state only one trial call is let through at
+// a time.
+func (b *CircuitBreaker) allow() (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expireOpen()
+	switch {
+	case b.state == CircuitClosed:
+		return b.generation, true
+	case b.state == CircuitHalfOpen && !b.probing:
+		b.probing = true
+		return b.generation, true
+	}
+	b.metrics.Rejected.Inc()
+	return b.generation, false
+}
+
+// closed reports whether the circuit is closed, without taking the trial
+// call. Blocking queries use it so they never hold the half-open slot.
+func (b *CircuitBreaker) closed() bool {
+	return b.State() == CircuitClosed
+}
+
+// record reports the outcome of a call that allow let through in generation.
+// Outcomes of calls from an earlier generation are ignored.
+func (b *CircuitBreaker) record(generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	b.probing = false
+	if success {
+		b.failures = 0
+		b.setState(CircuitClosed)
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.options.FailureThreshold {
+		b.openedAt = time.Now()
+		b.setState(CircuitOpen)
+	}
+}
+
+// release gives the trial call of generation back without judging Consul,
+// e.g. when the caller cancelled it.
+func (b *CircuitBreaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation {
+		b.probing = false
+	}
+}
+
+func (b *CircuitBreaker) expireOpen() {
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.options.OpenTimeout {
+		b.setState(CircuitHalfOpen)
+	}
+}
+
+func (b *CircuitBreaker) setState(state int) {
+	if state == b.state {
+		return
+	}
+	b.state = state
+	b.generation++
+	b.metrics.State.Set(float64(state))
+	b.metrics.Transitions.WithLabelValues(circuitStateNames[state]).Inc()
+}
@@ -0,0 +1,373 @@
+package repositories
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"github.com/hashicorp/consul/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"projekat/metrics"
+	"projekat/model"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheWatchWait is how long the agent may hold a blocking query.
+	cacheWatchWait = 5 * time.Minute
+	// cacheWatchRetry is the pause after a failed blocking query.
+	cacheWatchRetry = 5 * time.Second
+)
+
+// Eviction reasons recorded in metrics.Cache.Evictions.
+const (
+	evictedSize        = "size"
+	evictedInvalidated = "invalidated"
+)
+
+// CacheOptions bound the read-through cache: Size is the number of entries
+// kept and TTL how long one is served without going back to Consul. Expired
+// entries stay until they are evicted, to be served stale while the storage
+// circuit is open.
+type CacheOptions struct {
+	Size int
+	TTL  time.Duration
+}
+
+type cacheEntry struct {
+	key     string
+	value   []byte
+	fetched time.Time
+	expires time.Time
+}
+
+// StorageCache is a bounded LRU of config and group values keyed by their
+// Consul key. Writes through the cached repositories drop the entry at once;
+// Watch keeps it coherent with writes made by other replicas.
+type StorageCache struct {
+	client  *api.Client
+	keys    Keyspace
+	options CacheOptions
+	metrics *metrics.Cache
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	// generation changes on every invalidation, so a read that raced with a
+	// write does not store the value it read before the write.
+	generation uint64
+}
+
+func NewStorageCache(client *api.Client, keys Keyspace, options CacheOptions, cacheMetrics *metrics.Cache, logger *slog.Logger) *StorageCache {
+	if cacheMetrics == nil {
+		cacheMetrics = metrics.NewCache(prometheus.NewRegistry())
+	}
+	return &StorageCache{
+		client:  client,
+		keys:    keys,
+		options: options,
+		metrics: cacheMetrics,
+		logger:  logger,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// lookup decodes the cached value of key into target. It reports false on a
+// miss and when the request asked to bypass the cache.
+func (c *StorageCache) lookup(ctx context.Context, repository string, key string, target interface{}) bool {
+	if model.CacheBypassFromContext(ctx) {
+		c.metrics.Bypasses.WithLabelValues(repository).Inc()
+		return false
+	}
+
+	c.mu.Lock()
+	var value []byte
+	if element, ok := c.entries[key]; ok {
+		if entry := element.Value.(*cacheEntry); time.Now().Before(entry.expires) {
+			c.order.MoveToFront(element)
+			value = entry.value
+		}
+	}
+	c.mu.Unlock()
+
+	if value == nil || json.Unmarshal(value, target) != nil {
+		c.metrics.Misses.WithLabelValues(repository).Inc()
+		return false
+	}
+	c.metrics.Hits.WithLabelValues(repository).Inc()
+	return true
+}
+
+func (c *StorageCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// store caches value under key unless something was invalidated since
+// generation was read.
+func (c *StorageCache) store(key string, value interface{}, generation uint64) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	now := time.Now()
+	entry := &cacheEntry{key: key, value: data, fetched: now, expires: now.Add(c.options.TTL)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.options.Size {
+		c.removeElement(c.order.Back(), evictedSize)
+	}
+	c.metrics.Entries.Set(float64(c.order.Len()))
+}
+
+// stale returns the cached value of key, expired or not, and when it was
+// read from Consul.
+func (c *StorageCache) stale(key string) ([]byte, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	entry := element.Value.(*cacheEntry)
+	return entry.value, entry.fetched, true
+}
+
+// invalidate drops key after a write to it.
+func (c *StorageCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element, evictedInvalidated)
+	}
+}
+
+// expireAll stops serving every entry as fresh but keeps it for stale reads.
+func (c *StorageCache) expireAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		element.Value.(*cacheEntry).expires = time.Time{}
+	}
+}
+
+// Purge drops every entry.
+func (c *StorageCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for c.order.Len() > 0 {
+		c.removeElement(c.order.Back(), evictedInvalidated)
+	}
+}
+
+func (c *StorageCache) removeElement(element *list.Element, reason string) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+	c.metrics.Evictions.WithLabelValues(reason).Inc()
+	c.metrics.Entries.Set(float64(c.order.Len()))
+}
+
+// Watch purges the cache whenever another writer changes a cached config or
+// group, using Consul blocking queries, until ctx is done. Namespaced configs
+// and groups share their prefix with idempotency records and label indexes,
+// so writes are told apart by key rather than by the index of the prefix.
+func (c *StorageCache) Watch(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, prefix := range []string{configsPrefix, configGroupsPrefix, layoutRoot(namespaceData)} {
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+			c.watch(ctx, c.keys.key(prefix))
+		}(prefix)
+	}
+	wg.Wait()
+}
+
+func (c *StorageCache) watch(ctx context.Context, prefix string) {
+	var index uint64
+	// cached is the number of configs and groups under prefix at index.
+	var cached int
+	for ctx.Err() == nil {
+		options := (&api.QueryOptions{WaitIndex: index, WaitTime: cacheWatchWait}).WithContext(ctx)
+		pairs, meta, err := c.client.KV().List(prefix, options)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// Changes made while the watch is down would go unnoticed, so
+			// nothing is served fresh until it is back.
+			c.logger.WarnContext(ctx, "Cache watch failed", "prefix", prefix, "error", err)
+			c.expireAll()
+			index = 0
+			select {
+			case <-ctx.Done():
+			case <-time.After(cacheWatchRetry):
+			}
+			continue
+		}
+
+		// A config or group was written when its modify index is past the
+		// one waited on, and one was deleted when there are fewer of them.
+		count, written := 0, false
+		for _, pair := range pairs {
+			if c.keys.holdsConfigOrGroup(pair.Key) {
+				count++
+				written = written || pair.ModifyIndex > index
+			}
+		}
+		// The first answer only sets the index to wait on. Consul may reset
+		// the index, e.g. after a snapshot restore.
+		if index != 0 && (written || count != cached || meta.LastIndex < index) {
+			c.logger.DebugContext(ctx, "Cached prefix changed", "prefix", prefix, "index", meta.LastIndex)
+			c.Purge()
+		}
+		cached = count
+		index = meta.LastIndex
+		if index == 0 {
+			index = 1
+		}
+	}
+}
+
+type cachedConfigRepository struct {
+	next  model.ConfigRepository
+	cache *StorageCache
+}
+
+// CacheConfigRepository serves GetConfig from cache and drops entries on
+// writes. It returns repo unchanged when cache is nil.
+func CacheConfigRepository(repo model.ConfigRepository, cache *StorageCache) model.ConfigRepository {
+	if cache == nil || repo == nil {
+		return repo
+	}
+	return cachedConfigRepository{repo, cache}
+}
+
+func (r cachedConfigRepository) key(name string, version float32, ctx context.Context) string {
+	return r.cache.keys.constructKey(model.NamespaceFromContext(ctx), name, version)
+}
+
+func (r cachedConfigRepository) GetConfig(name string, version float32, ctx context.Context) (*model.Config, error) {
+	key := r.key(name, version, ctx)
+	cached := &model.Config{}
+	if r.cache.lookup(ctx, "config", key, cached) {
+		return cached, nil
+	}
+	generation := r.cache.currentGeneration()
+	config, err := r.next.GetConfig(name, version, ctx)
+	if err == nil {
+		r.cache.store(key, config, generation)
+	}
+	return config, err
+}
+
+func (r cachedConfigRepository) AddConfig(config *model.Config, ctx context.Context) error {
+	// The entry is dropped even on errors, which may hide a completed write.
+	defer r.cache.invalidate(r.key(config.Name, config.Version, ctx))
+	return r.next.AddConfig(config, ctx)
+}
+
+func (r cachedConfigRepository) DeleteConfig(name string, version float32, ctx context.Context) error {
+	defer r.cache.invalidate(r.key(name, version, ctx))
+	return r.next.DeleteConfig(name, version, ctx)
+}
+
+func (r cachedConfigRepository) ListConfigs(ctx context.Context) ([]model.Config, error) {
+	return r.next.ListConfigs(ctx)
+}
+
+type cachedConfigGroupRepository struct {
+	next  model.ConfigGroupRepository
+	cache *StorageCache
+}
+
+// CacheConfigGroupRepository serves GetConfigGroup from cache and drops
+// entries on writes. It returns repo unchanged when cache is nil.
+func CacheConfigGroupRepository(repo model.ConfigGroupRepository, cache *StorageCache) model.ConfigGroupRepository {
+	if cache == nil || repo == nil {
+		return repo
+	}
+	return cachedConfigGroupRepository{repo, cache}
+}
+
+func (r cachedConfigGroupRepository) GetConfigGroup(name string, version float32, ctx context.Context) (*model.ConfigGroup, error) {
+	key := r.cache.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), name, version)
+	cached := &model.ConfigGroup{}
+	if r.cache.lookup(ctx, "config_group", key, cached) {
+		return cached, nil
+	}
+	generation := r.cache.currentGeneration()
+	group, err := r.next.GetConfigGroup(name, version, ctx)
+	if err == nil {
+		r.cache.store(key, group, generation)
+	}
+	return group, err
+}
+
+func (r cachedConfigGroupRepository) AddConfigGroup(configGroup *model.ConfigGroup, ctx context.Context) error {
+	defer r.cache.invalidate(r.cache.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), configGroup.Name, configGroup.Version))
+	return r.next.AddConfigGroup(configGroup, ctx)
+}
+
+func (r cachedConfigGroupRepository) DeleteConfigGroup(name string, version float32, ctx context.Context) error {
+	defer r.cache.invalidate(r.cache.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), name, version))
+	return r.next.DeleteConfigGroup(name, version, ctx)
+}
+
+func (r cachedConfigGroupRepository) ListConfigGroups(ctx context.Context) ([]model.ConfigGroup, error) {
+	return r.next.ListConfigGroups(ctx)
+}
+
+type cachedConfigForGroupRepository struct {
+	next  model.ConfigForGroupRepository
+	cache *StorageCache
+}
+
+// CacheConfigForGroupRepository drops the cached group whenever its members
+// change. It returns repo unchanged when cache is nil.
+func CacheConfigForGroupRepository(repo model.ConfigForGroupRepository, cache *StorageCache) model.ConfigForGroupRepository {
+	if cache == nil || repo == nil {
+		return repo
+	}
+	return cachedConfigForGroupRepository{repo, cache}
+}
+
+func (r cachedConfigForGroupRepository) invalidateGroup(groupName string, groupVersion float32, ctx context.Context) {
+	r.cache.invalidate(r.cache.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), groupName, groupVersion))
+}
+
+func (r cachedConfigForGroupRepository) AddToConfigGroup(config *model.ConfigForGroup, groupName string, groupVersion float32, ctx context.Context) error {
+	defer r.invalidateGroup(groupName, groupVersion, ctx)
+	return r.next.AddToConfigGroup(config, groupName, groupVersion, ctx)
+}
+
+func (r cachedConfigForGroupRepository) DeleteFromConfigGroup(configForGroupName string, groupName string, groupVersion float32, ctx context.Context) error {
+	defer r.invalidateGroup(groupName, groupVersion, ctx)
+	return r.next.DeleteFromConfigGroup(configForGroupName, groupName, groupVersion, ctx)
+}
+
+func (r cachedConfigForGroupRepository) GetConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) ([]model.ConfigForGroup, error) {
+	return r.next.GetConfigsByLabels(groupName, groupVersion, labels, ctx)
+}
+
+func (r cachedConfigForGroupRepository) DeleteConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) error {
+	defer r.invalidateGroup(groupName, groupVersion, ctx)
+	return r.next.DeleteConfigsByLabels(groupName, groupVersion, labels, ctx)
+}
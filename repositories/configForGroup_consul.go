@@ -8,30 +8,19 @@ import (
 	"github.com/hashicorp/consul/api"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
-	"log"
-	"os"
+	"log/slog"
 	"projekat/model"
 )
 
 type ConfigForGroupConsulRepository struct {
 	cli    *api.Client
-	logger *log.Logger
+	keys   Keyspace
+	logger *slog.Logger
 	Tracer trace.Tracer
 }
 
-func NewCFG(logger *log.Logger, tracer trace.Tracer) (*ConfigForGroupConsulRepository, error) {
-	db := os.Getenv("DB")
-	dbport := os.Getenv("DBPORT")
-	if db == "" || dbport == "" {
-		return nil, fmt.Errorf("environment variables DB and DBPORT must be set")
-	}
-	config := api.DefaultConfig()
-	config.Address = fmt.Sprintf("%s:%s", db, dbport)
-	client, err := api.NewClient(config)
-	if err != nil {
-		return nil, err
-	}
-	return &ConfigForGroupConsulRepository{cli: client, logger: logger, Tracer: tracer}, nil
+func NewCFG(client *api.Client, keys Keyspace, logger *slog.Logger, tracer trace.Tracer) *ConfigForGroupConsulRepository {
+	return &ConfigForGroupConsulRepository{cli: client, keys: keys, logger: logger, Tracer: tracer}
 }
 
 func labelsMatch1(configLabels map[string]string, targetLabels map[string]string) bool {
@@ -51,7 +40,7 @@ func labelsMatch1(configLabels map[string]string, targetLabels map[string]string
 //
 //	200: []ResponseConfigForGroup
 func (c ConfigForGroupConsulRepository) GetConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) ([]model.ConfigForGroup, error) {
-	_, span := c.Tracer.Start(ctx, "ConfigForGroupConsulRepository.GetConfigsByLabels")
+	ctx, span := c.Tracer.Start(ctx, "ConfigForGroupConsulRepository.GetConfigsByLabels", storageAttributes("get", append(model.GroupAttributes(ctx, groupName, groupVersion), model.LabelsAttribute(labels))...))
 	defer span.End()
 
 	if c.cli == nil {
@@ -59,15 +48,16 @@ func (c ConfigForGroupConsulRepository) GetConfigsByLabels(groupName string, gro
 		return nil, fmt.Errorf("Consul client is not initialized")
 	}
 	kv := c.cli.KV()
-	groupKey := constructKeyForGroup(groupName, groupVersion)
-	pair, _, err := kv.Get(groupKey, nil)
+	groupKey := c.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), groupName, groupVersion)
+	span.SetAttributes(model.AttrStorageKey.String(groupKey))
+	pair, _, err := kv.Get(groupKey, queryOptions(ctx))
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 	if pair == nil {
 		span.SetStatus(codes.Error, "Pair not found")
-		return nil, fmt.Errorf("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
+		return nil, notFound("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
 	}
 	var group model.ConfigGroup
 	err = json.Unmarshal(pair.Value, &group)
@@ -81,6 +71,7 @@ func (c ConfigForGroupConsulRepository) GetConfigsByLabels(groupName string, gro
 			matchingConfigs = append(matchingConfigs, config)
 		}
 	}
+	span.SetAttributes(model.AttrResultCount.Int(len(matchingConfigs)))
 	span.SetStatus(codes.Ok, "Success getting configuration group")
 	return matchingConfigs, nil
 }
@@ -93,18 +84,19 @@ func (c ConfigForGroupConsulRepository) GetConfigsByLabels(groupName string, gro
 //	404: ErrorResponse
 //	204: NoContentResponse
 func (c ConfigForGroupConsulRepository) DeleteConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) error {
-	_, span := c.Tracer.Start(ctx, "ConfigForGroupConsulRepository.DeleteConfigsByLabels")
+	ctx, span := c.Tracer.Start(ctx, "ConfigForGroupConsulRepository.DeleteConfigsByLabels", storageAttributes("put", append(model.GroupAttributes(ctx, groupName, groupVersion), model.LabelsAttribute(labels))...))
 	defer span.End()
 
 	kv := c.cli.KV()
-	groupKey := constructKeyForGroup(groupName, groupVersion)
-	pair, _, err := kv.Get(groupKey, nil)
+	groupKey := c.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), groupName, groupVersion)
+	span.SetAttributes(model.AttrStorageKey.String(groupKey))
+	pair, _, err := kv.Get(groupKey, queryOptions(ctx))
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 	if pair == nil {
-		return fmt.Errorf("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
+		return notFound("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
 	}
 	var group model.ConfigGroup
 	err = json.Unmarshal(pair.Value, &group)
@@ -112,24 +104,28 @@ func (c ConfigForGroupConsulRepository) DeleteConfigsByLabels(groupName string,
 		return err
 	}
 	labelsFound := false
+	deleted := 0
 	for i := len(group.Configurations) - 1; i >= 0; i-- {
 		config := group.Configurations[i]
 
 		if labelsMatch1(config.Labels, labels) {
 			group.Configurations = append(group.Configurations[:i], group.Configurations[i+1:]...)
 			labelsFound = true
+			deleted++
 		}
 	}
+	span.SetAttributes(model.AttrResultCount.Int(deleted))
 	if !labelsFound {
 		span.SetStatus(codes.Error, "labels not found")
-		return errors.New("labels not found")
+		return notFound("labels not found")
 	}
 	updatedGroupJSON, err := json.Marshal(group)
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(model.AttrValueSize.Int(len(updatedGroupJSON)))
 	p := &api.KVPair{Key: groupKey, Value: updatedGroupJSON}
-	_, err = kv.Put(p, nil)
+	_, err = kv.Put(p, writeOptions(ctx))
 	if err != nil {
 		return err
 	}
@@ -146,12 +142,12 @@ func (c ConfigForGroupConsulRepository) DeleteConfigsByLabels(groupName string,
 //	400: ErrorResponse
 //	201: ResponseConfigForGroup
 func (c ConfigForGroupConsulRepository) AddToConfigGroup(config *model.ConfigForGroup, groupName string, groupVersion float32, ctx context.Context) error {
-	_, span := c.Tracer.Start(ctx, "ConfigForGroupConsulRepository.AddToConfigGroup")
+	ctx, span := c.Tracer.Start(ctx, "ConfigForGroupConsulRepository.AddToConfigGroup", storageAttributes("put", append(model.GroupAttributes(ctx, groupName, groupVersion), model.AttrConfigName.String(config.Name))...))
 	defer span.End()
 
 	if c.cli == nil {
 		err := errors.New("Consul client is nil")
-		log.Printf("Error: %v", err)
+		c.logger.ErrorContext(ctx, "Consul client unavailable", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
@@ -159,23 +155,24 @@ func (c ConfigForGroupConsulRepository) AddToConfigGroup(config *model.ConfigFor
 	kv := c.cli.KV()
 	if kv == nil {
 		err := errors.New("KV store is nil")
-		log.Printf("Error: %v", err)
+		c.logger.ErrorContext(ctx, "Consul client unavailable", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
-	groupKey := constructKeyForGroup(groupName, groupVersion)
-	log.Printf("Constructed group key: %s", groupKey) // Log constructed key
+	groupKey := c.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), groupName, groupVersion)
+	span.SetAttributes(model.AttrStorageKey.String(groupKey))
+	c.logger.DebugContext(ctx, "Constructed group key", "key", groupKey)
 
-	pair, _, err := kv.Get(groupKey, nil)
+	pair, _, err := kv.Get(groupKey, queryOptions(ctx))
 	if err != nil {
-		log.Printf("Error getting group from Consul KV: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error getting group from Consul KV", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 	if pair == nil {
-		err := fmt.Errorf("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
-		log.Printf("Error: %v", err) // Log error
+		err := notFound("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
+		c.logger.DebugContext(ctx, "Key not found", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
@@ -183,7 +180,7 @@ func (c ConfigForGroupConsulRepository) AddToConfigGroup(config *model.ConfigFor
 	var group model.ConfigGroup
 	err = json.Unmarshal(pair.Value, &group)
 	if err != nil {
-		log.Printf("Error unmarshalling group: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error unmarshalling group", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
@@ -192,27 +189,29 @@ func (c ConfigForGroupConsulRepository) AddToConfigGroup(config *model.ConfigFor
 		Name:       config.Name,
 		Labels:     config.Labels,
 		Parameters: config.Parameters,
+		Secrets:    config.Secrets,
 	}
 
 	group.Configurations = append(group.Configurations, *configForGroup)
 
 	updatedGroupJSON, err := json.Marshal(group)
 	if err != nil {
-		log.Printf("Error marshalling updated group: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error marshalling updated group", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
-	log.Printf("Adding config to config group with SID: %s, Data: %s", groupKey, string(updatedGroupJSON)) // Log data
+	c.logger.DebugContext(ctx, "Adding config to config group", "key", groupKey, "group", group.Redacted())
 
+	span.SetAttributes(model.AttrValueSize.Int(len(updatedGroupJSON)))
 	p := &api.KVPair{Key: groupKey, Value: updatedGroupJSON}
-	_, err = kv.Put(p, nil)
+	_, err = kv.Put(p, writeOptions(ctx))
 	if err != nil {
-		log.Printf("Error putting updated group to Consul KV: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error putting updated group to Consul KV", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
-	log.Printf("Config successfully added to config group Consul KV: %s", groupKey) // Log success
+	c.logger.InfoContext(ctx, "Config successfully added to config group Consul KV", "key", groupKey)
 	span.SetStatus(codes.Ok, "Success adding configuration group")
 	return nil
 }
@@ -226,21 +225,22 @@ func (c ConfigForGroupConsulRepository) AddToConfigGroup(config *model.ConfigFor
 //	204: NoContentResponse
 func (c ConfigForGroupConsulRepository) DeleteFromConfigGroup(configForGroupName string, groupName string, groupVersion float32, ctx context.Context) error {
 
-	_, span := c.Tracer.Start(ctx, "ConfigForGroupConsulRepository.DeleteFromConfigGroup")
+	ctx, span := c.Tracer.Start(ctx, "ConfigForGroupConsulRepository.DeleteFromConfigGroup", storageAttributes("put", append(model.GroupAttributes(ctx, groupName, groupVersion), model.AttrConfigName.String(configForGroupName))...))
 	defer span.End()
 
 	kv := c.cli.KV()
 
-	groupKey := constructKeyForGroup(groupName, groupVersion)
+	groupKey := c.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), groupName, groupVersion)
+	span.SetAttributes(model.AttrStorageKey.String(groupKey))
 
-	pair, _, err := kv.Get(groupKey, nil)
+	pair, _, err := kv.Get(groupKey, queryOptions(ctx))
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 	if pair == nil {
 		span.SetStatus(codes.Error, "config does not exist")
-		return fmt.Errorf("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
+		return notFound("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
 	}
 
 	var group model.ConfigGroup
@@ -263,15 +263,16 @@ func (c ConfigForGroupConsulRepository) DeleteFromConfigGroup(configForGroupName
 
 	if found {
 		group.Configurations = append(group.Configurations[:index], group.Configurations[index+1:]...)
-		c.logger.Println("Config successfully deleted from group Consul:")
+		c.logger.InfoContext(ctx, "Config successfully deleted from group Consul", "name", configForGroupName)
 
 		updatedGroupJSON, err := json.Marshal(group)
 		if err != nil {
 			return err
 		}
 
+		span.SetAttributes(model.AttrValueSize.Int(len(updatedGroupJSON)))
 		p := &api.KVPair{Key: groupKey, Value: updatedGroupJSON}
-		_, err = kv.Put(p, nil)
+		_, err = kv.Put(p, writeOptions(ctx))
 		if err != nil {
 			return err
 		}
@@ -281,7 +282,7 @@ func (c ConfigForGroupConsulRepository) DeleteFromConfigGroup(configForGroupName
 	}
 
 	span.SetStatus(codes.Ok, "configuration not found in the specified group")
-	return errors.New("configuration not found in the specified group")
+	return notFound("configuration not found in the specified group")
 }
 
 //func NewConfigForGroupConsulRepository() model.ConfigForGroupRepository {
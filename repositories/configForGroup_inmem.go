@@ -1,8 +1,9 @@
 package repositories
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"log/slog"
 	"projekat/model"
 )
 
@@ -15,26 +16,27 @@ func (c ConfigForGroupInMemRepository) GetConfigForGroup(name string, labels str
 	key := fmt.Sprintf("%s/%s", name, labels)
 	ConfigForGroup, ok := c.Configs[key]
 	if !ok {
-		return &model.ConfigForGroup{}, errors.New("config not found")
+		return &model.ConfigForGroup{}, notFound("config not found")
 	}
 	return &ConfigForGroup, nil
 
 }
 
-func (c ConfigForGroupInMemRepository) AddToConfigGroup(config *model.ConfigForGroup, groupName string, groupVersion float32) error {
+func (c ConfigForGroupInMemRepository) AddToConfigGroup(config *model.ConfigForGroup, groupName string, groupVersion float32, ctx context.Context) error {
 
-	group, err := c.ConfigGroups.GetConfigGroup(groupName, groupVersion)
+	group, err := c.ConfigGroups.GetConfigGroup(groupName, groupVersion, ctx)
 	if err != nil {
 		return err // Error fetching the group
 	}
 	if group == nil {
-		return fmt.Errorf("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
+		return notFound("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
 	}
 
 	configForGroup := &model.ConfigForGroup{
 		Name:       config.Name,
 		Labels:     config.Labels,
 		Parameters: config.Parameters,
+		Secrets:    config.Secrets,
 	}
 
 	group.Configurations = append(group.Configurations, *configForGroup)
@@ -42,14 +44,14 @@ func (c ConfigForGroupInMemRepository) AddToConfigGroup(config *model.ConfigForG
 	return nil
 }
 
-func (c ConfigForGroupInMemRepository) DeleteFromConfigGroup(configForGroupName string, groupName string, groupVersion float32) error {
+func (c ConfigForGroupInMemRepository) DeleteFromConfigGroup(configForGroupName string, groupName string, groupVersion float32, ctx context.Context) error {
 
-	group, err := c.ConfigGroups.GetConfigGroup(groupName, groupVersion)
+	group, err := c.ConfigGroups.GetConfigGroup(groupName, groupVersion, ctx)
 	if err != nil {
 		return err // Error fetching the group
 	}
 	if group == nil {
-		return fmt.Errorf("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
+		return notFound("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
 	}
 
 	found := false
@@ -69,16 +71,16 @@ func (c ConfigForGroupInMemRepository) DeleteFromConfigGroup(configForGroupName
 		return nil
 	}
 
-	return errors.New("configuration not found in the specified group")
+	return notFound("configuration not found in the specified group")
 }
 
-func (c ConfigForGroupInMemRepository) GetConfigsByLabels(groupName string, groupVersion float32, labels map[string]string) ([]model.ConfigForGroup, error) {
-	group, err := c.ConfigGroups.GetConfigGroup(groupName, groupVersion)
+func (c ConfigForGroupInMemRepository) GetConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) ([]model.ConfigForGroup, error) {
+	group, err := c.ConfigGroups.GetConfigGroup(groupName, groupVersion, ctx)
 	if err != nil {
 		return nil, err
 	}
 	if group == nil {
-		return nil, fmt.Errorf("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
+		return nil, notFound("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
 	}
 
 	var matchingConfigs []model.ConfigForGroup
@@ -91,7 +93,7 @@ func (c ConfigForGroupInMemRepository) GetConfigsByLabels(groupName string, grou
 			matchingConfigs = append(matchingConfigs, config)
 		}
 	}
-	fmt.Println(matchingConfigs)
+	slog.DebugContext(ctx, "Matched configurations in group", "group", groupName, "count", len(matchingConfigs))
 	return matchingConfigs, nil
 }
 
@@ -108,13 +110,13 @@ func labelsMatch(configLabels map[string]string, targetLabels map[string]string)
 	return true
 }
 
-func (c ConfigForGroupInMemRepository) DeleteConfigsByLabels(groupName string, groupVersion float32, labels map[string]string) error {
-	group, err := c.ConfigGroups.GetConfigGroup(groupName, groupVersion)
+func (c ConfigForGroupInMemRepository) DeleteConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) error {
+	group, err := c.ConfigGroups.GetConfigGroup(groupName, groupVersion, ctx)
 	if err != nil {
 		return err
 	}
 	if group == nil {
-		return fmt.Errorf("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
+		return notFound("configuration group '%s' with version %.2f does not exist", groupName, groupVersion)
 	}
 
 	labelsFound := false
@@ -134,7 +136,7 @@ func (c ConfigForGroupInMemRepository) DeleteConfigsByLabels(groupName string, g
 	if labelsFound == true {
 		return nil
 	}
-	return errors.New("labels not found")
+	return notFound("labels not found")
 }
 
 func NewConfigForGroupInMemRepository(groupRepo *ConfigGroupInMemRepository) *ConfigForGroupInMemRepository {
@@ -4,34 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/hashicorp/consul/api"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
-	"log"
-	"os"
+	"log/slog"
 	"projekat/model"
 )
 
 type ConfigGroupConsulRepository struct {
 	cli    *api.Client
-	logger *log.Logger
+	keys   Keyspace
+	logger *slog.Logger
 	Tracer trace.Tracer
 }
 
-func NewCG(logger *log.Logger, trace trace.Tracer) (*ConfigGroupConsulRepository, error) {
-	db := os.Getenv("DB")
-	dbport := os.Getenv("DBPORT")
-	if db == "" || dbport == "" {
-		return nil, fmt.Errorf("environment variables DB and DBPORT must be set")
-	}
-	config := api.DefaultConfig()
-	config.Address = fmt.Sprintf("%s:%s", db, dbport)
-	client, err := api.NewClient(config)
-	if err != nil {
-		return nil, err
-	}
-	return &ConfigGroupConsulRepository{cli: client, logger: logger, Tracer: trace}, nil
+func NewCG(client *api.Client, keys Keyspace, logger *slog.Logger, trace trace.Tracer) *ConfigGroupConsulRepository {
+	return &ConfigGroupConsulRepository{cli: client, keys: keys, logger: logger, Tracer: trace}
 }
 
 // swagger:route GET /configGroup/{name}/{version}/ getConfigGroup
@@ -42,12 +30,12 @@ func NewCG(logger *log.Logger, trace trace.Tracer) (*ConfigGroupConsulRepository
 //	404: ErrorResponse
 //	200: ResponseConfigGroup
 func (c ConfigGroupConsulRepository) GetConfigGroup(name string, version float32, ctx context.Context) (*model.ConfigGroup, error) {
-	_, span := c.Tracer.Start(ctx, "ConfigGroupConsulRepository.GetConfigGroup")
+	ctx, span := c.Tracer.Start(ctx, "ConfigGroupConsulRepository.GetConfigGroup", storageAttributes("get", model.GroupAttributes(ctx, name, version)...))
 	defer span.End()
 
 	if c.cli == nil {
 		err := errors.New("Consul client is nil")
-		log.Printf("Error: %v", err)
+		c.logger.ErrorContext(ctx, "Consul client unavailable", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
@@ -55,36 +43,39 @@ func (c ConfigGroupConsulRepository) GetConfigGroup(name string, version float32
 	kv := c.cli.KV()
 	if kv == nil {
 		err := errors.New("KV store is nil")
-		log.Printf("Error: %v", err)
+		c.logger.ErrorContext(ctx, "Consul client unavailable", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
-	key := constructKeyForGroup(name, version)
-	log.Printf("Constructed group key: %s", key) // Log constructed key
+	key := c.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), name, version)
+	span.SetAttributes(model.AttrStorageKey.String(key))
+	c.logger.DebugContext(ctx, "Constructed group key", "key", key)
 
-	pair, _, err := kv.Get(key, nil)
+	pair, _, err := kv.Get(key, queryOptions(ctx))
 	if err != nil {
-		log.Printf("Error getting config group from Consul KV: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error getting config group from Consul KV", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 	if pair == nil {
-		err := fmt.Errorf("configuration group '%s' with version %.1f not found", name, version)
-		log.Printf("Error: %v", err) // Log error
+		err := notFound("configuration group '%s' with version %.1f not found", name, version)
+		c.logger.DebugContext(ctx, "Key not found", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
+	span.SetAttributes(model.AttrValueSize.Int(len(pair.Value)))
 	configGroup := &model.ConfigGroup{}
 	err = json.Unmarshal(pair.Value, configGroup)
 	if err != nil {
-		log.Printf("Error unmarshalling config group: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error unmarshalling config group", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
-	log.Printf("Retrieved config group: %+v", configGroup) // Log retrieved config group
+	span.SetAttributes(model.AttrResultCount.Int(len(configGroup.Configurations)))
+	c.logger.DebugContext(ctx, "Retrieved config group", "group", configGroup.Redacted())
 	span.SetStatus(codes.Ok, "Success getting config group")
 	return configGroup, nil
 }
@@ -98,12 +89,12 @@ func (c ConfigGroupConsulRepository) GetConfigGroup(name string, version float32
 //	400: ErrorResponse
 //	201: ResponseConfigGroup
 func (c ConfigGroupConsulRepository) AddConfigGroup(config *model.ConfigGroup, ctx context.Context) error {
-	_, span := c.Tracer.Start(ctx, "ConfigGroupConsulRepository.AddConfigGroup")
+	ctx, span := c.Tracer.Start(ctx, "ConfigGroupConsulRepository.AddConfigGroup", storageAttributes("put", model.GroupAttributes(ctx, config.Name, config.Version)...))
 	defer span.End()
 
 	if c.cli == nil {
 		err := errors.New("Consul client is nil")
-		log.Printf("Error: %v", err)
+		c.logger.ErrorContext(ctx, "Consul client unavailable", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
@@ -111,31 +102,33 @@ func (c ConfigGroupConsulRepository) AddConfigGroup(config *model.ConfigGroup, c
 	kv := c.cli.KV()
 	if kv == nil {
 		err := errors.New("KV store is nil")
-		log.Printf("Error: %v", err)
+		c.logger.ErrorContext(ctx, "Consul client unavailable", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
-	key := constructKeyForGroup(config.Name, config.Version)
-	log.Printf("Constructed group key: %s", key) // Log constructed key
+	key := c.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), config.Name, config.Version)
+	span.SetAttributes(model.AttrStorageKey.String(key))
+	c.logger.DebugContext(ctx, "Constructed group key", "key", key)
 
 	data, err := json.Marshal(config)
 	if err != nil {
-		log.Printf("Error marshalling config group: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error marshalling config group", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
-	log.Printf("Adding config group with SID: %s, Data: %s", key, string(data)) // Log data being added
+	span.SetAttributes(model.AttrValueSize.Int(len(data)))
+	c.logger.DebugContext(ctx, "Adding config group", "key", key, "group", config.Redacted())
 
 	p := &api.KVPair{Key: key, Value: data}
-	_, err = kv.Put(p, nil)
+	_, err = kv.Put(p, writeOptions(ctx))
 	if err != nil {
-		log.Printf("Error adding config group to Consul KV: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error adding config group to Consul KV", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
-	log.Printf("Config group added successfully: %s", key) // Log success
+	c.logger.InfoContext(ctx, "Config group added successfully", "key", key)
 	span.SetStatus(codes.Ok, "Config group added successfully")
 	return nil
 }
@@ -148,21 +141,50 @@ func (c ConfigGroupConsulRepository) AddConfigGroup(config *model.ConfigGroup, c
 //	404: ErrorResponse
 //	204: NoContentResponse
 func (c ConfigGroupConsulRepository) DeleteConfigGroup(name string, version float32, ctx context.Context) error {
-	_, span := c.Tracer.Start(ctx, "ConfigGroupConsulRepository.DeleteConfigGroup")
+	ctx, span := c.Tracer.Start(ctx, "ConfigGroupConsulRepository.DeleteConfigGroup", storageAttributes("delete", model.GroupAttributes(ctx, name, version)...))
 	defer span.End()
+	key := c.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), name, version)
+	span.SetAttributes(model.AttrStorageKey.String(key))
 	kv := c.cli.KV()
-	_, err := kv.Delete(constructKeyForGroup(name, version), nil)
+	_, err := kv.Delete(key, writeOptions(ctx))
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		c.logger.Println("Error deleting config group:", err)
+		c.logger.ErrorContext(ctx, "Error deleting config group", "error", err)
 		return err
 	}
 
-	c.logger.Println("Config group deleted successfully", constructKeyForGroup(name, version))
+	c.logger.InfoContext(ctx, "Config group deleted successfully", "key", key)
 	span.SetStatus(codes.Ok, "Config group deleted successfully")
 	return nil
 }
 
+func (c ConfigGroupConsulRepository) ListConfigGroups(ctx context.Context) ([]model.ConfigGroup, error) {
+	ctx, span := c.Tracer.Start(ctx, "ConfigGroupConsulRepository.ListConfigGroups", storageAttributes("list", model.AttrNamespace.String(model.NamespaceFromContext(ctx))))
+	defer span.End()
+
+	prefix := c.keys.key(namespacePrefix(model.NamespaceFromContext(ctx)) + configGroupsPrefix)
+	span.SetAttributes(model.AttrStorageKey.String(prefix))
+	pairs, _, err := c.cli.KV().List(prefix, queryOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	groups := make([]model.ConfigGroup, 0, len(pairs))
+	for _, pair := range pairs {
+		var group model.ConfigGroup
+		if err := json.Unmarshal(pair.Value, &group); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	span.SetAttributes(model.AttrResultCount.Int(len(groups)))
+	span.SetStatus(codes.Ok, "Success listing config groups")
+	return groups, nil
+}
+
 //func NewConfigGroupConsulRepository() model.ConfigGroupRepository {
 //	return ConfigGroupConsulRepository{}
 //}
@@ -1,41 +1,53 @@
 package repositories
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"projekat/model"
+	"strings"
 )
 
 type ConfigGroupInMemRepository struct {
 	Configs map[string]*model.ConfigGroup
 }
 
-func (c ConfigGroupInMemRepository) GetConfigGroup(name string, version float32) (*model.ConfigGroup, error) {
-	key := fmt.Sprintf("%s/%.2f", name, version)
+func (c ConfigGroupInMemRepository) GetConfigGroup(name string, version float32, ctx context.Context) (*model.ConfigGroup, error) {
+	key := fmt.Sprintf("%s/%s/%.2f", model.NamespaceFromContext(ctx), name, version)
 	config, ok := c.Configs[key]
 	if !ok {
-		return nil, fmt.Errorf("configGroup '%s' with version %.2f not found", name, version)
+		return nil, notFound("configGroup '%s' with version %.2f not found", name, version)
 	}
 	return config, nil
 
 }
 
-func (c ConfigGroupInMemRepository) AddConfigGroup(config *model.ConfigGroup) error {
-	key := fmt.Sprintf("%s/%.2f", config.Name, config.Version)
+func (c ConfigGroupInMemRepository) AddConfigGroup(config *model.ConfigGroup, ctx context.Context) error {
+	key := fmt.Sprintf("%s/%s/%.2f", model.NamespaceFromContext(ctx), config.Name, config.Version)
 	c.Configs[key] = config
 	return nil
 }
 
-func (c ConfigGroupInMemRepository) DeleteConfigGroup(name string, version float32) error {
-	key := fmt.Sprintf("%s/%.2f", name, version)
+func (c ConfigGroupInMemRepository) DeleteConfigGroup(name string, version float32, ctx context.Context) error {
+	key := fmt.Sprintf("%s/%s/%.2f", model.NamespaceFromContext(ctx), name, version)
 	_, err := c.Configs[key]
 	if !err {
-		return errors.New("configuration group does not exist")
+		return notFound("configuration group does not exist")
 	}
 	delete(c.Configs, key)
 	return nil
 }
 
+func (c ConfigGroupInMemRepository) ListConfigGroups(ctx context.Context) ([]model.ConfigGroup, error) {
+	prefix := model.NamespaceFromContext(ctx) + "/"
+	var groups []model.ConfigGroup
+	for key, group := range c.Configs {
+		if strings.HasPrefix(key, prefix) {
+			groups = append(groups, *group)
+		}
+	}
+	return groups, nil
+}
+
 // todo: dodaj implementaciju metoda iz interfejsa ConfigRepository
 
 func NewConfigGroupInMemRepository() *ConfigGroupInMemRepository {
@@ -4,34 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/hashicorp/consul/api"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
-	"log"
-	"os"
+	"log/slog"
 	"projekat/model"
 )
 
 type ConfigConsulRepository struct {
 	cli    *api.Client
-	logger *log.Logger
+	keys   Keyspace
+	logger *slog.Logger
 	Tracer trace.Tracer
 }
 
-func New(logger *log.Logger, tracer trace.Tracer) (*ConfigConsulRepository, error) {
-	db := os.Getenv("DB")
-	dbport := os.Getenv("DBPORT")
-	if db == "" || dbport == "" {
-		return nil, fmt.Errorf("environment variables DB and DBPORT must be set")
-	}
-	config := api.DefaultConfig()
-	config.Address = fmt.Sprintf("%s:%s", db, dbport)
-	client, err := api.NewClient(config)
-	if err != nil {
-		return nil, err
-	}
-	return &ConfigConsulRepository{cli: client, logger: logger, Tracer: tracer}, nil
+func New(client *api.Client, keys Keyspace, logger *slog.Logger, tracer trace.Tracer) *ConfigConsulRepository {
+	return &ConfigConsulRepository{cli: client, keys: keys, logger: logger, Tracer: tracer}
 }
 
 // swagger:route GET /config/{name}/{version}/ getConfig
@@ -41,12 +29,12 @@ func New(logger *log.Logger, tracer trace.Tracer) (*ConfigConsulRepository, erro
 //
 //	200: ResponseConfig
 func (c ConfigConsulRepository) GetConfig(name string, version float32, ctx context.Context) (*model.Config, error) {
-	_, span := c.Tracer.Start(ctx, "ConfigConsulRepository.GetConfig")
+	ctx, span := c.Tracer.Start(ctx, "ConfigConsulRepository.GetConfig", storageAttributes("get", model.ConfigAttributes(ctx, name, version)...))
 	defer span.End()
 
 	if c.cli == nil {
 		err := errors.New("consul client is nil")
-		log.Printf("Error: %v", err)
+		c.logger.ErrorContext(ctx, "Consul client unavailable", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
@@ -54,39 +42,41 @@ func (c ConfigConsulRepository) GetConfig(name string, version float32, ctx cont
 	kv := c.cli.KV()
 	if kv == nil {
 		err := errors.New("KV store is nil")
-		log.Printf("Error: %v", err)
+		c.logger.ErrorContext(ctx, "Consul client unavailable", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
-	key := constructKey(name, version)
-	log.Printf("Constructed key: %s", key) // Log constructed key
+	key := c.keys.constructKey(model.NamespaceFromContext(ctx), name, version)
+	span.SetAttributes(model.AttrStorageKey.String(key))
+	c.logger.DebugContext(ctx, "Constructed key", "key", key)
 
-	pair, _, err := kv.Get(key, nil)
+	pair, _, err := kv.Get(key, queryOptions(ctx))
 	if err != nil {
-		log.Printf("Error getting key from KV store: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error getting key from KV store", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
 	if pair == nil {
-		err := fmt.Errorf("configuration '%s' with version %.1f not found", name, version)
-		log.Printf("Error: %v", err) // Log error
+		err := notFound("configuration '%s' with version %.1f not found", name, version)
+		c.logger.DebugContext(ctx, "Key not found", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
-	log.Printf("KV pair retrieved: %s", pair.Value) // Log retrieved KV pair
+	span.SetAttributes(model.AttrValueSize.Int(len(pair.Value)))
+	c.logger.DebugContext(ctx, "KV pair retrieved", "key", pair.Key, "bytes", len(pair.Value))
 
 	config := &model.Config{}
 	err = json.Unmarshal(pair.Value, config)
 	if err != nil {
-		log.Printf("Error unmarshalling KV pair value: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error unmarshalling KV pair value", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
-	log.Printf("Config unmarshalled: %+v", config) // Log unmarshalled config
+	c.logger.DebugContext(ctx, "Config unmarshalled", "config", config.Redacted())
 
 	span.SetStatus(codes.Ok, "Success getting configuration")
 	return config, nil
@@ -101,12 +91,12 @@ func (c ConfigConsulRepository) GetConfig(name string, version float32, ctx cont
 //	400: ErrorResponse
 //	201: ResponseConfig
 func (c ConfigConsulRepository) AddConfig(config *model.Config, ctx context.Context) error {
-	_, span := c.Tracer.Start(ctx, "ConfigConsulRepository.AddConfig")
+	ctx, span := c.Tracer.Start(ctx, "ConfigConsulRepository.AddConfig", storageAttributes("put", model.ConfigAttributes(ctx, config.Name, config.Version)...))
 	defer span.End()
 
 	if c.cli == nil {
 		err := errors.New("Consul client is nil")
-		log.Printf("Error: %v", err)
+		c.logger.ErrorContext(ctx, "Consul client unavailable", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
@@ -114,31 +104,33 @@ func (c ConfigConsulRepository) AddConfig(config *model.Config, ctx context.Cont
 	kv := c.cli.KV()
 	if kv == nil {
 		err := errors.New("KV store is nil")
-		log.Printf("Error: %v", err)
+		c.logger.ErrorContext(ctx, "Consul client unavailable", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
-	key := constructKey(config.Name, config.Version)
-	log.Printf("Constructed key: %s", key) // Log constructed key
+	key := c.keys.constructKey(model.NamespaceFromContext(ctx), config.Name, config.Version)
+	span.SetAttributes(model.AttrStorageKey.String(key))
+	c.logger.DebugContext(ctx, "Constructed key", "key", key)
 
 	data, err := json.Marshal(config)
 	if err != nil {
-		log.Printf("Error marshalling config: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error marshalling config", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
-	log.Printf("Adding config with SID: %s, Data: %s", key, string(data)) // Log data
+	span.SetAttributes(model.AttrValueSize.Int(len(data)))
+	c.logger.DebugContext(ctx, "Adding config", "key", key, "config", config.Redacted())
 
 	p := &api.KVPair{Key: key, Value: data}
-	_, err = kv.Put(p, nil)
+	_, err = kv.Put(p, writeOptions(ctx))
 	if err != nil {
-		log.Printf("Error putting config to Consul KV: %v", err) // Log error
+		c.logger.ErrorContext(ctx, "Error putting config to Consul KV", "error", err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
-	log.Printf("Config successfully added to Consul KV: %s", key) // Log success
+	c.logger.InfoContext(ctx, "Config successfully added to Consul KV", "key", key)
 	span.SetStatus(codes.Ok, "Config successfully added")
 	return nil
 }
@@ -151,43 +143,84 @@ func (c ConfigConsulRepository) AddConfig(config *model.Config, ctx context.Cont
 //	404: ErrorResponse
 //	204: NoContentResponse
 func (c ConfigConsulRepository) DeleteConfig(name string, version float32, ctx context.Context) error {
-	_, span := c.Tracer.Start(ctx, "ConfigRepository.DeleteConfig")
+	ctx, span := c.Tracer.Start(ctx, "ConfigConsulRepository.DeleteConfig", storageAttributes("delete", model.ConfigAttributes(ctx, name, version)...))
 	defer span.End()
 
+	key := c.keys.constructKey(model.NamespaceFromContext(ctx), name, version)
+	span.SetAttributes(model.AttrStorageKey.String(key))
 	kv := c.cli.KV()
-	_, err := kv.Delete(constructKey(name, version), nil)
+	_, err := kv.Delete(key, writeOptions(ctx))
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
-	c.logger.Println("Config successfully deleted from Consul:", name)
+	c.logger.InfoContext(ctx, "Config successfully deleted from Consul", "name", name)
 
 	span.SetStatus(codes.Ok, "Successfully deleted configuration group")
 	return nil
 }
 
-func (cr *ConfigConsulRepository) GetIdempotencyRequestByKey(key string, ctx context.Context) (bool, error) {
-	_, span := cr.Tracer.Start(ctx, "Repository.GetIdempotencyRequest")
+func (c ConfigConsulRepository) ListConfigs(ctx context.Context) ([]model.Config, error) {
+	ctx, span := c.Tracer.Start(ctx, "ConfigConsulRepository.ListConfigs", storageAttributes("list", model.AttrNamespace.String(model.NamespaceFromContext(ctx))))
+	defer span.End()
+
+	prefix := c.keys.key(namespacePrefix(model.NamespaceFromContext(ctx)) + configsPrefix)
+	span.SetAttributes(model.AttrStorageKey.String(prefix))
+	pairs, _, err := c.cli.KV().List(prefix, queryOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	configs := make([]model.Config, 0, len(pairs))
+	for _, pair := range pairs {
+		var config model.Config
+		if err := json.Unmarshal(pair.Value, &config); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+
+	span.SetAttributes(model.AttrResultCount.Int(len(configs)))
+	span.SetStatus(codes.Ok, "Success listing configurations")
+	return configs, nil
+}
+
+// GetIdempotencyRequestByKey returns the stored request for key, or nil if the
+// key was never used.
+func (cr *ConfigConsulRepository) GetIdempotencyRequestByKey(key string, ctx context.Context) (*model.IdempotencyRequest, error) {
+	ctx, span := cr.Tracer.Start(ctx, "Repository.GetIdempotencyRequest", storageAttributes("get", model.AttrNamespace.String(model.NamespaceFromContext(ctx))))
 	defer span.End()
 	kv := cr.cli.KV()
 
-	data, _, err := kv.Get(constructIdempotencyRequestKey(key), nil)
+	storageKey := cr.keys.constructIdempotencyRequestKey(model.NamespaceFromContext(ctx), key)
+	span.SetAttributes(model.AttrStorageKey.String(storageKey))
+	data, _, err := kv.Get(storageKey, queryOptions(ctx))
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return false, err
+		return nil, err
 	}
 
 	if data == nil {
 		span.SetStatus(codes.Error, "Idempotency request not found") // Set appropriate status message
-		return false, nil
+		return nil, nil
+	}
+
+	span.SetAttributes(model.AttrValueSize.Int(len(data.Value)))
+	req := &model.IdempotencyRequest{Key: key}
+	if err := json.Unmarshal(data.Value, req); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
 	}
 
 	span.SetStatus(codes.Ok, "Success")
-	return true, nil
+	return req, nil
 }
 
 func (cr *ConfigConsulRepository) AddIdempotencyRequest(req *model.IdempotencyRequest, ctx context.Context) (*model.IdempotencyRequest, error) {
-	_, span := cr.Tracer.Start(ctx, "Repository.AddIdempotencyRequest")
+	ctx, span := cr.Tracer.Start(ctx, "Repository.AddIdempotencyRequest", storageAttributes("put", model.AttrNamespace.String(model.NamespaceFromContext(ctx))))
+	defer span.End()
 
 	kv := cr.cli.KV()
 
@@ -197,8 +230,9 @@ func (cr *ConfigConsulRepository) AddIdempotencyRequest(req *model.IdempotencyRe
 		return nil, err
 	}
 
-	keyValue := &api.KVPair{Key: constructIdempotencyRequestKey(req.Key), Value: data}
-	_, err = kv.Put(keyValue, nil)
+	keyValue := &api.KVPair{Key: cr.keys.constructIdempotencyRequestKey(model.NamespaceFromContext(ctx), req.Key), Value: data}
+	span.SetAttributes(model.AttrStorageKey.String(keyValue.Key), model.AttrValueSize.Int(len(data)))
+	_, err = kv.Put(keyValue, writeOptions(ctx))
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
@@ -1,42 +1,55 @@
 package repositories
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"log/slog"
 	"projekat/model"
+	"strings"
 )
 
 type ConfigInMemRepository struct {
 	Configs map[string]model.Config
 }
 
-func (c ConfigInMemRepository) GetConfig(name string, version float32) (*model.Config, error) {
-	key := fmt.Sprintf("%s/%.2f", name, version)
+func (c ConfigInMemRepository) GetConfig(name string, version float32, ctx context.Context) (*model.Config, error) {
+	key := fmt.Sprintf("%s/%s/%.2f", model.NamespaceFromContext(ctx), name, version)
 	config, ok := c.Configs[key]
 	if !ok {
-		return &model.Config{}, errors.New("config not found")
+		return &model.Config{}, notFound("config not found")
 	}
 	return &config, nil
 
 }
 
-func (c ConfigInMemRepository) AddConfig(config *model.Config) error {
+func (c ConfigInMemRepository) AddConfig(config *model.Config, ctx context.Context) error {
 
-	key := fmt.Sprintf("%s/%.2f", config.Name, config.Version)
+	key := fmt.Sprintf("%s/%s/%.2f", model.NamespaceFromContext(ctx), config.Name, config.Version)
 	c.Configs[key] = *config
 	return nil
 }
 
-func (c ConfigInMemRepository) DeleteConfig(name string, version float32) error {
-	key := fmt.Sprintf("%s/%.2f", name, version)
+func (c ConfigInMemRepository) DeleteConfig(name string, version float32, ctx context.Context) error {
+	key := fmt.Sprintf("%s/%s/%.2f", model.NamespaceFromContext(ctx), name, version)
 	if _, ok := c.Configs[key]; !ok {
-		return errors.New("configuration does not exist")
+		return notFound("configuration does not exist")
 	}
 	delete(c.Configs, key)
-	fmt.Printf("Deleting configuration: %s\n", key)
+	slog.DebugContext(ctx, "Deleting configuration", "key", key)
 	return nil
 }
 
+func (c ConfigInMemRepository) ListConfigs(ctx context.Context) ([]model.Config, error) {
+	prefix := model.NamespaceFromContext(ctx) + "/"
+	var configs []model.Config
+	for key, config := range c.Configs {
+		if strings.HasPrefix(key, prefix) {
+			configs = append(configs, config)
+		}
+	}
+	return configs, nil
+}
+
 // todo: dodaj implementaciju metoda iz interfejsa ConfigRepository
 
 func NewConfigInMemRepository() *ConfigInMemRepository {
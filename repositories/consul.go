@@ -0,0 +1,335 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/consul/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"projekat/model"
+	"strings"
+	"time"
+)
+
+// ConsulOptions describe how to reach the Consul agent. One client built
+// from them is shared by every repository.
+type ConsulOptions struct {
+	// Address is the agent's host:port.
+	Address string
+	// Token is the ACL token. TokenFile, when set, is read instead.
+	Token      string
+	TokenFile  string
+	Datacenter string
+	// Namespace and Partition are Consul Enterprise tenancy, unrelated to the
+	// config namespaces of this service.
+	Namespace string
+	Partition string
+	TLS       ConsulTLS
+	// ConnectTimeout bounds dialing and the TLS handshake.
+	ConnectTimeout time.Duration
+	Timeouts       StorageTimeouts
+	Retry          RetryPolicy
+	// Breaker, when set, refuses calls while Consul keeps failing.
+	Breaker *CircuitBreaker
+}
+
+type ConsulTLS struct {
+	Enabled  bool
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name the agent's certificate is checked for.
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// RetryPolicy retries reads that failed with a connection error or a
+// transient status, and writes that could not connect. Before retry n it waits a random delay of up to BaseDelay
+// doubled n-1 times, capped at MaxDelay. Attempts counts the first try, so 1
+// or less disables retries.
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// retryable reports whether a call that got resp or err may be sent again.
+// Only reads are idempotent: a write that got a 5xx or lost its connection
+// may already be committed, so writes are resent only when the connection
+// was never made. Requests whose body cannot be replayed are never retried.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		return req.Method == http.MethodGet || notSent(err)
+	}
+	if req.Method != http.MethodGet {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// notSent reports whether err happened while connecting, before any of the
+// request reached Consul.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// StorageTimeouts bound how long a single Consul call may take, on top of
+// whatever deadline the caller's context already carries. Zero disables a
+// budget.
+type StorageTimeouts struct {
+	Read  time.Duration
+	List  time.Duration
+	Write time.Duration
+}
+
+// budget picks the timeout for req: recursive and key-only reads are lists,
+// other GETs are reads and everything else writes. Blocking queries also get
+// the time the agent may hold them.
+func (t StorageTimeouts) budget(req *http.Request) time.Duration {
+	if req.Method != http.MethodGet {
+		return t.Write
+	}
+	query := req.URL.Query()
+	budget := t.Read
+	if query.Has("recurse") || query.Has("keys") {
+		budget = t.List
+	}
+	if budget > 0 && query.Has("index") {
+		// The agent adds up to wait/16 of jitter to the wait.
+		wait, _ := time.ParseDuration(query.Get("wait"))
+		budget += wait + wait/16
+	}
+	return budget
+}
+
+// NewConsulClient returns a client for the agent in options whose HTTP
+// requests are traced as client spans, bounded by the storage timeouts and
+// retried on transient failures, and refused while the breaker in options is
+// open. Requests only join the caller's trace, and
+// stop when it is cancelled, when the context is passed with queryOptions or
+// writeOptions.
+func NewConsulClient(options ConsulOptions, tracer trace.Tracer) (*api.Client, error) {
+	if options.Address == "" {
+		return nil, errors.New("consul address must be set")
+	}
+	config := api.DefaultConfig()
+	config.Address = options.Address
+	config.Token = options.Token
+	config.TokenFile = options.TokenFile
+	config.Datacenter = options.Datacenter
+	config.Namespace = options.Namespace
+	config.Partition = options.Partition
+	config.Scheme = "http"
+	config.TLSConfig = api.TLSConfig{}
+	if options.TLS.Enabled {
+		config.Scheme = "https"
+		config.TLSConfig = api.TLSConfig{
+			Address:            options.TLS.ServerName,
+			CAFile:             options.TLS.CAFile,
+			CertFile:           options.TLS.CertFile,
+			KeyFile:            options.TLS.KeyFile,
+			InsecureSkipVerify: options.TLS.InsecureSkipVerify,
+		}
+	}
+	if options.ConnectTimeout > 0 {
+		config.Transport.DialContext = (&net.Dialer{Timeout: options.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		config.Transport.TLSHandshakeTimeout = options.ConnectTimeout
+	}
+
+	httpClient, err := api.NewHttpClient(config.Transport, config.TLSConfig)
+	if err != nil {
+		return nil, fmt.Errorf("consul TLS: %w", err)
+	}
+	httpClient.Transport = consulTransport{
+		base:     httpClient.Transport,
+		tracer:   tracer,
+		timeouts: options.Timeouts,
+		retry:    options.Retry,
+		breaker:  options.Breaker,
+	}
+	config.HttpClient = httpClient
+	return api.NewClient(config)
+}
+
+func queryOptions(ctx context.Context) *api.QueryOptions {
+	return (&api.QueryOptions{}).WithContext(ctx)
+}
+
+func writeOptions(ctx context.Context) *api.WriteOptions {
+	return (&api.WriteOptions{}).WithContext(ctx)
+}
+
+// consulTransport starts a span for every Consul API call, propagates the
+// trace context in the request headers and applies the timeout budget, which
+// covers all retries of the call.
+type consulTransport struct {
+	base     http.RoundTripper
+	tracer   trace.Tracer
+	timeouts StorageTimeouts
+	retry    RetryPolicy
+	breaker  *CircuitBreaker
+}
+
+func (t consulTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch {
+	case t.breaker == nil:
+		return t.roundTrip(req)
+	case req.URL.Query().Has("index"):
+		// Blocking queries are held for minutes, so they are not counted and
+		// never take the half-open trial call.
+		if !t.breaker.closed() {
+			return nil, model.ErrStorageUnavailable
+		}
+		return t.roundTrip(req)
+	}
+	generation, ok := t.breaker.allow()
+	if !ok {
+		return nil, model.ErrStorageUnavailable
+	}
+	resp, err := t.roundTrip(req)
+	t.judge(generation, req, resp, err)
+	return resp, err
+}
+
+// judge reports the outcome of a call let through in generation to the
+// breaker. Calls given up by the caller say nothing about Consul.
+func (t consulTransport) judge(generation uint64, req *http.Request, resp *http.Response, err error) {
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		t.breaker.release(generation)
+	case err != nil:
+		t.breaker.record(generation, false)
+	default:
+		t.breaker.record(generation, resp.StatusCode < 500)
+	}
+}
+
+func (t consulTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if budget := t.timeouts.budget(req); budget > 0 {
+		ctx, cancel = context.WithTimeout(ctx, budget)
+	}
+
+	ctx, span := t.tracer.Start(ctx, "Consul "+req.Method+" "+consulEndpoint(req.URL.Path),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "consul"),
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+			attribute.String("url.path", req.URL.Path),
+		),
+	)
+	defer span.End()
+
+	resp, err := t.send(ctx, req, span)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		cancel()
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	// Consul answers a missing key with 404, which is not a failed call.
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	// The budget also covers reading the body, so it ends when the client
+	// closes it rather than here.
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// send makes the call, retrying transient failures while the policy and the
+// context allow.
+func (t consulTransport) send(ctx context.Context, req *http.Request, span trace.Span) (*http.Response, error) {
+	for retry := 0; ; retry++ {
+		attempt := req.Clone(ctx)
+		if retry > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt.Body = body
+		}
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(attempt.Header))
+
+		resp, err := t.base.RoundTrip(attempt)
+		if retry+1 >= t.retry.Attempts || ctx.Err() != nil || !retryable(req, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(t.retry.backoff(retry + 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		span.SetAttributes(attribute.Int("http.request.resend_count", retry+1))
+	}
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// consulEndpoint trims the key from paths like /v1/kv/configs/db/v1.0 so span
+// names stay low-cardinality.
+func consulEndpoint(path string) string {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// storageAttributes tags a repository span with the Consul operation it
+// performs and the entity it works on.
+func storageAttributes(operation string, attrs ...attribute.KeyValue) trace.SpanStartOption {
+	return trace.WithAttributes(append([]attribute.KeyValue{
+		attribute.String("db.system", "consul"),
+		attribute.String("db.operation", operation),
+	}, attrs...)...)
+}
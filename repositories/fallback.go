@@ -0,0 +1,243 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"projekat/model"
+	"time"
+)
+
+// fallback serves reads while the storage circuit is open, from the cache or
+// the snapshot file, whichever holds the newer value. Responses built from it
+// are marked stale through the request context.
+type fallback struct {
+	keys     Keyspace
+	cache    *StorageCache
+	snapshot *SnapshotFile
+}
+
+func (f fallback) enabled() bool {
+	return f.cache != nil || f.snapshot != nil
+}
+
+// value decodes the last known value of key into target.
+func (f fallback) value(ctx context.Context, key string, target interface{}) bool {
+	var value []byte
+	var since time.Time
+	if f.cache != nil {
+		value, since, _ = f.cache.stale(key)
+	}
+	if f.snapshot != nil {
+		if snapshotValue, takenAt, ok := f.snapshot.stale(key); ok && (value == nil || takenAt.After(since)) {
+			value, since = snapshotValue, takenAt
+		}
+	}
+	if value == nil || json.Unmarshal(value, target) != nil {
+		return false
+	}
+	model.MarkStale(ctx, since)
+	return true
+}
+
+// fallbackList decodes every value under prefix. Only the snapshot has all
+// of them.
+func fallbackList[T any](ctx context.Context, f fallback, prefix string) ([]T, bool) {
+	if f.snapshot == nil {
+		return nil, false
+	}
+	values, takenAt, ok := f.snapshot.staleList(prefix)
+	if !ok {
+		return nil, false
+	}
+	items := make([]T, 0, len(values))
+	for _, value := range values {
+		var item T
+		if err := json.Unmarshal(value, &item); err != nil {
+			return nil, false
+		}
+		items = append(items, item)
+	}
+	model.MarkStale(ctx, takenAt)
+	return items, true
+}
+
+type fallbackConfigRepository struct {
+	next model.ConfigRepository
+	fallback
+}
+
+// FallbackConfigRepository answers reads with stale data from cache or
+// snapshot when repo fails because the storage circuit is open. Writes are
+// passed on and fail fast. It returns repo unchanged when both are nil.
+func FallbackConfigRepository(repo model.ConfigRepository, keys Keyspace, cache *StorageCache, snapshot *SnapshotFile) model.ConfigRepository {
+	f := fallback{keys, cache, snapshot}
+	if repo == nil || !f.enabled() {
+		return repo
+	}
+	return fallbackConfigRepository{repo, f}
+}
+
+func (r fallbackConfigRepository) GetConfig(name string, version float32, ctx context.Context) (*model.Config, error) {
+	config, err := r.next.GetConfig(name, version, ctx)
+	if errors.Is(err, model.ErrStorageUnavailable) {
+		stale := &model.Config{}
+		if r.value(ctx, r.keys.constructKey(model.NamespaceFromContext(ctx), name, version), stale) {
+			return stale, nil
+		}
+	}
+	return config, err
+}
+
+func (r fallbackConfigRepository) AddConfig(config *model.Config, ctx context.Context) error {
+	return r.next.AddConfig(config, ctx)
+}
+
+func (r fallbackConfigRepository) DeleteConfig(name string, version float32, ctx context.Context) error {
+	return r.next.DeleteConfig(name, version, ctx)
+}
+
+func (r fallbackConfigRepository) ListConfigs(ctx context.Context) ([]model.Config, error) {
+	configs, err := r.next.ListConfigs(ctx)
+	if errors.Is(err, model.ErrStorageUnavailable) {
+		if stale, ok := fallbackList[model.Config](ctx, r.fallback, r.keys.key(namespacePrefix(model.NamespaceFromContext(ctx))+configsPrefix)); ok {
+			return stale, nil
+		}
+	}
+	return configs, err
+}
+
+type fallbackConfigGroupRepository struct {
+	next model.ConfigGroupRepository
+	fallback
+}
+
+// FallbackConfigGroupRepository is FallbackConfigRepository for groups.
+func FallbackConfigGroupRepository(repo model.ConfigGroupRepository, keys Keyspace, cache *StorageCache, snapshot *SnapshotFile) model.ConfigGroupRepository {
+	f := fallback{keys, cache, snapshot}
+	if repo == nil || !f.enabled() {
+		return repo
+	}
+	return fallbackConfigGroupRepository{repo, f}
+}
+
+func (r fallbackConfigGroupRepository) GetConfigGroup(name string, version float32, ctx context.Context) (*model.ConfigGroup, error) {
+	group, err := r.next.GetConfigGroup(name, version, ctx)
+	if errors.Is(err, model.ErrStorageUnavailable) {
+		stale := &model.ConfigGroup{}
+		if r.value(ctx, r.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), name, version), stale) {
+			return stale, nil
+		}
+	}
+	return group, err
+}
+
+func (r fallbackConfigGroupRepository) AddConfigGroup(configGroup *model.ConfigGroup, ctx context.Context) error {
+	return r.next.AddConfigGroup(configGroup, ctx)
+}
+
+func (r fallbackConfigGroupRepository) DeleteConfigGroup(name string, version float32, ctx context.Context) error {
+	return r.next.DeleteConfigGroup(name, version, ctx)
+}
+
+func (r fallbackConfigGroupRepository) ListConfigGroups(ctx context.Context) ([]model.ConfigGroup, error) {
+	groups, err := r.next.ListConfigGroups(ctx)
+	if errors.Is(err, model.ErrStorageUnavailable) {
+		if stale, ok := fallbackList[model.ConfigGroup](ctx, r.fallback, r.keys.key(namespacePrefix(model.NamespaceFromContext(ctx))+configGroupsPrefix)); ok {
+			return stale, nil
+		}
+	}
+	return groups, err
+}
+
+type fallbackConfigForGroupRepository struct {
+	next model.ConfigForGroupRepository
+	fallback
+}
+
+// FallbackConfigForGroupRepository answers label queries from the last known
+// copy of the group while the storage circuit is open. Writes are passed on
+// and fail fast. It returns repo unchanged when cache and snapshot are nil.
+func FallbackConfigForGroupRepository(repo model.ConfigForGroupRepository, keys Keyspace, cache *StorageCache, snapshot *SnapshotFile) model.ConfigForGroupRepository {
+	f := fallback{keys, cache, snapshot}
+	if repo == nil || !f.enabled() {
+		return repo
+	}
+	return fallbackConfigForGroupRepository{repo, f}
+}
+
+func (r fallbackConfigForGroupRepository) AddToConfigGroup(config *model.ConfigForGroup, groupName string, groupVersion float32, ctx context.Context) error {
+	return r.next.AddToConfigGroup(config, groupName, groupVersion, ctx)
+}
+
+func (r fallbackConfigForGroupRepository) DeleteFromConfigGroup(configForGroupName string, groupName string, groupVersion float32, ctx context.Context) error {
+	return r.next.DeleteFromConfigGroup(configForGroupName, groupName, groupVersion, ctx)
+}
+
+func (r fallbackConfigForGroupRepository) GetConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) ([]model.ConfigForGroup, error) {
+	configs, err := r.next.GetConfigsByLabels(groupName, groupVersion, labels, ctx)
+	if errors.Is(err, model.ErrStorageUnavailable) {
+		var stale model.ConfigGroup
+		if r.value(ctx, r.keys.constructKeyForGroup(model.NamespaceFromContext(ctx), groupName, groupVersion), &stale) {
+			var matching []model.ConfigForGroup
+			for _, config := range stale.Configurations {
+				if labelsMatch1(config.Labels, labels) {
+					matching = append(matching, config)
+				}
+			}
+			return matching, nil
+		}
+	}
+	return configs, err
+}
+
+func (r fallbackConfigForGroupRepository) DeleteConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) error {
+	return r.next.DeleteConfigsByLabels(groupName, groupVersion, labels, ctx)
+}
+
+type fallbackNamespaceRepository struct {
+	next model.NamespaceRepository
+	fallback
+}
+
+// FallbackNamespaceRepository lets the namespace lookup of every request
+// succeed from the snapshot while the storage circuit is open.
+func FallbackNamespaceRepository(repo model.NamespaceRepository, keys Keyspace, snapshot *SnapshotFile) model.NamespaceRepository {
+	if repo == nil || snapshot == nil {
+		return repo
+	}
+	return fallbackNamespaceRepository{repo, fallback{keys: keys, snapshot: snapshot}}
+}
+
+func (r fallbackNamespaceRepository) GetNamespace(name string, ctx context.Context) (*model.Namespace, error) {
+	namespace, err := r.next.GetNamespace(name, ctx)
+	if errors.Is(err, model.ErrStorageUnavailable) {
+		stale := &model.Namespace{}
+		if r.value(ctx, r.keys.constructNamespaceKey(name), stale) {
+			return stale, nil
+		}
+	}
+	return namespace, err
+}
+
+func (r fallbackNamespaceRepository) ListNamespaces(ctx context.Context) ([]model.Namespace, error) {
+	namespaces, err := r.next.ListNamespaces(ctx)
+	if errors.Is(err, model.ErrStorageUnavailable) {
+		if stale, ok := fallbackList[model.Namespace](ctx, r.fallback, r.keys.key(namespacesPrefix)); ok {
+			return stale, nil
+		}
+	}
+	return namespaces, err
+}
+
+func (r fallbackNamespaceRepository) AddNamespace(namespace *model.Namespace, ctx context.Context) error {
+	return r.next.AddNamespace(namespace, ctx)
+}
+
+func (r fallbackNamespaceRepository) DeleteNamespace(name string, ctx context.Context) error {
+	return r.next.DeleteNamespace(name, ctx)
+}
+
+func (r fallbackNamespaceRepository) IsNamespaceEmpty(name string, ctx context.Context) (bool, error) {
+	return r.next.IsNamespaceEmpty(name, ctx)
+}
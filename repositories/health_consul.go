@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/hashicorp/consul/api"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"os"
+	"projekat/model"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type HealthConsulRepository struct {
+	cli      *api.Client
+	logger   *slog.Logger
+	Tracer   trace.Tracer
+	probeKey string
+}
+
+func NewHealth(client *api.Client, keys Keyspace, logger *slog.Logger, tracer trace.Tracer) *HealthConsulRepository {
+	// Each replica probes its own key so they do not overwrite each other.
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "unknown"
+	}
+	return &HealthConsulRepository{cli: client, logger: logger, Tracer: tracer, probeKey: keys.constructHealthProbeKey(instance)}
+}
+
+func (h HealthConsulRepository) CheckLeader(ctx context.Context) error {
+	ctx, span := h.Tracer.Start(ctx, "HealthConsulRepository.CheckLeader", storageAttributes("leader"))
+	defer span.End()
+
+	leader, err := h.cli.Status().LeaderWithQueryOptions(queryOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if leader == "" {
+		err := errors.New("consul has no leader")
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "")
+	return nil
+}
+
+func (h HealthConsulRepository) CheckReadWrite(ctx context.Context) error {
+	ctx, span := h.Tracer.Start(ctx, "HealthConsulRepository.CheckReadWrite", storageAttributes("put", model.AttrStorageKey.String(h.probeKey)))
+	defer span.End()
+
+	value := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+	if _, err := h.cli.KV().Put(&api.KVPair{Key: h.probeKey, Value: value}, writeOptions(ctx)); err != nil {
+		h.logger.DebugContext(ctx, "Health probe write failed", "key", h.probeKey, "error", err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	pair, _, err := h.cli.KV().Get(h.probeKey, queryOptions(ctx))
+	if err != nil {
+		h.logger.DebugContext(ctx, "Health probe read failed", "key", h.probeKey, "error", err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if pair == nil || !bytes.Equal(pair.Value, value) {
+		err := errors.New("health probe read back a different value")
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "")
+	return nil
+}
+
+type sharedHealthRepository struct {
+	model.HealthRepository
+	ttl time.Duration
+
+	mu        sync.Mutex
+	probe     *healthProbe
+	checkedAt time.Time
+	err       error
+}
+
+type healthProbe struct {
+	done chan struct{}
+	err  error
+}
+
+// ShareHealthRepository runs at most one read-write probe at a time and
+// answers from its result for ttl, so frequent /readyz and /health requests
+// do not each write to storage. Leader checks are passed on.
+func ShareHealthRepository(repo model.HealthRepository, ttl time.Duration) model.HealthRepository {
+	if repo == nil {
+		return repo
+	}
+	return &sharedHealthRepository{HealthRepository: repo, ttl: ttl}
+}
+
+func (r *sharedHealthRepository) CheckReadWrite(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.checkedAt.IsZero() && time.Since(r.checkedAt) < r.ttl {
+		err := r.err
+		r.mu.Unlock()
+		return err
+	}
+	probe := r.probe
+	if probe == nil {
+		probe = &healthProbe{done: make(chan struct{})}
+		r.probe = probe
+		go r.run(ctx, probe)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-probe.done:
+		return probe.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run probes storage for every waiting caller. The probe keeps the deadline
+// of the caller that started it but not its cancellation, which would fail
+// the others.
+func (r *sharedHealthRepository) run(ctx context.Context, probe *healthProbe) {
+	probeCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		probeCtx, cancel = context.WithDeadline(probeCtx, deadline)
+		defer cancel()
+	}
+	probe.err = r.HealthRepository.CheckReadWrite(probeCtx)
+
+	r.mu.Lock()
+	r.probe, r.checkedAt, r.err = nil, time.Now(), probe.err
+	r.mu.Unlock()
+	close(probe.done)
+}
@@ -1,19 +1,81 @@
 package repositories
 
-import "fmt"
+import (
+	"fmt"
+	"projekat/model"
+	"strings"
+)
 
 const (
 	configs             = "configs/%s/v%.1f"
+	configsPrefix       = "configs/"
 	configGroups        = "configGroups/%s/v%.1f"
+	configGroupsPrefix  = "configGroups/"
 	configsByLabels     = "configGroup/%s/v%.1f/%s"
 	idempotencyRequests = "idempotency_requests/%s/"
+	rateLimits          = "rateLimits/%s"
+	auditEvents         = "audit/events/%020d"
+	auditEventsPrefix   = "audit/events/"
+	auditHead           = "audit/head"
+	namespaces          = "namespaces/%s"
+	namespacesPrefix    = "namespaces/"
+	namespaceData       = "ns/%s/"
+	healthProbes        = "health/%s"
+	layoutMarker        = "layout"
+	migrationMarker     = "migration"
 )
 
-func constructKey(name string, version float32) string {
-	return fmt.Sprintf(configs, name, version)
+// Keyspace roots every key the service stores under a prefix, so several
+// environments or applications can share one Consul cluster. The zero value
+// keeps the keys at the root of the KV store.
+type Keyspace struct {
+	prefix string
+}
+
+// NewKeyspace returns the keyspace rooted at prefix, e.g. "staging/alati".
+// Leading and trailing slashes are ignored.
+func NewKeyspace(prefix string) Keyspace {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return Keyspace{}
+	}
+	return Keyspace{prefix: prefix + "/"}
+}
+
+// Prefix returns the root prefix including its trailing slash.
+func (k Keyspace) Prefix() string {
+	return k.prefix
+}
+
+func (k Keyspace) key(key string) string {
+	return k.prefix + key
+}
+
+// namespacePrefix is prepended to every config, group and idempotency key.
+// The default namespace keeps the original root-level keys.
+func namespacePrefix(namespace string) string {
+	if namespace == "" || namespace == model.DefaultNamespace {
+		return ""
+	}
+	return fmt.Sprintf(namespaceData, namespace)
+}
+
+// holdsConfigOrGroup reports whether key, a full key in k, holds a config or
+// a group in any namespace, as opposed to the idempotency records and label
+// indexes stored alongside them.
+func (k Keyspace) holdsConfigOrGroup(key string) bool {
+	key = strings.TrimPrefix(key, k.prefix)
+	if rest, ok := strings.CutPrefix(key, layoutRoot(namespaceData)); ok {
+		_, key, _ = strings.Cut(rest, "/")
+	}
+	return strings.HasPrefix(key, configsPrefix) || strings.HasPrefix(key, configGroupsPrefix)
+}
+
+func (k Keyspace) constructKey(namespace string, name string, version float32) string {
+	return k.prefix + namespacePrefix(namespace) + fmt.Sprintf(configs, name, version)
 }
 
-func constructKeyConfigsByLabels(groupName string, groupVersion float32, labels map[string]string) string {
+func (k Keyspace) constructKeyConfigsByLabels(namespace string, groupName string, groupVersion float32, labels map[string]string) string {
 	labelsStr := ""
 	for key, value := range labels {
 		labelsStr += fmt.Sprintf("%s:%s/", key, value)
@@ -21,13 +83,45 @@ func constructKeyConfigsByLabels(groupName string, groupVersion float32, labels
 	if len(labelsStr) > 0 {
 		labelsStr = labelsStr[:len(labelsStr)-1]
 	}
-	return fmt.Sprintf(configsByLabels, groupName, groupVersion, labelsStr)
+	return k.prefix + namespacePrefix(namespace) + fmt.Sprintf(configsByLabels, groupName, groupVersion, labelsStr)
+}
+
+func (k Keyspace) constructIdempotencyRequestKey(namespace string, key string) string {
+	return k.prefix + namespacePrefix(namespace) + fmt.Sprintf(idempotencyRequests, key)
+}
+
+func (k Keyspace) constructKeyForGroup(namespace string, name string, version float32) string {
+	return k.prefix + namespacePrefix(namespace) + fmt.Sprintf(configGroups, name, version)
+}
+
+func (k Keyspace) constructRateLimitKey(key string) string {
+	return k.prefix + fmt.Sprintf(rateLimits, key)
+}
+
+func (k Keyspace) constructAuditEventKey(sequence uint64) string {
+	return k.prefix + fmt.Sprintf(auditEvents, sequence)
+}
+
+func (k Keyspace) constructNamespaceKey(name string) string {
+	return k.prefix + fmt.Sprintf(namespaces, name)
+}
+
+func (k Keyspace) constructHealthProbeKey(instance string) string {
+	return k.prefix + fmt.Sprintf(healthProbes, instance)
+}
+
+// notFoundError keeps the message of a missing-entry error while matching
+// model.ErrNotFound.
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
 }
 
-func constructIdempotencyRequestKey(key string) string {
-	return fmt.Sprintf(idempotencyRequests, key)
+func (e notFoundError) Is(target error) bool {
+	return target == model.ErrNotFound
 }
 
-func constructKeyForGroup(name string, version float32) string {
-	return fmt.Sprintf(configGroups, name, version)
+func notFound(format string, args ...interface{}) error {
+	return notFoundError(fmt.Sprintf(format, args...))
 }
@@ -0,0 +1,400 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"projekat/metrics"
+	"projekat/model"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errorType buckets repository errors.
+func errorType(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, model.ErrStorageUnavailable):
+		return "unavailable"
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "unavailable"
+	case errors.Is(err, model.ErrNotFound):
+		return "not_found"
+	default:
+		return "other"
+	}
+}
+
+// payloadSampleEvery is how often payload sizes are measured: the first
+// call of each operation and every payloadSampleEvery-th one after it, since
+// measuring means marshalling the whole value again.
+const payloadSampleEvery = 16
+
+type instrumentation struct {
+	metrics    *metrics.Storage
+	backend    string
+	repository string
+	calls      *sync.Map
+}
+
+func newInstrumentation(metrics *metrics.Storage, backend string, repository string) instrumentation {
+	return instrumentation{metrics: metrics, backend: backend, repository: repository, calls: &sync.Map{}}
+}
+
+func (i instrumentation) observe(operation string, start time.Time, err error) {
+	i.metrics.Duration.WithLabelValues(i.backend, i.repository, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		i.metrics.Errors.WithLabelValues(i.backend, i.repository, operation, errorType(err)).Inc()
+	}
+}
+
+func (i instrumentation) payload(operation string, value interface{}) {
+	counter, _ := i.calls.LoadOrStore(operation, &atomic.Uint64{})
+	if counter.(*atomic.Uint64).Add(1)%payloadSampleEvery != 1 {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	i.metrics.PayloadSize.WithLabelValues(i.backend, i.repository, operation).Observe(float64(len(data)))
+}
+
+type instrumentedConfigRepository struct {
+	next model.ConfigRepository
+	instrumentation
+}
+
+// InstrumentConfigRepository wraps repo so every call is measured. It returns
+// repo unchanged when metrics is nil.
+func InstrumentConfigRepository(repo model.ConfigRepository, backend string, metrics *metrics.Storage) model.ConfigRepository {
+	if metrics == nil || repo == nil {
+		return repo
+	}
+	return instrumentedConfigRepository{repo, newInstrumentation(metrics, backend, "config")}
+}
+
+func (r instrumentedConfigRepository) GetConfig(name string, version float32, ctx context.Context) (*model.Config, error) {
+	start := time.Now()
+	config, err := r.next.GetConfig(name, version, ctx)
+	r.observe("get", start, err)
+	if err == nil {
+		r.payload("get", config)
+	}
+	return config, err
+}
+
+func (r instrumentedConfigRepository) AddConfig(config *model.Config, ctx context.Context) error {
+	start := time.Now()
+	err := r.next.AddConfig(config, ctx)
+	r.observe("add", start, err)
+	r.payload("add", config)
+	return err
+}
+
+func (r instrumentedConfigRepository) DeleteConfig(name string, version float32, ctx context.Context) error {
+	start := time.Now()
+	err := r.next.DeleteConfig(name, version, ctx)
+	r.observe("delete", start, err)
+	return err
+}
+
+func (r instrumentedConfigRepository) ListConfigs(ctx context.Context) ([]model.Config, error) {
+	start := time.Now()
+	configs, err := r.next.ListConfigs(ctx)
+	r.observe("list", start, err)
+	if err == nil {
+		r.payload("list", configs)
+	}
+	return configs, err
+}
+
+type instrumentedConfigGroupRepository struct {
+	next model.ConfigGroupRepository
+	instrumentation
+}
+
+func InstrumentConfigGroupRepository(repo model.ConfigGroupRepository, backend string, metrics *metrics.Storage) model.ConfigGroupRepository {
+	if metrics == nil || repo == nil {
+		return repo
+	}
+	return instrumentedConfigGroupRepository{repo, newInstrumentation(metrics, backend, "config_group")}
+}
+
+func (r instrumentedConfigGroupRepository) GetConfigGroup(name string, version float32, ctx context.Context) (*model.ConfigGroup, error) {
+	start := time.Now()
+	group, err := r.next.GetConfigGroup(name, version, ctx)
+	r.observe("get", start, err)
+	if err == nil {
+		r.payload("get", group)
+	}
+	return group, err
+}
+
+func (r instrumentedConfigGroupRepository) AddConfigGroup(configGroup *model.ConfigGroup, ctx context.Context) error {
+	start := time.Now()
+	err := r.next.AddConfigGroup(configGroup, ctx)
+	r.observe("add", start, err)
+	r.payload("add", configGroup)
+	return err
+}
+
+func (r instrumentedConfigGroupRepository) DeleteConfigGroup(name string, version float32, ctx context.Context) error {
+	start := time.Now()
+	err := r.next.DeleteConfigGroup(name, version, ctx)
+	r.observe("delete", start, err)
+	return err
+}
+
+func (r instrumentedConfigGroupRepository) ListConfigGroups(ctx context.Context) ([]model.ConfigGroup, error) {
+	start := time.Now()
+	groups, err := r.next.ListConfigGroups(ctx)
+	r.observe("list", start, err)
+	if err == nil {
+		r.payload("list", groups)
+	}
+	return groups, err
+}
+
+type instrumentedConfigForGroupRepository struct {
+	next model.ConfigForGroupRepository
+	instrumentation
+}
+
+func InstrumentConfigForGroupRepository(repo model.ConfigForGroupRepository, backend string, metrics *metrics.Storage) model.ConfigForGroupRepository {
+	if metrics == nil || repo == nil {
+		return repo
+	}
+	return instrumentedConfigForGroupRepository{repo, newInstrumentation(metrics, backend, "config_for_group")}
+}
+
+func (r instrumentedConfigForGroupRepository) AddToConfigGroup(config *model.ConfigForGroup, groupName string, groupVersion float32, ctx context.Context) error {
+	start := time.Now()
+	err := r.next.AddToConfigGroup(config, groupName, groupVersion, ctx)
+	r.observe("add", start, err)
+	r.payload("add", config)
+	return err
+}
+
+func (r instrumentedConfigForGroupRepository) DeleteFromConfigGroup(configForGroupName string, groupName string, groupVersion float32, ctx context.Context) error {
+	start := time.Now()
+	err := r.next.DeleteFromConfigGroup(configForGroupName, groupName, groupVersion, ctx)
+	r.observe("delete", start, err)
+	return err
+}
+
+func (r instrumentedConfigForGroupRepository) GetConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) ([]model.ConfigForGroup, error) {
+	start := time.Now()
+	configs, err := r.next.GetConfigsByLabels(groupName, groupVersion, labels, ctx)
+	r.observe("get_by_labels", start, err)
+	if err == nil {
+		r.payload("get_by_labels", configs)
+	}
+	return configs, err
+}
+
+func (r instrumentedConfigForGroupRepository) DeleteConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) error {
+	start := time.Now()
+	err := r.next.DeleteConfigsByLabels(groupName, groupVersion, labels, ctx)
+	r.observe("delete_by_labels", start, err)
+	return err
+}
+
+type instrumentedAuditRepository struct {
+	next model.AuditRepository
+	instrumentation
+}
+
+func InstrumentAuditRepository(repo model.AuditRepository, backend string, metrics *metrics.Storage) model.AuditRepository {
+	if metrics == nil || repo == nil {
+		return repo
+	}
+	return instrumentedAuditRepository{repo, newInstrumentation(metrics, backend, "audit")}
+}
+
+func (r instrumentedAuditRepository) GetHead(ctx context.Context) (*model.AuditHead, uint64, error) {
+	start := time.Now()
+	head, index, err := r.next.GetHead(ctx)
+	r.observe("get_head", start, err)
+	return head, index, err
+}
+
+func (r instrumentedAuditRepository) Append(event *model.AuditEvent, headIndex uint64, ctx context.Context) (bool, error) {
+	start := time.Now()
+	ok, err := r.next.Append(event, headIndex, ctx)
+	r.observe("append", start, err)
+	r.payload("append", event)
+	return ok, err
+}
+
+func (r instrumentedAuditRepository) ListEvents(ctx context.Context) ([]model.AuditEvent, error) {
+	start := time.Now()
+	events, err := r.next.ListEvents(ctx)
+	r.observe("list", start, err)
+	if err == nil {
+		r.payload("list", events)
+	}
+	return events, err
+}
+
+func (r instrumentedAuditRepository) ListEventRange(first uint64, last uint64, ctx context.Context) ([]model.AuditEvent, error) {
+	start := time.Now()
+	events, err := r.next.ListEventRange(first, last, ctx)
+	r.observe("list_range", start, err)
+	if err == nil {
+		r.payload("list_range", events)
+	}
+	return events, err
+}
+
+type instrumentedNamespaceRepository struct {
+	next model.NamespaceRepository
+	instrumentation
+}
+
+func InstrumentNamespaceRepository(repo model.NamespaceRepository, backend string, metrics *metrics.Storage) model.NamespaceRepository {
+	if metrics == nil || repo == nil {
+		return repo
+	}
+	return instrumentedNamespaceRepository{repo, newInstrumentation(metrics, backend, "namespace")}
+}
+
+func (r instrumentedNamespaceRepository) GetNamespace(name string, ctx context.Context) (*model.Namespace, error) {
+	start := time.Now()
+	namespace, err := r.next.GetNamespace(name, ctx)
+	r.observe("get", start, err)
+	if err == nil {
+		r.payload("get", namespace)
+	}
+	return namespace, err
+}
+
+func (r instrumentedNamespaceRepository) ListNamespaces(ctx context.Context) ([]model.Namespace, error) {
+	start := time.Now()
+	namespaces, err := r.next.ListNamespaces(ctx)
+	r.observe("list", start, err)
+	if err == nil {
+		r.payload("list", namespaces)
+	}
+	return namespaces, err
+}
+
+func (r instrumentedNamespaceRepository) AddNamespace(namespace *model.Namespace, ctx context.Context) error {
+	start := time.Now()
+	err := r.next.AddNamespace(namespace, ctx)
+	r.observe("add", start, err)
+	r.payload("add", namespace)
+	return err
+}
+
+func (r instrumentedNamespaceRepository) DeleteNamespace(name string, ctx context.Context) error {
+	start := time.Now()
+	err := r.next.DeleteNamespace(name, ctx)
+	r.observe("delete", start, err)
+	return err
+}
+
+func (r instrumentedNamespaceRepository) IsNamespaceEmpty(name string, ctx context.Context) (bool, error) {
+	start := time.Now()
+	empty, err := r.next.IsNamespaceEmpty(name, ctx)
+	r.observe("is_empty", start, err)
+	return empty, err
+}
+
+type instrumentedRateLimitRepository struct {
+	next model.RateLimitRepository
+	instrumentation
+}
+
+func InstrumentRateLimitRepository(repo model.RateLimitRepository, backend string, metrics *metrics.Storage) model.RateLimitRepository {
+	if metrics == nil || repo == nil {
+		return repo
+	}
+	return instrumentedRateLimitRepository{repo, newInstrumentation(metrics, backend, "rate_limit")}
+}
+
+func (r instrumentedRateLimitRepository) GetCounter(key string, ctx context.Context) (uint64, uint64, error) {
+	start := time.Now()
+	count, index, err := r.next.GetCounter(key, ctx)
+	r.observe("get_counter", start, err)
+	return count, index, err
+}
+
+func (r instrumentedRateLimitRepository) SetCounter(key string, count uint64, index uint64, ctx context.Context) (bool, error) {
+	start := time.Now()
+	ok, err := r.next.SetCounter(key, count, index, ctx)
+	r.observe("set_counter", start, err)
+	return ok, err
+}
+
+func (r instrumentedRateLimitRepository) DeleteCounter(key string, ctx context.Context) error {
+	start := time.Now()
+	err := r.next.DeleteCounter(key, ctx)
+	r.observe("delete_counter", start, err)
+	return err
+}
+
+type instrumentedIdempotencyRepository struct {
+	next model.IdempotencyRepository
+	instrumentation
+}
+
+func InstrumentIdempotencyRepository(repo model.IdempotencyRepository, backend string, metrics *metrics.Storage) model.IdempotencyRepository {
+	if metrics == nil || repo == nil {
+		return repo
+	}
+	return instrumentedIdempotencyRepository{repo, newInstrumentation(metrics, backend, "idempotency")}
+}
+
+func (r instrumentedIdempotencyRepository) AddIdempotencyRequest(req *model.IdempotencyRequest, ctx context.Context) (*model.IdempotencyRequest, error) {
+	start := time.Now()
+	added, err := r.next.AddIdempotencyRequest(req, ctx)
+	r.observe("add", start, err)
+	r.payload("add", req)
+	return added, err
+}
+
+func (r instrumentedIdempotencyRepository) GetIdempotencyRequestByKey(key string, ctx context.Context) (*model.IdempotencyRequest, error) {
+	start := time.Now()
+	req, err := r.next.GetIdempotencyRequestByKey(key, ctx)
+	r.observe("get", start, err)
+	if err == nil && req != nil {
+		r.payload("get", req)
+	}
+	return req, err
+}
+
+type instrumentedHealthRepository struct {
+	next model.HealthRepository
+	instrumentation
+}
+
+func InstrumentHealthRepository(repo model.HealthRepository, backend string, metrics *metrics.Storage) model.HealthRepository {
+	if metrics == nil || repo == nil {
+		return repo
+	}
+	return instrumentedHealthRepository{repo, newInstrumentation(metrics, backend, "health")}
+}
+
+func (r instrumentedHealthRepository) CheckLeader(ctx context.Context) error {
+	start := time.Now()
+	err := r.next.CheckLeader(ctx)
+	r.observe("check_leader", start, err)
+	return err
+}
+
+func (r instrumentedHealthRepository) CheckReadWrite(ctx context.Context) error {
+	start := time.Now()
+	err := r.next.CheckReadWrite(ctx)
+	r.observe("check_read_write", start, err)
+	return err
+}
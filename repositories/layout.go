@@ -0,0 +1,281 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/consul/api"
+	"strings"
+)
+
+// LayoutVersion is the version of the key layout this build reads and writes.
+// It is recorded in a marker key under the keyspace prefix.
+const LayoutVersion = 1
+
+// maxTxnOps is the number of operations Consul accepts in one transaction.
+const maxTxnOps = 64
+
+// ErrLayoutVersion is returned when the keyspace holds data of a layout this
+// build does not use.
+var ErrLayoutVersion = errors.New("unsupported storage layout version")
+
+// layoutRoots are the top-level prefixes holding the service's data. Health
+// probes are left out because every replica rewrites its own.
+var layoutRoots = []string{
+	configsPrefix,
+	configGroupsPrefix,
+	layoutRoot(configsByLabels),
+	layoutRoot(idempotencyRequests),
+	layoutRoot(rateLimits),
+	layoutRoot(auditEvents),
+	namespacesPrefix,
+	layoutRoot(namespaceData),
+}
+
+// layoutUpgrades rewrite a key of layout version v into version v+1, indexed
+// by v. Add an entry when LayoutVersion is bumped; a nil entry keeps the key.
+var layoutUpgrades = map[int]func(key string) string{}
+
+type layoutMarkerValue struct {
+	Version int `json:"version"`
+}
+
+func layoutRoot(format string) string {
+	return format[:strings.Index(format, "/")+1]
+}
+
+// readLayout returns the layout version recorded in the keyspace, or found
+// false if there is no marker.
+func readLayout(ctx context.Context, client *api.Client, keys Keyspace) (int, bool, error) {
+	pair, _, err := client.KV().Get(keys.key(layoutMarker), queryOptions(ctx))
+	if err != nil {
+		return 0, false, err
+	}
+	if pair == nil {
+		return 0, false, nil
+	}
+	var marker layoutMarkerValue
+	if err := json.Unmarshal(pair.Value, &marker); err != nil {
+		return 0, false, fmt.Errorf("layout marker %s: %w", pair.Key, err)
+	}
+	return marker.Version, true, nil
+}
+
+func writeLayout(ctx context.Context, client *api.Client, keys Keyspace, index uint64) (bool, error) {
+	data, err := json.Marshal(layoutMarkerValue{Version: LayoutVersion})
+	if err != nil {
+		return false, err
+	}
+	ok, _, err := client.KV().CAS(&api.KVPair{Key: keys.key(layoutMarker), Value: data, ModifyIndex: index}, writeOptions(ctx))
+	return ok, err
+}
+
+// EnsureLayout checks that the keyspace uses the layout of this build and
+// records it if the keyspace has no marker yet. Data written before the
+// marker existed already uses layout version 1.
+func EnsureLayout(ctx context.Context, client *api.Client, keys Keyspace) error {
+	version, found, err := readLayout(ctx, client, keys)
+	if err != nil {
+		return err
+	}
+	if !found {
+		ok, err := writeLayout(ctx, client, keys, 0)
+		if err != nil || ok {
+			return err
+		}
+		// Another replica wrote the marker first.
+		if version, _, err = readLayout(ctx, client, keys); err != nil {
+			return err
+		}
+	}
+	if version != LayoutVersion {
+		return fmt.Errorf("%w: keys under %q use layout version %d, this build uses %d; run the migrate-keys command",
+			ErrLayoutVersion, keys.Prefix(), version, LayoutVersion)
+	}
+	return nil
+}
+
+// MigrationResult reports what Migrate moved.
+type MigrationResult struct {
+	// FromVersion is the layout version the source was written with.
+	FromVersion int
+	Keys        int
+	// Resumed is set when an interrupted migration was continued.
+	Resumed bool
+}
+
+type migrationMarkerValue struct {
+	From string `json:"from"`
+}
+
+// Migrate moves the service's data from one keyspace to another, upgrading
+// the keys to the current layout on the way, and records the layout version
+// in the target. The target must not hold any data yet. Keys are copied
+// before any are deleted, so an interrupted migration leaves the source
+// intact; a source key that changes during the migration fails the delete
+// step instead of being lost.
+//
+// A marker in the target records the migration while it runs. Running
+// Migrate again with the same source after a failure resumes it: keys that
+// were already copied are kept, and the rest are copied and deleted.
+func Migrate(ctx context.Context, client *api.Client, from Keyspace, to Keyspace) (MigrationResult, error) {
+	result := MigrationResult{FromVersion: LayoutVersion}
+	if from == to {
+		return result, errors.New("source and target keyspace are the same")
+	}
+	for _, root := range layoutRoots {
+		source, target := from.key(root), to.key(root)
+		if strings.HasPrefix(source, target) || strings.HasPrefix(target, source) {
+			return result, fmt.Errorf("keyspaces %q and %q overlap", from.Prefix(), to.Prefix())
+		}
+	}
+
+	version, found, err := readLayout(ctx, client, from)
+	if err != nil {
+		return result, err
+	}
+	if found {
+		result.FromVersion = version
+	}
+	if result.FromVersion > LayoutVersion {
+		return result, fmt.Errorf("%w: keys under %q use layout version %d, this build only knows up to %d",
+			ErrLayoutVersion, from.Prefix(), result.FromVersion, LayoutVersion)
+	}
+
+	result.Resumed, err = startMigration(ctx, client, from, to)
+	if err != nil {
+		return result, err
+	}
+
+	var pairs api.KVPairs
+	existing := make(map[string]*api.KVPair)
+	for _, root := range layoutRoots {
+		list, _, err := client.KV().List(from.key(root), queryOptions(ctx))
+		if err != nil {
+			return result, err
+		}
+		pairs = append(pairs, list...)
+		copied, _, err := client.KV().List(to.key(root), queryOptions(ctx))
+		if err != nil {
+			return result, err
+		}
+		for _, pair := range copied {
+			existing[pair.Key] = pair
+		}
+	}
+
+	copies := make(api.KVTxnOps, 0, len(pairs))
+	deletes := make(api.KVTxnOps, 0, len(pairs))
+	for _, pair := range pairs {
+		key := strings.TrimPrefix(pair.Key, from.Prefix())
+		for v := result.FromVersion; v < LayoutVersion; v++ {
+			if upgrade := layoutUpgrades[v]; upgrade != nil {
+				key = upgrade(key)
+			}
+		}
+		deletes = append(deletes, &api.KVTxnOp{Verb: api.KVDeleteCAS, Key: pair.Key, Index: pair.ModifyIndex})
+		if copied, ok := existing[to.key(key)]; ok {
+			// Copied by an earlier, interrupted run.
+			if !bytes.Equal(copied.Value, pair.Value) || copied.Flags != pair.Flags {
+				return result, fmt.Errorf("target key %s differs from source key %s", copied.Key, pair.Key)
+			}
+			continue
+		}
+		copies = append(copies, &api.KVTxnOp{Verb: api.KVCAS, Key: to.key(key), Value: pair.Value, Flags: pair.Flags, Index: 0})
+	}
+
+	if err := runTxn(ctx, client, copies); err != nil {
+		return result, fmt.Errorf("copying keys, run the migration again to resume: %w", err)
+	}
+	ok, err := writeLayout(ctx, client, to, 0)
+	if err != nil {
+		return result, err
+	}
+	if !ok {
+		// Written by a resumed run, or by a replica started against the
+		// empty target.
+		if version, _, err := readLayout(ctx, client, to); err != nil || version != LayoutVersion {
+			return result, fmt.Errorf("%w: target keyspace %q was marked with layout version %d", ErrLayoutVersion, to.Prefix(), version)
+		}
+	}
+	if err := runTxn(ctx, client, deletes); err != nil {
+		return result, fmt.Errorf("deleting source keys, run the migration again to resume: %w", err)
+	}
+	if _, err := client.KV().Delete(from.key(layoutMarker), writeOptions(ctx)); err != nil {
+		return result, err
+	}
+	if _, err := client.KV().Delete(to.key(migrationMarker), writeOptions(ctx)); err != nil {
+		return result, err
+	}
+	result.Keys = len(pairs)
+	return result, nil
+}
+
+// startMigration records a migration from one keyspace into another, which
+// must not hold data yet, and reports whether an earlier migration from the
+// same source was interrupted instead.
+func startMigration(ctx context.Context, client *api.Client, from Keyspace, to Keyspace) (bool, error) {
+	pair, _, err := client.KV().Get(to.key(migrationMarker), queryOptions(ctx))
+	if err != nil {
+		return false, err
+	}
+	if pair != nil {
+		var marker migrationMarkerValue
+		if err := json.Unmarshal(pair.Value, &marker); err != nil {
+			return false, fmt.Errorf("migration marker %s: %w", pair.Key, err)
+		}
+		if marker.From != from.Prefix() {
+			return false, fmt.Errorf("target keyspace %q is being migrated from %q", to.Prefix(), marker.From)
+		}
+		return true, nil
+	}
+
+	for _, root := range layoutRoots {
+		existing, _, err := client.KV().Keys(to.key(root), "", queryOptions(ctx))
+		if err != nil {
+			return false, err
+		}
+		if len(existing) > 0 {
+			return false, fmt.Errorf("target keyspace %q already holds data under %s", to.Prefix(), root)
+		}
+	}
+	data, err := json.Marshal(migrationMarkerValue{From: from.Prefix()})
+	if err != nil {
+		return false, err
+	}
+	ok, _, err := client.KV().CAS(&api.KVPair{Key: to.key(migrationMarker), Value: data}, writeOptions(ctx))
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, fmt.Errorf("another migration into %q has started", to.Prefix())
+	}
+	return false, nil
+}
+
+// runTxn applies ops in transactions of at most maxTxnOps operations.
+func runTxn(ctx context.Context, client *api.Client, ops api.KVTxnOps) error {
+	for len(ops) > 0 {
+		batch := ops[:min(len(ops), maxTxnOps)]
+		ops = ops[len(batch):]
+		ok, response, _, err := client.KV().Txn(batch, queryOptions(ctx))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return txnError(batch, response)
+		}
+	}
+	return nil
+}
+
+// txnError describes why Consul rolled back the transaction ops.
+func txnError(ops api.KVTxnOps, response *api.KVTxnResponse) error {
+	if response != nil && len(response.Errors) > 0 {
+		failed := response.Errors[0]
+		return fmt.Errorf("key %s: %s", ops[failed.OpIndex].Key, failed.What)
+	}
+	return errors.New("transaction rolled back")
+}
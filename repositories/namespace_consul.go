@@ -0,0 +1,150 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hashicorp/consul/api"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"projekat/model"
+)
+
+type NamespaceConsulRepository struct {
+	cli    *api.Client
+	keys   Keyspace
+	logger *slog.Logger
+	Tracer trace.Tracer
+}
+
+func NewNS(client *api.Client, keys Keyspace, logger *slog.Logger, tracer trace.Tracer) *NamespaceConsulRepository {
+	return &NamespaceConsulRepository{cli: client, keys: keys, logger: logger, Tracer: tracer}
+}
+
+// swagger:route GET /ns/{namespace}/ namespace getNamespace
+// Get namespace
+//
+// responses:
+//
+//	404: ErrorResponse
+//	200: Namespace
+func (n NamespaceConsulRepository) GetNamespace(name string, ctx context.Context) (*model.Namespace, error) {
+	ctx, span := n.Tracer.Start(ctx, "NamespaceConsulRepository.GetNamespace", storageAttributes("get", model.AttrNamespace.String(name), model.AttrStorageKey.String(n.keys.constructNamespaceKey(name))))
+	defer span.End()
+
+	pair, _, err := n.cli.KV().Get(n.keys.constructNamespaceKey(name), queryOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if pair == nil {
+		err := notFound("namespace '%s' not found", name)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(model.AttrValueSize.Int(len(pair.Value)))
+	namespace := &model.Namespace{}
+	if err := json.Unmarshal(pair.Value, namespace); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Success getting namespace")
+	return namespace, nil
+}
+
+// swagger:route GET /ns/ namespace listNamespaces
+// List namespaces
+//
+// responses:
+//
+//	200: []Namespace
+func (n NamespaceConsulRepository) ListNamespaces(ctx context.Context) ([]model.Namespace, error) {
+	ctx, span := n.Tracer.Start(ctx, "NamespaceConsulRepository.ListNamespaces", storageAttributes("list", model.AttrStorageKey.String(n.keys.key(namespacesPrefix))))
+	defer span.End()
+
+	pairs, _, err := n.cli.KV().List(n.keys.key(namespacesPrefix), queryOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	namespaces := make([]model.Namespace, 0, len(pairs))
+	for _, pair := range pairs {
+		var namespace model.Namespace
+		if err := json.Unmarshal(pair.Value, &namespace); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		namespaces = append(namespaces, namespace)
+	}
+
+	span.SetAttributes(model.AttrResultCount.Int(len(namespaces)))
+	span.SetStatus(codes.Ok, "Success listing namespaces")
+	return namespaces, nil
+}
+
+// swagger:route POST /ns/ namespace addNamespace
+// Add new namespace
+//
+// responses:
+//
+//	400: ErrorResponse
+//	201: Namespace
+func (n NamespaceConsulRepository) AddNamespace(namespace *model.Namespace, ctx context.Context) error {
+	ctx, span := n.Tracer.Start(ctx, "NamespaceConsulRepository.AddNamespace", storageAttributes("put", model.AttrNamespace.String(namespace.Name), model.AttrStorageKey.String(n.keys.constructNamespaceKey(namespace.Name))))
+	defer span.End()
+
+	data, err := json.Marshal(namespace)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetAttributes(model.AttrValueSize.Int(len(data)))
+	_, err = n.cli.KV().Put(&api.KVPair{Key: n.keys.constructNamespaceKey(namespace.Name), Value: data}, writeOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Namespace added successfully")
+	return nil
+}
+
+// swagger:route DELETE /ns/{namespace}/ namespace deleteNamespace
+// Delete an empty namespace
+//
+// responses:
+//
+//	409: ErrorResponse
+//	204: NoContentResponse
+func (n NamespaceConsulRepository) DeleteNamespace(name string, ctx context.Context) error {
+	ctx, span := n.Tracer.Start(ctx, "NamespaceConsulRepository.DeleteNamespace", storageAttributes("delete", model.AttrNamespace.String(name), model.AttrStorageKey.String(n.keys.constructNamespaceKey(name))))
+	defer span.End()
+
+	_, err := n.cli.KV().Delete(n.keys.constructNamespaceKey(name), writeOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Namespace deleted successfully")
+	return nil
+}
+
+func (n NamespaceConsulRepository) IsNamespaceEmpty(name string, ctx context.Context) (bool, error) {
+	ctx, span := n.Tracer.Start(ctx, "NamespaceConsulRepository.IsNamespaceEmpty", storageAttributes("keys", model.AttrNamespace.String(name), model.AttrStorageKey.String(n.keys.key(namespacePrefix(name)))))
+	defer span.End()
+
+	keys, _, err := n.cli.KV().Keys(n.keys.key(namespacePrefix(name)), "", queryOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+
+	span.SetAttributes(model.AttrResultCount.Int(len(keys)))
+	span.SetStatus(codes.Ok, "")
+	return len(keys) == 0, nil
+}
@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"context"
+	"projekat/model"
+	"sort"
+)
+
+type NamespaceInMemRepository struct {
+	Namespaces map[string]model.Namespace
+}
+
+func (n NamespaceInMemRepository) GetNamespace(name string, ctx context.Context) (*model.Namespace, error) {
+	namespace, ok := n.Namespaces[name]
+	if !ok {
+		return nil, notFound("namespace '%s' not found", name)
+	}
+	return &namespace, nil
+}
+
+func (n NamespaceInMemRepository) ListNamespaces(ctx context.Context) ([]model.Namespace, error) {
+	namespaces := make([]model.Namespace, 0, len(n.Namespaces))
+	for _, namespace := range n.Namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Name < namespaces[j].Name })
+	return namespaces, nil
+}
+
+func (n NamespaceInMemRepository) AddNamespace(namespace *model.Namespace, ctx context.Context) error {
+	n.Namespaces[namespace.Name] = *namespace
+	return nil
+}
+
+func (n NamespaceInMemRepository) DeleteNamespace(name string, ctx context.Context) error {
+	delete(n.Namespaces, name)
+	return nil
+}
+
+func (n NamespaceInMemRepository) IsNamespaceEmpty(name string, ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func NewNamespaceInMemRepository() *NamespaceInMemRepository {
+	return &NamespaceInMemRepository{
+		Namespaces: make(map[string]model.Namespace),
+	}
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"context"
+	"github.com/hashicorp/consul/api"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"projekat/model"
+	"strconv"
+)
+
+type RateLimitConsulRepository struct {
+	cli    *api.Client
+	keys   Keyspace
+	logger *slog.Logger
+	Tracer trace.Tracer
+}
+
+func NewRL(client *api.Client, keys Keyspace, logger *slog.Logger, tracer trace.Tracer) *RateLimitConsulRepository {
+	return &RateLimitConsulRepository{cli: client, keys: keys, logger: logger, Tracer: tracer}
+}
+
+// GetCounter returns the value stored under the rate limit key together with
+// its ModifyIndex, which is 0 when the key does not exist yet.
+func (r RateLimitConsulRepository) GetCounter(key string, ctx context.Context) (uint64, uint64, error) {
+	ctx, span := r.Tracer.Start(ctx, "RateLimitConsulRepository.GetCounter", storageAttributes("get", model.AttrStorageKey.String(r.keys.constructRateLimitKey(key))))
+	defer span.End()
+
+	pair, _, err := r.cli.KV().Get(r.keys.constructRateLimitKey(key), queryOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return 0, 0, err
+	}
+	if pair == nil {
+		span.SetStatus(codes.Ok, "Counter not found")
+		return 0, 0, nil
+	}
+
+	count, err := strconv.ParseUint(string(pair.Value), 10, 64)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return 0, 0, err
+	}
+
+	span.SetStatus(codes.Ok, "Success")
+	return count, pair.ModifyIndex, nil
+}
+
+// SetCounter writes the counter with check-and-set semantics. It returns false
+// when another replica modified the key since it was read at index.
+func (r RateLimitConsulRepository) SetCounter(key string, count uint64, index uint64, ctx context.Context) (bool, error) {
+	ctx, span := r.Tracer.Start(ctx, "RateLimitConsulRepository.SetCounter", storageAttributes("cas", model.AttrStorageKey.String(r.keys.constructRateLimitKey(key))))
+	defer span.End()
+
+	p := &api.KVPair{
+		Key:         r.keys.constructRateLimitKey(key),
+		Value:       []byte(strconv.FormatUint(count, 10)),
+		ModifyIndex: index,
+	}
+	ok, _, err := r.cli.KV().CAS(p, writeOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+
+	span.SetStatus(codes.Ok, "Success")
+	return ok, nil
+}
+
+func (r RateLimitConsulRepository) DeleteCounter(key string, ctx context.Context) error {
+	ctx, span := r.Tracer.Start(ctx, "RateLimitConsulRepository.DeleteCounter", storageAttributes("delete", model.AttrStorageKey.String(r.keys.constructRateLimitKey(key))))
+	defer span.End()
+
+	_, err := r.cli.KV().Delete(r.keys.constructRateLimitKey(key), writeOptions(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Success")
+	return nil
+}
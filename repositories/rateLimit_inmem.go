@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+)
+
+type rateLimitCounter struct {
+	count uint64
+	index uint64
+}
+
+// RateLimitInMemRepository mirrors the check-and-set behaviour of the Consul
+// backend so several limiters can share it in tests.
+type RateLimitInMemRepository struct {
+	mux      sync.Mutex
+	counters map[string]rateLimitCounter
+	index    uint64
+}
+
+func (r *RateLimitInMemRepository) GetCounter(key string, ctx context.Context) (uint64, uint64, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	counter := r.counters[key]
+	return counter.count, counter.index, nil
+}
+
+func (r *RateLimitInMemRepository) SetCounter(key string, count uint64, index uint64, ctx context.Context) (bool, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.counters[key].index != index {
+		return false, nil
+	}
+	r.index++
+	r.counters[key] = rateLimitCounter{count: count, index: r.index}
+	return true, nil
+}
+
+func (r *RateLimitInMemRepository) DeleteCounter(key string, ctx context.Context) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	delete(r.counters, key)
+	return nil
+}
+
+func NewRateLimitInMemRepository() *RateLimitInMemRepository {
+	return &RateLimitInMemRepository{
+		counters: make(map[string]rateLimitCounter),
+	}
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/hashicorp/consul/api"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotData is the file format: raw Consul values by key.
+type snapshotData struct {
+	TakenAt time.Time         `json:"takenAt"`
+	Values  map[string][]byte `json:"values"`
+}
+
+// SnapshotFile keeps a local copy of every config, group and namespace so
+// reads can still be served, marked stale, while the storage circuit is open.
+type SnapshotFile struct {
+	path   string
+	client *api.Client
+	keys   Keyspace
+	logger *slog.Logger
+
+	mu   sync.RWMutex
+	data snapshotData
+}
+
+func NewSnapshotFile(path string, client *api.Client, keys Keyspace, logger *slog.Logger) *SnapshotFile {
+	return &SnapshotFile{path: path, client: client, keys: keys, logger: logger}
+}
+
+// Load reads the snapshot left by an earlier run. A missing file is not an
+// error.
+func (s *SnapshotFile) Load() error {
+	raw, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var data snapshotData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.data = data
+	s.mu.Unlock()
+	return nil
+}
+
+// Save copies the current data from Consul and replaces the file atomically.
+func (s *SnapshotFile) Save(ctx context.Context) error {
+	data := snapshotData{TakenAt: time.Now(), Values: map[string][]byte{}}
+	for _, root := range []string{configsPrefix, configGroupsPrefix, namespacesPrefix, layoutRoot(namespaceData)} {
+		pairs, _, err := s.client.KV().List(s.keys.key(root), queryOptions(ctx))
+		if err != nil {
+			return err
+		}
+		for _, pair := range pairs {
+			if s.snapshotted(pair.Key) {
+				data.Values[pair.Key] = pair.Value
+			}
+		}
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(raw); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), s.path); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.data = data
+	s.mu.Unlock()
+	return nil
+}
+
+// snapshotted reports whether key holds a config, group or namespace, as
+// opposed to idempotency records and label indexes stored alongside them.
+func (s *SnapshotFile) snapshotted(key string) bool {
+	return strings.HasPrefix(key, s.keys.key(namespacesPrefix)) || s.keys.holdsConfigOrGroup(key)
+}
+
+// Run saves a snapshot every interval until ctx is done.
+func (s *SnapshotFile) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Save(ctx); err != nil && ctx.Err() == nil {
+			s.logger.WarnContext(ctx, "Failed to save storage snapshot", "file", s.path, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *SnapshotFile) stale(key string) ([]byte, time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.data.Values[key]
+	return value, s.data.TakenAt, ok
+}
+
+// staleList returns the values of every key under prefix, in key order.
+func (s *SnapshotFile) staleList(prefix string) ([][]byte, time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.data.Values == nil {
+		return nil, time.Time{}, false
+	}
+	keys := make([]string, 0)
+	for key := range s.data.Values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	values := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, s.data.Values[key])
+	}
+	return values, s.data.TakenAt, true
+}
@@ -55,6 +55,9 @@ type ErrorResponse struct {
 	// Message of the error
 	// in: string
 	Message string `json:"message"`
+	// ID of the failed request, as sent in the X-Request-ID header
+	// in: string
+	RequestID string `json:"requestId"`
 }
 
 // swagger:response NoContentResponse
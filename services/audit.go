@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"projekat/model"
+	"strings"
+	"time"
+)
+
+// SystemActor is recorded for mutations made without an authenticated caller,
+// such as startup seeding.
+const SystemActor = "system"
+
+var ErrAuditContention = errors.New("audit log head is too contended")
+
+// auditScanLimit bounds how many events one Query reads, so a filter that
+// matches few events cannot make a single request walk the whole log.
+const auditScanLimit = 1000
+
+type AuditService struct {
+	repo     model.AuditRepository
+	now      func() time.Time
+	stateKey []byte
+	metrics  *MetricsService
+	Tracer   trace.Tracer
+}
+
+func NewAuditService(repo model.AuditRepository, tracer trace.Tracer) *AuditService {
+	return &AuditService{
+		repo:   repo,
+		now:    time.Now,
+		Tracer: tracer,
+	}
+}
+
+// SetMetrics makes Record count the events it fails to store.
+func (a *AuditService) SetMetrics(metrics *MetricsService) {
+	a.metrics = metrics
+}
+
+// SetStateKey sets the key that secret parameters stored in plaintext are
+// hashed with, see StateHash.
+func (a *AuditService) SetStateKey(key []byte) {
+	a.stateKey = key
+}
+
+// StateHash returns the hash stored as the before or after state of a
+// resource. A nil state, such as before a create, hashes to the empty string.
+// The state is hashed as stored, so explicit secrets count as their
+// ciphertext and changing or re-encrypting one changes the hash. Parameters
+// that are secret only by name are stored in plaintext; they count as an HMAC
+// under key so the hash cannot be used to guess them, or as masked when there
+// is no key.
+func StateHash(state interface{}, key []byte) string {
+	switch s := state.(type) {
+	case *model.Config:
+		if s == nil {
+			return ""
+		}
+		hashed := *s
+		hashed.Parameters = stateParameters(s.Parameters, s.Secrets, key)
+		state = &hashed
+	case *model.ConfigGroup:
+		if s == nil {
+			return ""
+		}
+		hashed := *s
+		hashed.Configurations = make([]model.ConfigForGroup, len(s.Configurations))
+		for i, member := range s.Configurations {
+			member.Parameters = stateParameters(member.Parameters, nil, key)
+			hashed.Configurations[i] = member
+		}
+		state = &hashed
+	}
+	if state == nil {
+		return ""
+	}
+	data, err := json.Marshal(state)
+	if err != nil || string(data) == "null" {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// stateParameters replaces the plaintext secret parameters by their HMAC.
+func stateParameters(parameters map[string]string, secrets []string, key []byte) map[string]string {
+	if parameters == nil {
+		return nil
+	}
+	hashed := make(map[string]string, len(parameters))
+	for name, value := range parameters {
+		if model.IsSecretParameter(name, secrets) && !IsEncrypted(value) {
+			if key == nil {
+				value = model.MaskedValue
+			} else {
+				mac := hmac.New(sha256.New, key)
+				mac.Write([]byte(name + "\x00" + value))
+				value = "hmac:" + hex.EncodeToString(mac.Sum(nil))
+			}
+		}
+		hashed[name] = value
+	}
+	return hashed
+}
+
+// nilIfEmpty turns a typed nil pointer into an untyped nil so it hashes as a
+// missing state.
+func nilIfEmpty[T any](state *T) interface{} {
+	if state == nil {
+		return nil
+	}
+	return state
+}
+
+// namespaceResource prefixes audit resources outside the default namespace.
+func namespaceResource(ctx context.Context) string {
+	if namespace := model.NamespaceFromContext(ctx); namespace != model.DefaultNamespace {
+		return "ns/" + namespace + "/"
+	}
+	return ""
+}
+
+// AccessResource names the requested resource in audit events about access
+// to it, prefixed with the namespace like the resources of mutations.
+func AccessResource(resource string, name string, ctx context.Context) string {
+	return namespaceResource(ctx) + resource + "/" + name
+}
+
+func configResource(name string, version float32, ctx context.Context) string {
+	return namespaceResource(ctx) + fmt.Sprintf("config/%s/v%.1f", name, version)
+}
+
+func configGroupResource(name string, version float32, ctx context.Context) string {
+	return namespaceResource(ctx) + fmt.Sprintf("configGroup/%s/v%.1f", name, version)
+}
+
+// chainHash covers every field of the event except Hash itself.
+func chainHash(event model.AuditEvent) string {
+	event.Hash = ""
+	data, _ := json.Marshal(event)
+	sum := sha256.Sum256(append([]byte(event.PrevHash), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// Record appends an event to the chain. Callers log a failure instead of
+// failing the mutation it describes, so failures are also counted in the
+// audit_record_failures_total metric.
+func (a *AuditService) Record(action string, resource string, before interface{}, after interface{}, ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	err := a.record(action, resource, before, after, ctx)
+	if err != nil && a.metrics != nil {
+		a.metrics.AuditRecordFailures.WithLabelValues(action).Inc()
+	}
+	return err
+}
+
+func (a *AuditService) record(action string, resource string, before interface{}, after interface{}, ctx context.Context) error {
+	ctx, span := a.Tracer.Start(ctx, "AuditService.Record", trace.WithAttributes(
+		attribute.String("audit.action", action),
+		attribute.String("audit.resource", resource),
+		model.AttrNamespace.String(model.NamespaceFromContext(ctx)),
+	))
+	defer span.End()
+
+	actor := SystemActor
+	if principal, ok := model.PrincipalFromContext(ctx); ok {
+		actor = principal.Subject
+	}
+	var traceID string
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		traceID = sc.TraceID().String()
+	}
+
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		head, index, err := a.repo.GetHead(ctx)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		event := model.AuditEvent{
+			Sequence:   head.Sequence + 1,
+			Time:       a.now().UTC(),
+			Actor:      actor,
+			Action:     action,
+			Resource:   resource,
+			RequestID:  model.RequestIDFromContext(ctx),
+			TraceID:    traceID,
+			BeforeHash: StateHash(before, a.stateKey),
+			AfterHash:  StateHash(after, a.stateKey),
+			PrevHash:   head.Hash,
+		}
+		event.Hash = chainHash(event)
+
+		ok, err := a.repo.Append(&event, index, ctx)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+		if ok {
+			span.SetAttributes(attribute.Int64("audit.sequence", int64(event.Sequence)), attribute.Int("audit.attempts", attempt+1))
+			span.SetStatus(codes.Ok, "")
+			return nil
+		}
+	}
+
+	span.SetStatus(codes.Error, ErrAuditContention.Error())
+	return ErrAuditContention
+}
+
+// Query returns up to limit events after the given sequence number whose
+// resource starts with resource and which happened at or after since. next is
+// the cursor for the following page, or 0 when there are no more events.
+// Events are read from the cursor on, at most auditScanLimit of them, so a
+// page can hold fewer than limit events while next is not 0.
+func (a *AuditService) Query(resource string, since time.Time, after uint64, limit int, ctx context.Context) ([]model.AuditEvent, uint64, error) {
+	ctx, span := a.Tracer.Start(ctx, "AuditService.Query", trace.WithAttributes(
+		attribute.String("audit.resource", resource),
+		attribute.Int64("audit.after", int64(after)),
+		attribute.Int("audit.limit", limit),
+	))
+	defer span.End()
+
+	head, _, err := a.repo.GetHead(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, 0, err
+	}
+
+	page := make([]model.AuditEvent, 0, limit)
+	budget := uint64(max(auditScanLimit, limit+1))
+	for next := after; next < head.Sequence; {
+		if budget == 0 {
+			span.SetAttributes(model.AttrResultCount.Int(len(page)))
+			span.SetStatus(codes.Ok, "")
+			return page, next, nil
+		}
+		// One more event than fits tells whether there is a next page.
+		last := min(head.Sequence, next+min(budget, uint64(limit)+1))
+		events, err := a.repo.ListEventRange(next+1, last, ctx)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, 0, err
+		}
+		for _, event := range events {
+			if event.Time.Before(since) || !strings.HasPrefix(event.Resource, resource) {
+				continue
+			}
+			if len(page) == limit {
+				span.SetAttributes(model.AttrResultCount.Int(len(page)))
+				span.SetStatus(codes.Ok, "")
+				return page, page[len(page)-1].Sequence, nil
+			}
+			page = append(page, event)
+		}
+		budget -= last - next
+		next = last
+	}
+
+	span.SetAttributes(model.AttrResultCount.Int(len(page)))
+	span.SetStatus(codes.Ok, "")
+	return page, 0, nil
+}
+
+// AuditVerification lists every inconsistency found in the chain.
+type AuditVerification struct {
+	Events   int      `json:"events"`
+	Problems []string `json:"problems"`
+}
+
+func (v AuditVerification) Valid() bool {
+	return len(v.Problems) == 0
+}
+
+// Verify walks the whole chain and reports missing sequence numbers, events
+// whose content no longer matches their hash, broken links and a head that
+// does not point at the last event.
+func (a *AuditService) Verify(ctx context.Context) (*AuditVerification, error) {
+	ctx, span := a.Tracer.Start(ctx, "AuditService.Verify")
+	defer span.End()
+
+	head, _, err := a.repo.GetHead(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	events, err := a.repo.ListEvents(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	result := &AuditVerification{Events: len(events)}
+	expected := uint64(1)
+	prevHash := ""
+	for _, event := range events {
+		if event.Sequence != expected {
+			result.Problems = append(result.Problems, fmt.Sprintf("gap: expected event %d, found %d", expected, event.Sequence))
+		}
+		if event.PrevHash != prevHash {
+			result.Problems = append(result.Problems, fmt.Sprintf("event %d: link to previous event is broken", event.Sequence))
+		}
+		if chainHash(event) != event.Hash {
+			result.Problems = append(result.Problems, fmt.Sprintf("event %d: content does not match its hash", event.Sequence))
+		}
+		expected = event.Sequence + 1
+		prevHash = event.Hash
+	}
+	if head.Sequence != expected-1 || head.Hash != prevHash {
+		result.Problems = append(result.Problems, fmt.Sprintf("head points at event %d but the chain ends at %d", head.Sequence, expected-1))
+	}
+
+	span.SetAttributes(attribute.Int("audit.events", result.Events), attribute.Int("audit.problems", len(result.Problems)))
+	span.SetStatus(codes.Ok, "")
+	return result, nil
+}
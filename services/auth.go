@@ -0,0 +1,145 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"projekat/model"
+	"strings"
+)
+
+var ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+// APIKeyEntry is one entry of the API key file. Only the SHA-256 hash of the
+// key is stored, prefixed with "sha256:".
+type APIKeyEntry struct {
+	Principal string   `yaml:"principal" json:"principal"`
+	Hash      string   `yaml:"hash" json:"hash"`
+	Roles     []string `yaml:"roles" json:"roles"`
+}
+
+type apiKey struct {
+	hash      []byte
+	principal model.Principal
+}
+
+type AuthService struct {
+	apiKeys            []apiKey
+	jwt                *JWTVerifier
+	clientCertificates bool
+}
+
+func NewAuthService(apiKeysFile string, jwt *JWTVerifier) (*AuthService, error) {
+	s := &AuthService{jwt: jwt}
+	if apiKeysFile != "" {
+		if err := s.loadAPIKeys(apiKeysFile); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *AuthService) loadAPIKeys(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading API key file: %w", err)
+	}
+	// The file is JSON unless its extension says YAML.
+	var entries []APIKeyEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &entries)
+	default:
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing API key file: %w", err)
+	}
+	for _, entry := range entries {
+		hash, err := hex.DecodeString(strings.TrimPrefix(entry.Hash, "sha256:"))
+		if err != nil || len(hash) != sha256.Size {
+			return fmt.Errorf("API key for %q must be a sha256 hex digest", entry.Principal)
+		}
+		s.apiKeys = append(s.apiKeys, apiKey{
+			hash: hash,
+			principal: model.Principal{
+				Subject: entry.Principal,
+				Method:  model.AuthMethodAPIKey,
+				Roles:   entry.Roles,
+			},
+		})
+	}
+	return nil
+}
+
+// EnableClientCertificates accepts verified TLS client certificates as
+// credentials, with the certificate subject as the principal.
+func (s *AuthService) EnableClientCertificates() {
+	s.clientCertificates = true
+}
+
+// Enabled reports whether any credential source is configured.
+func (s *AuthService) Enabled() bool {
+	return len(s.apiKeys) > 0 || (s.jwt != nil && s.jwt.Enabled()) || s.clientCertificates
+}
+
+// AuthenticateCertificate maps a client certificate that was already verified
+// during the TLS handshake to a principal named after its common name, or the
+// full subject when the common name is empty.
+func (s *AuthService) AuthenticateCertificate(cert *x509.Certificate) (*model.Principal, error) {
+	if !s.clientCertificates || cert == nil {
+		return nil, ErrUnauthenticated
+	}
+	subject := cert.Subject.CommonName
+	if subject == "" {
+		subject = cert.Subject.String()
+	}
+	return &model.Principal{
+		Subject: subject,
+		Method:  model.AuthMethodMTLS,
+	}, nil
+}
+
+func (s *AuthService) AuthenticateAPIKey(key string) (*model.Principal, error) {
+	sum := sha256.Sum256([]byte(key))
+	var found *model.Principal
+	// Compare against every entry so timing does not reveal the match position.
+	for i := range s.apiKeys {
+		if subtle.ConstantTimeCompare(sum[:], s.apiKeys[i].hash) == 1 {
+			principal := s.apiKeys[i].principal
+			found = &principal
+		}
+	}
+	if found == nil {
+		return nil, ErrUnauthenticated
+	}
+	return found, nil
+}
+
+func (s *AuthService) AuthenticateBearer(token string) (*model.Principal, error) {
+	if s.jwt == nil || !s.jwt.Enabled() {
+		return nil, ErrUnauthenticated
+	}
+	claims, err := s.jwt.Verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	return &model.Principal{
+		Subject: claims.Subject,
+		Method:  model.AuthMethodJWT,
+		Roles:   claims.Roles,
+	}, nil
+}
+
+// HashAPIKey returns the form in which a key is stored in the API key file.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
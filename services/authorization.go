@@ -0,0 +1,139 @@
+package services
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"projekat/model"
+)
+
+// AnonymousSubject is evaluated against the policy when no principal is
+// attached to the request, so anonymous access can be granted explicitly.
+const AnonymousSubject = "anonymous"
+
+type AuthorizationService struct {
+	roles    map[string]model.Role
+	bindings []model.RoleBinding
+}
+
+// LoadPolicy reads a YAML (or JSON) policy file.
+func LoadPolicy(file string) (*model.Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %w", err)
+	}
+	var policy model.Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("parsing policy file: %w", err)
+	}
+	return &policy, nil
+}
+
+func NewAuthorizationService(policy *model.Policy) (*AuthorizationService, error) {
+	s := &AuthorizationService{
+		roles:    make(map[string]model.Role),
+		bindings: policy.Bindings,
+	}
+	for _, role := range policy.Roles {
+		for _, permission := range role.Permissions {
+			switch permission.Resource {
+			case model.ResourceConfig, model.ResourceGroup, model.ResourceAudit, model.ResourceNamespace, "*":
+			default:
+				return nil, fmt.Errorf("role %q: unknown resource %q", role.Name, permission.Resource)
+			}
+			for _, patterns := range [][]string{permission.Names, permission.Namespaces} {
+				for _, pattern := range patterns {
+					if _, err := path.Match(pattern, ""); err != nil {
+						return nil, fmt.Errorf("role %q: invalid pattern %q", role.Name, pattern)
+					}
+				}
+			}
+		}
+		s.roles[role.Name] = role
+	}
+	for _, binding := range policy.Bindings {
+		for _, name := range binding.Roles {
+			if _, ok := s.roles[name]; !ok {
+				return nil, fmt.Errorf("binding references unknown role %q", name)
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *AuthorizationService) rolesFor(principal *model.Principal) []string {
+	subject := AnonymousSubject
+	var roles []string
+	if principal != nil {
+		subject = principal.Subject
+		roles = append(roles, principal.Roles...)
+	}
+	for _, binding := range s.bindings {
+		for _, candidate := range binding.Subjects {
+			if matched, _ := path.Match(candidate, subject); matched {
+				roles = append(roles, binding.Roles...)
+				break
+			}
+		}
+	}
+	return roles
+}
+
+// Authorize reports whether principal may perform action on the named resource
+// in namespace; an empty namespace is the default one. The admin action
+// implies every other action.
+func (s *AuthorizationService) Authorize(principal *model.Principal, action string, resource string, name string, namespace string) bool {
+	if namespace == "" {
+		namespace = model.DefaultNamespace
+	}
+	for _, roleName := range s.rolesFor(principal) {
+		role, ok := s.roles[roleName]
+		if !ok {
+			continue
+		}
+		for _, permission := range role.Permissions {
+			if permission.Resource != resource && permission.Resource != "*" {
+				continue
+			}
+			if !containsAction(permission.Actions, action) {
+				continue
+			}
+			if !coversNamespace(permission.Namespaces, namespace) {
+				continue
+			}
+			if matchesAny(permission.Names, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// coversNamespace reports whether namespace matches one of patterns. A
+// permission without patterns only covers the default namespace, so grants
+// written before namespaces existed do not spread to new ones.
+func coversNamespace(patterns []string, namespace string) bool {
+	if len(patterns) == 0 {
+		return namespace == model.DefaultNamespace
+	}
+	return matchesAny(patterns, namespace)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAction(actions []string, action string) bool {
+	for _, a := range actions {
+		if a == action || a == model.ActionAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"projekat/model"
+	"slices"
+	"strings"
+)
+
+// Bootstrap modes decide what happens to an entry that already exists with
+// different content. Entries stored exactly as in the files are left alone in
+// every mode.
+const (
+	BootstrapSkipIfExists   = "skip-if-exists"
+	BootstrapOverwrite      = "overwrite"
+	BootstrapFailOnConflict = "fail-on-conflict"
+)
+
+var (
+	ErrBootstrapConflict = errors.New("bootstrap entries conflict with stored data")
+	// ErrBootstrapInvalid is wrapped by the errors of an unknown mode and of
+	// files that cannot be read or fail validation, which no retry can fix.
+	ErrBootstrapInvalid = errors.New("invalid bootstrap directory")
+)
+
+// BootstrapFile is one JSON or YAML file of the bootstrap directory. An empty
+// Namespace is the default namespace.
+type BootstrapFile struct {
+	Namespace string              `json:"namespace" yaml:"namespace"`
+	Configs   []model.Config      `json:"configs" yaml:"configs"`
+	Groups    []model.ConfigGroup `json:"groups" yaml:"groups"`
+}
+
+// BootstrapReport lists the resources of a bootstrap run by outcome.
+type BootstrapReport struct {
+	Files     int
+	Created   []string
+	Updated   []string
+	Unchanged []string
+	Skipped   []string
+}
+
+func (r BootstrapReport) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("files", r.Files),
+		slog.Int("created", len(r.Created)),
+		slog.Int("updated", len(r.Updated)),
+		slog.Int("unchanged", len(r.Unchanged)),
+		slog.Int("skipped", len(r.Skipped)),
+		slog.Any("skippedResources", r.Skipped),
+	)
+}
+
+// bootstrapEntry is a config or a group read from file, with the context of
+// its namespace.
+type bootstrapEntry struct {
+	file     string
+	resource string
+	ctx      context.Context
+	config   *model.Config
+	group    *model.ConfigGroup
+	exists   bool
+}
+
+// BootstrapService applies a directory of configs and groups at startup.
+// Writes go through the config and group services, so they are encrypted,
+// checked against quotas and audited like any API call.
+type BootstrapService struct {
+	configs    ConfigService
+	groups     ConfigGroupService
+	namespaces NamespaceService
+}
+
+func NewBootstrapService(configs ConfigService, groups ConfigGroupService, namespaces NamespaceService) BootstrapService {
+	return BootstrapService{
+		configs:    configs,
+		groups:     groups,
+		namespaces: namespaces,
+	}
+}
+
+// Apply stores every config and group in the .json, .yaml and .yml files of
+// dir. All files are read and compared with storage before anything is
+// written, so a bad file or, in fail-on-conflict mode, a conflict leaves
+// storage untouched.
+func (s BootstrapService) Apply(dir string, mode string, ctx context.Context) (*BootstrapReport, error) {
+	switch mode {
+	case BootstrapSkipIfExists, BootstrapOverwrite, BootstrapFailOnConflict:
+	default:
+		return nil, fmt.Errorf("%w: unknown bootstrap mode %q", ErrBootstrapInvalid, mode)
+	}
+	files, err := readBootstrapDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBootstrapInvalid, err)
+	}
+	report := &BootstrapReport{Files: len(files)}
+	entries, err := bootstrapEntries(files, ctx)
+	if err != nil {
+		return report, fmt.Errorf("%w: %w", ErrBootstrapInvalid, err)
+	}
+
+	var pending, conflicts []*bootstrapEntry
+	for _, entry := range entries {
+		same, err := s.compare(entry)
+		if err != nil {
+			return report, fmt.Errorf("%s: reading %s: %w", entry.file, entry.resource, err)
+		}
+		switch {
+		case same:
+			report.Unchanged = append(report.Unchanged, entry.resource)
+		case !entry.exists:
+			pending = append(pending, entry)
+		case mode == BootstrapSkipIfExists:
+			report.Skipped = append(report.Skipped, entry.resource)
+		default:
+			conflicts = append(conflicts, entry)
+		}
+	}
+	if mode == BootstrapFailOnConflict && len(conflicts) > 0 {
+		resources := make([]string, 0, len(conflicts))
+		for _, entry := range conflicts {
+			resources = append(resources, entry.resource)
+		}
+		return report, fmt.Errorf("%w: %s", ErrBootstrapConflict, strings.Join(resources, ", "))
+	}
+
+	for _, entry := range append(pending, conflicts...) {
+		if err := s.write(entry); err != nil {
+			return report, fmt.Errorf("%s: writing %s: %w", entry.file, entry.resource, err)
+		}
+		if entry.exists {
+			report.Updated = append(report.Updated, entry.resource)
+		} else {
+			report.Created = append(report.Created, entry.resource)
+		}
+	}
+	return report, nil
+}
+
+// compare reports whether entry is stored exactly as in its file, and
+// records whether it is stored at all.
+func (s BootstrapService) compare(entry *bootstrapEntry) (bool, error) {
+	// Secrets are compared in plaintext.
+	ctx := model.ContextWithReveal(entry.ctx)
+	if entry.config != nil {
+		stored, err := s.configs.GetConfig(entry.config.Name, entry.config.Version, ctx)
+		if err != nil {
+			return false, notFoundAsNil(err)
+		}
+		entry.exists = true
+		return sameConfig(stored, entry.config), nil
+	}
+	stored, err := s.groups.GetConfigGroup(entry.group.Name, entry.group.Version, ctx)
+	if err != nil {
+		return false, notFoundAsNil(err)
+	}
+	entry.exists = true
+	return sameGroup(stored, entry.group), nil
+}
+
+func (s BootstrapService) write(entry *bootstrapEntry) error {
+	if err := s.ensureNamespace(entry.ctx); err != nil {
+		return err
+	}
+	if entry.config != nil {
+		return s.configs.AddConfigWithSecrets(entry.config.Name, entry.config.Version, entry.config.Parameters, entry.config.Secrets, entry.ctx)
+	}
+	return s.groups.AddConfigGroup(entry.group.Name, entry.group.Version, entry.group.Configurations, entry.ctx)
+}
+
+// ensureNamespace creates the namespace of ctx if it does not exist yet.
+func (s BootstrapService) ensureNamespace(ctx context.Context) error {
+	name := model.NamespaceFromContext(ctx)
+	_, err := s.namespaces.GetNamespace(name, ctx)
+	if !errors.Is(err, ErrNamespaceNotFound) {
+		return err
+	}
+	err = s.namespaces.AddNamespace(&model.Namespace{Name: name}, ctx)
+	if errors.Is(err, ErrNamespaceExists) {
+		return nil
+	}
+	return err
+}
+
+// notFoundAsNil drops the error of a read that found nothing.
+func notFoundAsNil(err error) error {
+	if errors.Is(err, model.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+type namedBootstrapFile struct {
+	name string
+	BootstrapFile
+}
+
+// readBootstrapDir parses the bootstrap files of dir in name order. Other
+// files and subdirectories are ignored.
+func readBootstrapDir(dir string) ([]namedBootstrapFile, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading bootstrap directory: %w", err)
+	}
+	var files []namedBootstrapFile
+	for _, dirEntry := range dirEntries {
+		ext := strings.ToLower(filepath.Ext(dirEntry.Name()))
+		if dirEntry.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, dirEntry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading bootstrap file: %w", err)
+		}
+		file := namedBootstrapFile{name: dirEntry.Name()}
+		if ext == ".json" {
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			err = decoder.Decode(&file.BootstrapFile)
+		} else {
+			decoder := yaml.NewDecoder(bytes.NewReader(data))
+			decoder.KnownFields(true)
+			err = decoder.Decode(&file.BootstrapFile)
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parsing bootstrap file %s: %w", file.name, err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// bootstrapEntries validates the files and flattens them, rejecting a
+// resource defined twice.
+func bootstrapEntries(files []namedBootstrapFile, ctx context.Context) ([]*bootstrapEntry, error) {
+	var entries []*bootstrapEntry
+	var errs []error
+	defined := make(map[string]string)
+	add := func(file string, entry *bootstrapEntry, name string, version float32) {
+		if name == "" || version <= 0 {
+			errs = append(errs, fmt.Errorf("%s: %s needs a name and a positive version", file, entry.resource))
+			return
+		}
+		if previous, ok := defined[entry.resource]; ok {
+			errs = append(errs, fmt.Errorf("%s: %s is already defined in %s", file, entry.resource, previous))
+			return
+		}
+		defined[entry.resource] = file
+		entries = append(entries, entry)
+	}
+	for _, file := range files {
+		fileCtx := ctx
+		if file.Namespace != "" {
+			if !model.ValidNamespaceName(file.Namespace) {
+				errs = append(errs, fmt.Errorf("%s: %w", file.name, ErrInvalidNamespace))
+				continue
+			}
+			fileCtx = model.ContextWithNamespace(ctx, file.Namespace)
+		}
+		for i := range file.Configs {
+			config := &file.Configs[i]
+			entry := &bootstrapEntry{file: file.name, resource: configResource(config.Name, config.Version, fileCtx), ctx: fileCtx, config: config}
+			add(file.name, entry, config.Name, config.Version)
+		}
+		for i := range file.Groups {
+			group := &file.Groups[i]
+			entry := &bootstrapEntry{file: file.name, resource: configGroupResource(group.Name, group.Version, fileCtx), ctx: fileCtx, group: group}
+			add(file.name, entry, group.Name, group.Version)
+		}
+	}
+	return entries, errors.Join(errs...)
+}
+
+func sameConfig(stored *model.Config, config *model.Config) bool {
+	return maps.Equal(stored.Parameters, config.Parameters) && sameNames(stored.Secrets, config.Secrets)
+}
+
+func sameGroup(stored *model.ConfigGroup, group *model.ConfigGroup) bool {
+	return slices.EqualFunc(stored.Configurations, group.Configurations, func(a model.ConfigForGroup, b model.ConfigForGroup) bool {
+		return a.Name == b.Name && maps.Equal(a.Labels, b.Labels) && maps.Equal(a.Parameters, b.Parameters)
+	})
+}
+
+// sameNames compares two lists of names regardless of order.
+func sameNames(a []string, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
@@ -2,35 +2,136 @@ package services
 
 import (
 	"context"
-	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"projekat/model"
 )
 
 type ConfigService struct {
-	repo model.ConfigRepository
+	repo    model.ConfigRepository
+	audit   *AuditService
+	quota   *QuotaService
+	secrets *SecretService
+	tracer  trace.Tracer
 }
 
 func NewConfigService(repo model.ConfigRepository) ConfigService {
 	return ConfigService{
-		repo: repo,
+		repo:   repo,
+		tracer: noopTracer,
 	}
 }
 
+// WithTracer returns a copy of the service that traces every operation.
+func (s ConfigService) WithTracer(tracer trace.Tracer) ConfigService {
+	s.tracer = tracer
+	return s
+}
+
+// WithAudit returns a copy of the service that records every mutation.
+func (s ConfigService) WithAudit(audit *AuditService) ConfigService {
+	s.audit = audit
+	return s
+}
+
+// WithQuota returns a copy of the service that rejects writes over quota.
+func (s ConfigService) WithQuota(quota *QuotaService) ConfigService {
+	s.quota = quota
+	return s
+}
+
+// WithSecrets returns a copy of the service that encrypts secret parameters
+// before they are stored.
+func (s ConfigService) WithSecrets(secrets *SecretService) ConfigService {
+	s.secrets = secrets
+	return s
+}
+
 func (s ConfigService) Hello() {
-	fmt.Println("hello from config service")
+	slog.Info("hello from config service")
 }
 
 func (s ConfigService) AddConfig(name string, version float32, parameters map[string]string, ctx context.Context) error {
+	return s.AddConfigWithSecrets(name, version, parameters, nil, ctx)
+}
+
+// AddConfigWithSecrets stores a config whose parameters named in secrets are
+// encrypted at rest.
+func (s ConfigService) AddConfigWithSecrets(name string, version float32, parameters map[string]string, secrets []string, ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "ConfigService.AddConfig", trace.WithAttributes(model.ConfigAttributes(ctx, name, version)...))
+	defer func() { endSpan(span, err) }()
+
 	config := model.NewConfig(name, version, parameters)
-	return s.repo.AddConfig(config, ctx)
+	config.Secrets = secrets
+	if len(secrets) > 0 {
+		// Encrypt a copy so the caller's parameters keep their plaintext.
+		config = copyConfig(config)
+	}
+	if err := s.secrets.EncryptConfig(config); err != nil {
+		return err
+	}
+	var before *model.Config
+	if s.audit != nil || s.quota != nil {
+		if existing, err := s.repo.GetConfig(name, version, ctx); err == nil {
+			before = existing
+		}
+	}
+	config.Owner = model.SubjectFromContext(ctx)
+	if before != nil {
+		config.Owner = before.Owner
+	}
+	if err := s.quota.CheckConfig(config, before, ctx); err != nil {
+		return err
+	}
+	if err := s.repo.AddConfig(config, ctx); err != nil {
+		return err
+	}
+	s.quota.TrackConfig(before, config, ctx)
+	s.recordAudit(model.AuditActionCreate, configResource(name, version, ctx), before, config, ctx)
+	return nil
 }
 
-func (s ConfigService) GetConfig(name string, version float32, ctx context.Context) (*model.Config, error) {
-	return s.repo.GetConfig(name, version, ctx)
+// GetConfig returns the config with its secrets decrypted if the request is
+// allowed to reveal them, and masked otherwise.
+func (s ConfigService) GetConfig(name string, version float32, ctx context.Context) (config *model.Config, err error) {
+	ctx, span := s.tracer.Start(ctx, "ConfigService.GetConfig", trace.WithAttributes(model.ConfigAttributes(ctx, name, version)...))
+	defer func() { endSpan(span, err) }()
+
+	config, err = s.repo.GetConfig(name, version, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if model.RevealFromContext(ctx) {
+		return s.secrets.RevealConfig(config)
+	}
+	return MaskConfig(config), nil
 }
 
-func (s ConfigService) DeleteConfig(name string, version float32, ctx context.Context) error {
-	return s.repo.DeleteConfig(name, version, ctx)
+func (s ConfigService) DeleteConfig(name string, version float32, ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "ConfigService.DeleteConfig", trace.WithAttributes(model.ConfigAttributes(ctx, name, version)...))
+	defer func() { endSpan(span, err) }()
+
+	var before *model.Config
+	if s.audit != nil || s.quota != nil {
+		if existing, err := s.repo.GetConfig(name, version, ctx); err == nil {
+			before = existing
+		}
+	}
+	if err := s.repo.DeleteConfig(name, version, ctx); err != nil {
+		return err
+	}
+	s.quota.TrackConfig(before, nil, ctx)
+	s.recordAudit(model.AuditActionDelete, configResource(name, version, ctx), before, nil, ctx)
+	return nil
+}
+
+func (s ConfigService) recordAudit(action string, resource string, before *model.Config, after *model.Config, ctx context.Context) {
+	if s.audit == nil {
+		return
+	}
+	if err := s.audit.Record(action, resource, nilIfEmpty(before), nilIfEmpty(after), ctx); err != nil {
+		slog.ErrorContext(ctx, "Error recording audit event", "resource", resource, "error", err)
+	}
 }
 
 // todo: implementiraj metode za dodavanje, brisanje, dobavljanje itd.
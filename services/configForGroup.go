@@ -2,33 +2,161 @@ package services
 
 import (
 	"context"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"projekat/model"
 )
 
 type ConfigForGroupService struct {
-	repo model.ConfigForGroupRepository
+	repo    model.ConfigForGroupRepository
+	groups  model.ConfigGroupRepository
+	audit   *AuditService
+	quota   *QuotaService
+	secrets *SecretService
+	tracer  trace.Tracer
 }
 
 func NewConfigForGroupService(repo model.ConfigForGroupRepository) ConfigForGroupService {
 	return ConfigForGroupService{
-		repo: repo,
+		repo:   repo,
+		tracer: noopTracer,
 	}
 }
 
+// WithTracer returns a copy of the service that traces every operation.
+func (s ConfigForGroupService) WithTracer(tracer trace.Tracer) ConfigForGroupService {
+	s.tracer = tracer
+	return s
+}
+
+// WithAudit returns a copy of the service that records every mutation. groups
+// is used to capture the group state before and after each change.
+func (s ConfigForGroupService) WithAudit(audit *AuditService, groups model.ConfigGroupRepository) ConfigForGroupService {
+	s.audit = audit
+	s.groups = groups
+	return s
+}
+
+// WithQuota returns a copy of the service that rejects additions over quota.
+// groups is used to look up the current members of the target group.
+func (s ConfigForGroupService) WithQuota(quota *QuotaService, groups model.ConfigGroupRepository) ConfigForGroupService {
+	s.quota = quota
+	s.groups = groups
+	return s
+}
+
+// WithSecrets returns a copy of the service that encrypts secret parameters
+// before they are stored.
+func (s ConfigForGroupService) WithSecrets(secrets *SecretService) ConfigForGroupService {
+	s.secrets = secrets
+	return s
+}
+
 func (s ConfigForGroupService) AddToConfigGroup(name string, labels map[string]string, parameters map[string]string, groupName string, groupVersion float32, ctx context.Context) error {
+	return s.AddToConfigGroupWithSecrets(name, labels, parameters, nil, groupName, groupVersion, ctx)
+}
+
+// AddToConfigGroupWithSecrets adds a member whose parameters named in secrets
+// are encrypted at rest.
+func (s ConfigForGroupService) AddToConfigGroupWithSecrets(name string, labels map[string]string, parameters map[string]string, secrets []string, groupName string, groupVersion float32, ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "ConfigForGroupService.AddToConfigGroup", trace.WithAttributes(model.GroupAttributes(ctx, groupName, groupVersion)...))
+	span.SetAttributes(model.AttrConfigName.String(name), model.LabelsAttribute(labels))
+	defer func() { endSpan(span, err) }()
+
 	config := model.NewConfigForGroup(name, labels, parameters)
-	return s.repo.AddToConfigGroup(config, groupName, groupVersion, ctx)
+	config.Secrets = secrets
+	if len(secrets) > 0 {
+		// Encrypt a copy so the caller's parameters keep their plaintext.
+		config.Parameters = copyParameters(parameters)
+	}
+	if err := s.secrets.EncryptConfigForGroup(config); err != nil {
+		return err
+	}
+	before := s.groupState(groupName, groupVersion, ctx)
+	if err := s.quota.CheckGroupMember(config, before, ctx); err != nil {
+		return err
+	}
+	if err := s.repo.AddToConfigGroup(config, groupName, groupVersion, ctx); err != nil {
+		return err
+	}
+	s.recordChange(model.AuditActionGroupMemberAdd, groupName, groupVersion, before, ctx)
+	return nil
 }
 
-func (s ConfigForGroupService) DeleteFromConfigGroup(configForGroupName string, groupName string, groupVersion float32, ctx context.Context) error {
-	return s.repo.DeleteFromConfigGroup(configForGroupName, groupName, groupVersion, ctx)
+func (s ConfigForGroupService) DeleteFromConfigGroup(configForGroupName string, groupName string, groupVersion float32, ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "ConfigForGroupService.DeleteFromConfigGroup", trace.WithAttributes(model.GroupAttributes(ctx, groupName, groupVersion)...))
+	span.SetAttributes(model.AttrConfigName.String(configForGroupName))
+	defer func() { endSpan(span, err) }()
 
+	before := s.groupState(groupName, groupVersion, ctx)
+	if err := s.repo.DeleteFromConfigGroup(configForGroupName, groupName, groupVersion, ctx); err != nil {
+		return err
+	}
+	s.recordChange(model.AuditActionGroupMemberDelete, groupName, groupVersion, before, ctx)
+	return nil
+}
+
+// GetConfigsByLabels returns the matching members with their secrets
+// decrypted if the request is allowed to reveal them, and masked otherwise.
+func (s ConfigForGroupService) GetConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) (configs []model.ConfigForGroup, err error) {
+	ctx, span := s.tracer.Start(ctx, "ConfigForGroupService.GetConfigsByLabels", trace.WithAttributes(model.GroupAttributes(ctx, groupName, groupVersion)...))
+	span.SetAttributes(model.LabelsAttribute(labels))
+	defer func() { endSpan(span, err) }()
+
+	configs, err = s.repo.GetConfigsByLabels(groupName, groupVersion, labels, ctx)
+	if err != nil {
+		return nil, err
+	}
+	reveal := model.RevealFromContext(ctx)
+	members := make([]model.ConfigForGroup, len(configs))
+	for i := range configs {
+		member := configs[i].Redacted()
+		if reveal {
+			if member, err = s.secrets.RevealConfigForGroup(&configs[i]); err != nil {
+				return nil, err
+			}
+		}
+		members[i] = *member
+	}
+	return members, nil
 }
 
-func (s ConfigForGroupService) GetConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) ([]model.ConfigForGroup, error) {
-	return s.repo.GetConfigsByLabels(groupName, groupVersion, labels, ctx)
+func (s ConfigForGroupService) DeleteConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "ConfigForGroupService.DeleteConfigsByLabels", trace.WithAttributes(model.GroupAttributes(ctx, groupName, groupVersion)...))
+	span.SetAttributes(model.LabelsAttribute(labels))
+	defer func() { endSpan(span, err) }()
+
+	before := s.groupState(groupName, groupVersion, ctx)
+	if err := s.repo.DeleteConfigsByLabels(groupName, groupVersion, labels, ctx); err != nil {
+		return err
+	}
+	s.recordChange(model.AuditActionLabelDelete, groupName, groupVersion, before, ctx)
+	return nil
 }
 
-func (s ConfigForGroupService) DeleteConfigsByLabels(groupName string, groupVersion float32, labels map[string]string, ctx context.Context) error {
-	return s.repo.DeleteConfigsByLabels(groupName, groupVersion, labels, ctx)
+func (s ConfigForGroupService) groupState(groupName string, groupVersion float32, ctx context.Context) *model.ConfigGroup {
+	if (s.audit == nil && s.quota == nil) || s.groups == nil {
+		return nil
+	}
+	group, err := s.groups.GetConfigGroup(groupName, groupVersion, ctx)
+	if err != nil {
+		return nil
+	}
+	return group
+}
+
+// recordChange reads the group after a change to its members and passes both
+// states to the quota usage and the audit log.
+func (s ConfigForGroupService) recordChange(action string, groupName string, groupVersion float32, before *model.ConfigGroup, ctx context.Context) {
+	after := s.groupState(groupName, groupVersion, ctx)
+	if before != nil && after != nil {
+		s.quota.TrackGroup(before, after, ctx)
+	}
+	if s.audit == nil {
+		return
+	}
+	resource := configGroupResource(groupName, groupVersion, ctx)
+	if err := s.audit.Record(action, resource, nilIfEmpty(before), nilIfEmpty(after), ctx); err != nil {
+		slog.ErrorContext(ctx, "Error recording audit event", "resource", resource, "error", err)
+	}
 }
@@ -2,33 +2,141 @@ package services
 
 import (
 	"context"
-	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"projekat/model"
+	"slices"
 )
 
 type ConfigGroupService struct {
-	repo model.ConfigGroupRepository
+	repo    model.ConfigGroupRepository
+	audit   *AuditService
+	quota   *QuotaService
+	secrets *SecretService
+	tracer  trace.Tracer
 }
 
 func NewConfigGroupService(repo model.ConfigGroupRepository) ConfigGroupService {
 	return ConfigGroupService{
-		repo: repo,
+		repo:   repo,
+		tracer: noopTracer,
 	}
 }
 
+// WithTracer returns a copy of the service that traces every operation.
+func (s ConfigGroupService) WithTracer(tracer trace.Tracer) ConfigGroupService {
+	s.tracer = tracer
+	return s
+}
+
+// WithAudit returns a copy of the service that records every mutation.
+func (s ConfigGroupService) WithAudit(audit *AuditService) ConfigGroupService {
+	s.audit = audit
+	return s
+}
+
+// WithQuota returns a copy of the service that rejects writes over quota.
+func (s ConfigGroupService) WithQuota(quota *QuotaService) ConfigGroupService {
+	s.quota = quota
+	return s
+}
+
+// WithSecrets returns a copy of the service that encrypts the secret
+// parameters of group members before they are stored.
+func (s ConfigGroupService) WithSecrets(secrets *SecretService) ConfigGroupService {
+	s.secrets = secrets
+	return s
+}
+
 func (s ConfigGroupService) Hello() {
-	fmt.Println("hello from config group service")
+	slog.Info("hello from config group service")
 }
 
-func (s ConfigGroupService) AddConfigGroup(name string, version float32, configurations []model.ConfigForGroup, ctx context.Context) error {
+func (s ConfigGroupService) AddConfigGroup(name string, version float32, configurations []model.ConfigForGroup, ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "ConfigGroupService.AddConfigGroup", trace.WithAttributes(model.GroupAttributes(ctx, name, version)...))
+	defer func() { endSpan(span, err) }()
+
 	config := model.NewConfigGroup(name, version, configurations)
-	return s.repo.AddConfigGroup(config, ctx)
+	if err := s.encryptMembers(config); err != nil {
+		return err
+	}
+	var before *model.ConfigGroup
+	if s.audit != nil || s.quota != nil {
+		if existing, err := s.repo.GetConfigGroup(name, version, ctx); err == nil {
+			before = existing
+		}
+	}
+	config.Owner = model.SubjectFromContext(ctx)
+	if before != nil {
+		config.Owner = before.Owner
+	}
+	if err := s.quota.CheckGroup(config, before, ctx); err != nil {
+		return err
+	}
+	if err := s.repo.AddConfigGroup(config, ctx); err != nil {
+		return err
+	}
+	s.quota.TrackGroup(before, config, ctx)
+	s.recordAudit(model.AuditActionCreate, configGroupResource(name, version, ctx), before, config, ctx)
+	return nil
 }
 
-func (s ConfigGroupService) GetConfigGroup(name string, version float32, ctx context.Context) (*model.ConfigGroup, error) {
-	return s.repo.GetConfigGroup(name, version, ctx)
+// encryptMembers encrypts the secrets of every member of group. The members
+// are copied first so the caller's parameters keep their plaintext.
+func (s ConfigGroupService) encryptMembers(group *model.ConfigGroup) error {
+	group.Configurations = slices.Clone(group.Configurations)
+	for i := range group.Configurations {
+		member := &group.Configurations[i]
+		if len(member.Secrets) == 0 {
+			continue
+		}
+		member.Parameters = copyParameters(member.Parameters)
+		if err := s.secrets.EncryptConfigForGroup(member); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s ConfigGroupService) DeleteConfigGroup(name string, version float32, ctx context.Context) error {
-	return s.repo.DeleteConfigGroup(name, version, ctx)
+// GetConfigGroup returns the group with the secrets of its members decrypted
+// if the request is allowed to reveal them, and masked otherwise.
+func (s ConfigGroupService) GetConfigGroup(name string, version float32, ctx context.Context) (group *model.ConfigGroup, err error) {
+	ctx, span := s.tracer.Start(ctx, "ConfigGroupService.GetConfigGroup", trace.WithAttributes(model.GroupAttributes(ctx, name, version)...))
+	defer func() { endSpan(span, err) }()
+
+	group, err = s.repo.GetConfigGroup(name, version, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if model.RevealFromContext(ctx) {
+		return s.secrets.RevealConfigGroup(group)
+	}
+	return group.Redacted(), nil
+}
+
+func (s ConfigGroupService) DeleteConfigGroup(name string, version float32, ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "ConfigGroupService.DeleteConfigGroup", trace.WithAttributes(model.GroupAttributes(ctx, name, version)...))
+	defer func() { endSpan(span, err) }()
+
+	var before *model.ConfigGroup
+	if s.audit != nil || s.quota != nil {
+		if existing, err := s.repo.GetConfigGroup(name, version, ctx); err == nil {
+			before = existing
+		}
+	}
+	if err := s.repo.DeleteConfigGroup(name, version, ctx); err != nil {
+		return err
+	}
+	s.quota.TrackGroup(before, nil, ctx)
+	s.recordAudit(model.AuditActionDelete, configGroupResource(name, version, ctx), before, nil, ctx)
+	return nil
+}
+
+func (s ConfigGroupService) recordAudit(action string, resource string, before *model.ConfigGroup, after *model.ConfigGroup, ctx context.Context) {
+	if s.audit == nil {
+		return
+	}
+	if err := s.audit.Record(action, resource, nilIfEmpty(before), nilIfEmpty(after), ctx); err != nil {
+		slog.ErrorContext(ctx, "Error recording audit event", "resource", resource, "error", err)
+	}
 }
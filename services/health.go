@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Health statuses of a single dependency and of the service as a whole.
+// A service is degraded when only optional dependencies are down.
+const (
+	HealthUp       = "up"
+	HealthDown     = "down"
+	HealthDegraded = "degraded"
+)
+
+// HealthCheck returns nil when the dependency it probes is usable.
+type HealthCheck func(ctx context.Context) error
+
+type DependencyHealth struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Optional  bool    `json:"optional,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status       string             `json:"status"`
+	Dependencies []DependencyHealth `json:"dependencies"`
+}
+
+// Healthy reports whether every required dependency is up.
+func (r HealthReport) Healthy() bool {
+	return r.Status != HealthDown
+}
+
+// WithoutErrors returns a copy of r without the dependency error messages,
+// which can name internal hosts and are only shown to authenticated callers.
+func (r HealthReport) WithoutErrors() HealthReport {
+	dependencies := make([]DependencyHealth, len(r.Dependencies))
+	for i, dependency := range r.Dependencies {
+		dependency.Error = ""
+		dependencies[i] = dependency
+	}
+	r.Dependencies = dependencies
+	return r
+}
+
+type namedCheck struct {
+	name     string
+	check    HealthCheck
+	optional bool
+}
+
+// HealthService runs the registered dependency checks concurrently, each
+// bounded by timeout.
+type HealthService struct {
+	checks  []namedCheck
+	timeout time.Duration
+}
+
+func NewHealthService(timeout time.Duration) HealthService {
+	return HealthService{timeout: timeout}
+}
+
+func (s HealthService) WithCheck(name string, check HealthCheck) HealthService {
+	checks := make([]namedCheck, len(s.checks), len(s.checks)+1)
+	copy(checks, s.checks)
+	s.checks = append(checks, namedCheck{name, check, false})
+	return s
+}
+
+// WithOptionalCheck registers a check that is reported in detail but never
+// takes the service down, for dependencies such as the trace exporter that
+// requests do not need.
+func (s HealthService) WithOptionalCheck(name string, check HealthCheck) HealthService {
+	s = s.WithCheck(name, check)
+	s.checks[len(s.checks)-1].optional = true
+	return s
+}
+
+// Check reports every dependency in registration order. The service is down
+// when a required dependency is, and degraded when only optional ones are.
+func (s HealthService) Check(ctx context.Context) HealthReport {
+	report := HealthReport{Status: HealthUp, Dependencies: make([]DependencyHealth, len(s.checks))}
+
+	var wg sync.WaitGroup
+	for i, check := range s.checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			report.Dependencies[i] = s.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, dependency := range report.Dependencies {
+		switch {
+		case dependency.Status == HealthUp:
+		case !dependency.Optional:
+			report.Status = HealthDown
+		case report.Status == HealthUp:
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
+
+func (s HealthService) run(ctx context.Context, check namedCheck) DependencyHealth {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := check.check(ctx)
+	result := DependencyHealth{
+		Name:      check.name,
+		Status:    HealthUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Optional:  check.optional,
+	}
+	if err != nil {
+		result.Status = HealthDown
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -2,18 +2,18 @@ package services
 
 import (
 	"context"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"projekat/model"
-	"projekat/repositories"
 )
 
 type IdempotencyService struct {
-	repo   repositories.ConfigConsulRepository
+	repo   model.IdempotencyRepository
 	Tracer trace.Tracer
 }
 
-func NewIdempotencyService(repo repositories.ConfigConsulRepository, tracer trace.Tracer) IdempotencyService {
+func NewIdempotencyService(repo model.IdempotencyRepository, tracer trace.Tracer) IdempotencyService {
 	return IdempotencyService{
 		repo:   repo,
 		Tracer: tracer,
@@ -21,7 +21,11 @@ func NewIdempotencyService(repo repositories.ConfigConsulRepository, tracer trac
 }
 
 func (i IdempotencyService) Add(req *model.IdempotencyRequest, ctx context.Context) error {
-	ctx, span := i.Tracer.Start(ctx, "IdempotencyService.Add")
+	ctx, span := i.Tracer.Start(ctx, "IdempotencyService.Add", trace.WithAttributes(
+		attribute.String("idempotency.key", req.Key),
+		model.AttrNamespace.String(model.NamespaceFromContext(ctx)),
+	))
+	defer span.End()
 	_, err := i.repo.AddIdempotencyRequest(req, ctx)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
@@ -31,16 +35,21 @@ func (i IdempotencyService) Add(req *model.IdempotencyRequest, ctx context.Conte
 	return nil
 }
 
-func (i IdempotencyService) Get(key string, ctx context.Context) (bool, error) {
-	ctx, span := i.Tracer.Start(ctx, "IdempotencyService.Get")
+// Get returns the request that already used key, or nil if it is unused.
+func (i IdempotencyService) Get(key string, ctx context.Context) (*model.IdempotencyRequest, error) {
+	ctx, span := i.Tracer.Start(ctx, "IdempotencyService.Get", trace.WithAttributes(
+		attribute.String("idempotency.key", key),
+		model.AttrNamespace.String(model.NamespaceFromContext(ctx)),
+	))
 	defer span.End()
 
-	exists, err := i.repo.GetIdempotencyRequestByKey(key, ctx)
+	existing, err := i.repo.GetIdempotencyRequestByKey(key, ctx)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return false, err
+		return nil, err
 	}
 
+	span.SetAttributes(attribute.Bool("idempotency.replay", existing != nil))
 	span.SetStatus(codes.Ok, "Service-Ok")
-	return exists, nil
+	return existing, nil
 }
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"projekat/model"
+	"sync"
+	"time"
+)
+
+var (
+	inventoryConfigsDesc = prometheus.NewDesc(
+		"config_inventory_configs",
+		"Number of distinct config names per namespace.",
+		[]string{"namespace"}, nil,
+	)
+	inventoryVersionsDesc = prometheus.NewDesc(
+		"config_inventory_versions",
+		"Number of stored config versions per namespace.",
+		[]string{"namespace"}, nil,
+	)
+	inventoryGroupsDesc = prometheus.NewDesc(
+		"config_inventory_groups",
+		"Number of stored config group versions per namespace.",
+		[]string{"namespace"}, nil,
+	)
+	inventoryGroupMembersDesc = prometheus.NewDesc(
+		"config_inventory_group_members",
+		"Number of configs held by config groups per namespace.",
+		[]string{"namespace"}, nil,
+	)
+	inventoryLabelValuesDesc = prometheus.NewDesc(
+		"config_inventory_label_values",
+		"Number of distinct values of each group member label per namespace.",
+		[]string{"namespace", "label"}, nil,
+	)
+	inventoryRefreshDesc = prometheus.NewDesc(
+		"config_inventory_last_refresh_timestamp_seconds",
+		"Unix time of the last successful inventory refresh.",
+		nil, nil,
+	)
+)
+
+// namespaceInventory is what a single namespace held at the last refresh.
+type namespaceInventory struct {
+	Configs      int
+	Versions     int
+	Groups       int
+	GroupMembers int
+	LabelValues  map[string]int
+}
+
+// InventoryCollector exports configs, versions, groups, group members and
+// label cardinality per namespace. The counts are computed by Refresh and
+// cached, so a scrape never reads the repositories.
+type InventoryCollector struct {
+	configs    model.ConfigRepository
+	groups     model.ConfigGroupRepository
+	namespaces NamespaceService
+
+	mu          sync.RWMutex
+	inventory   map[string]namespaceInventory
+	lastRefresh time.Time
+}
+
+func NewInventoryCollector(configs model.ConfigRepository, groups model.ConfigGroupRepository, namespaces NamespaceService) *InventoryCollector {
+	return &InventoryCollector{
+		configs:    configs,
+		groups:     groups,
+		namespaces: namespaces,
+		inventory:  make(map[string]namespaceInventory),
+	}
+}
+
+func (c *InventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- inventoryConfigsDesc
+	ch <- inventoryVersionsDesc
+	ch <- inventoryGroupsDesc
+	ch <- inventoryGroupMembersDesc
+	ch <- inventoryLabelValuesDesc
+	ch <- inventoryRefreshDesc
+}
+
+func (c *InventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for namespace, inventory := range c.inventory {
+		ch <- prometheus.MustNewConstMetric(inventoryConfigsDesc, prometheus.GaugeValue, float64(inventory.Configs), namespace)
+		ch <- prometheus.MustNewConstMetric(inventoryVersionsDesc, prometheus.GaugeValue, float64(inventory.Versions), namespace)
+		ch <- prometheus.MustNewConstMetric(inventoryGroupsDesc, prometheus.GaugeValue, float64(inventory.Groups), namespace)
+		ch <- prometheus.MustNewConstMetric(inventoryGroupMembersDesc, prometheus.GaugeValue, float64(inventory.GroupMembers), namespace)
+		for label, values := range inventory.LabelValues {
+			ch <- prometheus.MustNewConstMetric(inventoryLabelValuesDesc, prometheus.GaugeValue, float64(values), namespace, label)
+		}
+	}
+	if !c.lastRefresh.IsZero() {
+		ch <- prometheus.MustNewConstMetric(inventoryRefreshDesc, prometheus.GaugeValue, float64(c.lastRefresh.Unix()))
+	}
+}
+
+// Refresh recounts every namespace and replaces the cached inventory. On
+// error the previous inventory is kept.
+func (c *InventoryCollector) Refresh(ctx context.Context) error {
+	namespaces, err := c.namespaces.ListNamespaces(ctx)
+	if err != nil {
+		return err
+	}
+	names := []string{model.DefaultNamespace}
+	for _, namespace := range namespaces {
+		if namespace.Name != model.DefaultNamespace {
+			names = append(names, namespace.Name)
+		}
+	}
+
+	inventory := make(map[string]namespaceInventory, len(names))
+	for _, name := range names {
+		counted, err := c.count(model.ContextWithNamespace(ctx, name))
+		if err != nil {
+			return err
+		}
+		inventory[name] = *counted
+	}
+
+	c.mu.Lock()
+	c.inventory = inventory
+	c.lastRefresh = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *InventoryCollector) count(ctx context.Context) (*namespaceInventory, error) {
+	configs, err := c.configs.ListConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := c.groups.ListConfigGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{})
+	for _, config := range configs {
+		names[config.Name] = struct{}{}
+	}
+	labels := make(map[string]map[string]struct{})
+	members := 0
+	for _, group := range groups {
+		members += len(group.Configurations)
+		for _, member := range group.Configurations {
+			for key, value := range member.Labels {
+				if labels[key] == nil {
+					labels[key] = make(map[string]struct{})
+				}
+				labels[key][value] = struct{}{}
+			}
+		}
+	}
+
+	inventory := &namespaceInventory{
+		Configs:      len(names),
+		Versions:     len(configs),
+		Groups:       len(groups),
+		GroupMembers: members,
+		LabelValues:  make(map[string]int, len(labels)),
+	}
+	for key, values := range labels {
+		inventory.LabelValues[key] = len(values)
+	}
+	return inventory, nil
+}
+
+// Watch refreshes the inventory every interval until stop is closed. A
+// failed refresh is logged and the cached inventory keeps being served.
+func (c *InventoryCollector) Watch(interval time.Duration, stop <-chan struct{}) {
+	c.refreshAndLog()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.refreshAndLog()
+		}
+	}
+}
+
+func (c *InventoryCollector) refreshAndLog() {
+	if err := c.Refresh(context.Background()); err != nil {
+		slog.Error("Failed to refresh inventory metrics", "error", err)
+	}
+}
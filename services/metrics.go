@@ -2,25 +2,91 @@ package services
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	"projekat/metrics"
 )
 
+// httpLabels are the labels of the HTTP request metrics. route is the path
+// template, such as /config/{name}/{version}/, so it stays low-cardinality.
+var httpLabels = []string{"method", "route", "namespace", "status"}
+
 type MetricsService struct {
+	HttpRequests         *prometheus.CounterVec
+	HttpRequestDuration  *prometheus.HistogramVec
+	HttpRequestsInFlight *prometheus.GaugeVec
+	HttpRequestSize      *prometheus.HistogramVec
+	HttpResponseSize     *prometheus.HistogramVec
+
+	// Deprecated: the metrics below are kept for existing dashboards and will
+	// be removed; use HttpRequests and HttpRequestDuration instead.
 	HttpTotalRequests        *prometheus.CounterVec
 	HttpSuccessfulRequests   *prometheus.CounterVec
 	HttpUnsuccessfulRequests *prometheus.CounterVec
-	HttpRequestDuration      *prometheus.HistogramVec
 	AverageRequestDuration   *prometheus.GaugeVec
 	RequestsPerTimeUnit      *prometheus.CounterVec
-	Registry                 *prometheus.Registry
+
+	QuotaUsage          *prometheus.GaugeVec
+	AuditRecordFailures *prometheus.CounterVec
+	Storage             *metrics.Storage
+	Cache               *metrics.Cache
+	Breaker             *metrics.Breaker
+	Registry            *prometheus.Registry
 }
 
 func NewMetricsService() *MetricsService {
 	registry := prometheus.NewRegistry()
 
+	httpRequests := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests by method, route template, namespace and status code.",
+		},
+		httpLabels,
+	)
+	registry.MustRegister(httpRequests)
+
+	httpRequestDuration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request duration by method, route template, namespace and status code.",
+			Buckets: prometheus.DefBuckets,
+		},
+		httpLabels,
+	)
+	registry.MustRegister(httpRequestDuration)
+
+	httpRequestsInFlight := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests currently being served, by method and route template.",
+		},
+		[]string{"method", "route"},
+	)
+	registry.MustRegister(httpRequestsInFlight)
+
+	httpRequestSize := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_size_bytes",
+			Help:    "HTTP request body size by method, route template, namespace and status code.",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+		},
+		httpLabels,
+	)
+	registry.MustRegister(httpRequestSize)
+
+	httpResponseSize := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "HTTP response body size by method, route template, namespace and status code.",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+		},
+		httpLabels,
+	)
+	registry.MustRegister(httpResponseSize)
+
 	httpTotalRequests := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_total_requests",
-			Help: "Total number of HTTP requests in last 24h",
+			Help: "Deprecated: use http_requests_total. Total number of HTTP requests.",
 		},
 		[]string{},
 	)
@@ -29,7 +95,7 @@ func NewMetricsService() *MetricsService {
 	httpSuccessfulRequests := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_successful_requests",
-			Help: "Number of successful HTTP requests in last 24h (2xx, 3xx).",
+			Help: "Deprecated: use http_requests_total. Number of successful HTTP requests (2xx, 3xx).",
 		},
 		[]string{},
 	)
@@ -38,7 +104,7 @@ func NewMetricsService() *MetricsService {
 	httpUnsuccessfulRequests := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_unsuccessful_requests",
-			Help: "Number of unsuccessful HTTP requests in last 24h (4xx, 5xx).",
+			Help: "Deprecated: use http_requests_total. Number of unsuccessful HTTP requests (4xx, 5xx).",
 		},
 		[]string{},
 	)
@@ -47,7 +113,7 @@ func NewMetricsService() *MetricsService {
 	averageRequestDuration := prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "average_request_duration_seconds",
-			Help: "Average request duration for each endpoint.",
+			Help: "Deprecated: use http_request_duration_seconds. Duration of the last request for each endpoint.",
 		},
 		[]string{"method", "endpoint"},
 	)
@@ -56,18 +122,46 @@ func NewMetricsService() *MetricsService {
 	requestsPerTimeUnit := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "requests_per_time_unit",
-			Help: "Number of requests per time unit (e.g., per minute or per second) for each endpoint.",
+			Help: "Deprecated: use http_requests_total. Number of requests for each endpoint.",
 		},
 		[]string{"method", "endpoint", "time_unit"},
 	)
 	registry.MustRegister(requestsPerTimeUnit)
 
+	quotaUsage := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "config_quota_usage",
+			Help: "Current usage counted against quotas, per namespace and resource (configs, versions, groups, group_members, bytes).",
+		},
+		[]string{"namespace", "resource"},
+	)
+	registry.MustRegister(quotaUsage)
+
+	auditRecordFailures := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_record_failures_total",
+			Help: "Number of audit events that could not be stored, by action. The mutations they describe were applied.",
+		},
+		[]string{"action"},
+	)
+	registry.MustRegister(auditRecordFailures)
+
 	return &MetricsService{
+		HttpRequests:             httpRequests,
+		HttpRequestDuration:      httpRequestDuration,
+		HttpRequestsInFlight:     httpRequestsInFlight,
+		HttpRequestSize:          httpRequestSize,
+		HttpResponseSize:         httpResponseSize,
 		HttpTotalRequests:        httpTotalRequests,
 		HttpSuccessfulRequests:   httpSuccessfulRequests,
 		HttpUnsuccessfulRequests: httpUnsuccessfulRequests,
 		AverageRequestDuration:   averageRequestDuration,
 		RequestsPerTimeUnit:      requestsPerTimeUnit,
+		QuotaUsage:               quotaUsage,
+		AuditRecordFailures:      auditRecordFailures,
+		Storage:                  metrics.NewStorage(registry),
+		Cache:                    metrics.NewCache(registry),
+		Breaker:                  metrics.NewBreaker(registry),
 		Registry:                 registry,
 	}
 }
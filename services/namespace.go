@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"projekat/model"
+)
+
+var (
+	ErrInvalidNamespace  = errors.New("namespace names must be lowercase alphanumerics and dashes, at most 63 characters")
+	ErrNamespaceExists   = errors.New("namespace already exists")
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	ErrNamespaceNotEmpty = errors.New("namespace still contains configs or groups")
+	ErrNamespaceReserved = errors.New("the default namespace cannot be deleted")
+)
+
+type NamespaceService struct {
+	repo   model.NamespaceRepository
+	audit  *AuditService
+	tracer trace.Tracer
+}
+
+func NewNamespaceService(repo model.NamespaceRepository) NamespaceService {
+	return NamespaceService{
+		repo:   repo,
+		tracer: noopTracer,
+	}
+}
+
+// WithTracer returns a copy of the service that traces every operation.
+func (s NamespaceService) WithTracer(tracer trace.Tracer) NamespaceService {
+	s.tracer = tracer
+	return s
+}
+
+// WithAudit returns a copy of the service that records every mutation.
+func (s NamespaceService) WithAudit(audit *AuditService) NamespaceService {
+	s.audit = audit
+	return s
+}
+
+// GetNamespace returns the named namespace. The default namespace always
+// exists, even before it has been stored with an explicit quota. Only a
+// missing entry is reported as ErrNamespaceNotFound; storage errors are
+// returned as they are.
+func (s NamespaceService) GetNamespace(name string, ctx context.Context) (namespace *model.Namespace, err error) {
+	ctx, span := s.tracer.Start(ctx, "NamespaceService.GetNamespace", trace.WithAttributes(model.AttrNamespace.String(name)))
+	defer func() { endSpan(span, err) }()
+
+	namespace, err = s.repo.GetNamespace(name, ctx)
+	if err == nil {
+		return namespace, nil
+	}
+	if !errors.Is(err, model.ErrNotFound) {
+		return nil, err
+	}
+	if name == model.DefaultNamespace {
+		return &model.Namespace{Name: model.DefaultNamespace}, nil
+	}
+	return nil, ErrNamespaceNotFound
+}
+
+func (s NamespaceService) ListNamespaces(ctx context.Context) (namespaces []model.Namespace, err error) {
+	ctx, span := s.tracer.Start(ctx, "NamespaceService.ListNamespaces")
+	defer func() { endSpan(span, err) }()
+
+	namespaces, err = s.repo.ListNamespaces(ctx)
+	span.SetAttributes(model.AttrResultCount.Int(len(namespaces)))
+	return namespaces, err
+}
+
+func (s NamespaceService) AddNamespace(namespace *model.Namespace, ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "NamespaceService.AddNamespace", trace.WithAttributes(model.AttrNamespace.String(namespace.Name)))
+	defer func() { endSpan(span, err) }()
+
+	if !model.ValidNamespaceName(namespace.Name) {
+		return ErrInvalidNamespace
+	}
+	if _, err := s.repo.GetNamespace(namespace.Name, ctx); err == nil {
+		return ErrNamespaceExists
+	} else if !errors.Is(err, model.ErrNotFound) {
+		return err
+	}
+	if err := s.repo.AddNamespace(namespace, ctx); err != nil {
+		return err
+	}
+	s.recordAudit(model.AuditActionCreate, namespace.Name, nil, namespace, ctx)
+	return nil
+}
+
+func (s NamespaceService) DeleteNamespace(name string, ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "NamespaceService.DeleteNamespace", trace.WithAttributes(model.AttrNamespace.String(name)))
+	defer func() { endSpan(span, err) }()
+
+	if name == model.DefaultNamespace {
+		return ErrNamespaceReserved
+	}
+	before, err := s.repo.GetNamespace(name, ctx)
+	if errors.Is(err, model.ErrNotFound) {
+		return ErrNamespaceNotFound
+	}
+	if err != nil {
+		return err
+	}
+	empty, err := s.repo.IsNamespaceEmpty(name, ctx)
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return ErrNamespaceNotEmpty
+	}
+	if err := s.repo.DeleteNamespace(name, ctx); err != nil {
+		return err
+	}
+	s.recordAudit(model.AuditActionDelete, name, before, nil, ctx)
+	return nil
+}
+
+func (s NamespaceService) recordAudit(action string, name string, before *model.Namespace, after *model.Namespace, ctx context.Context) {
+	if s.audit == nil {
+		return
+	}
+	resource := "namespace/" + name
+	if err := s.audit.Record(action, resource, nilIfEmpty(before), nilIfEmpty(after), ctx); err != nil {
+		slog.ErrorContext(ctx, "Error recording audit event", "resource", resource, "error", err)
+	}
+}
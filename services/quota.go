@@ -0,0 +1,403 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+	"maps"
+	"os"
+	"projekat/model"
+	"sync"
+	"time"
+)
+
+// QuotaError describes the limit a write would exceed. TooLarge is set when
+// the request itself is too big, as opposed to the namespace being full.
+type QuotaError struct {
+	model.QuotaExceeded
+	TooLarge bool `json:"-"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s is limited to %d, request needs %d", e.Limit, e.Max, e.Requested)
+}
+
+// QuotaPolicy holds the quotas that apply regardless of namespace: a default
+// for every caller and overrides per principal subject.
+type QuotaPolicy struct {
+	Default    model.Quota            `yaml:"default"`
+	Principals map[string]model.Quota `yaml:"principals"`
+}
+
+func LoadQuotaPolicy(file string) (*QuotaPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading quota file: %w", err)
+	}
+	var policy QuotaPolicy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("parsing quota file: %w", err)
+	}
+	return &policy, nil
+}
+
+// DefaultUsageTTL is how long usage counted from storage is trusted. Writes
+// through this service keep it current; the TTL bounds how long writes made by
+// other replicas go unnoticed.
+const DefaultUsageTTL = 30 * time.Second
+
+// Usage is what a namespace, or one owner within it, currently stores.
+type Usage struct {
+	Configs      int
+	Versions     map[string]int
+	Groups       int
+	GroupMembers int
+	TotalBytes   int64
+}
+
+func newUsage() *Usage {
+	return &Usage{Versions: make(map[string]int)}
+}
+
+// addConfig counts config once more, or once less for a negative delta.
+func (u *Usage) addConfig(config *model.Config, delta int) {
+	u.Versions[config.Name] += delta
+	if u.Versions[config.Name] <= 0 {
+		delete(u.Versions, config.Name)
+	}
+	u.Configs = len(u.Versions)
+	u.TotalBytes += int64(delta) * encodedSize(config)
+}
+
+func (u *Usage) addGroup(group *model.ConfigGroup, delta int) {
+	u.Groups += delta
+	u.GroupMembers += delta * len(group.Configurations)
+	u.TotalBytes += int64(delta) * encodedSize(group)
+}
+
+func (u *Usage) copy() *Usage {
+	copied := *u
+	copied.Versions = maps.Clone(u.Versions)
+	return &copied
+}
+
+// namespaceUsage is the cached usage of one namespace, in total and per
+// owner.
+type namespaceUsage struct {
+	total    *Usage
+	owners   map[string]*Usage
+	loadedAt time.Time
+}
+
+func (n *namespaceUsage) owner(subject string) *Usage {
+	usage, ok := n.owners[subject]
+	if !ok {
+		usage = newUsage()
+		n.owners[subject] = usage
+	}
+	return usage
+}
+
+func (n *namespaceUsage) addConfig(config *model.Config, delta int) {
+	if config != nil {
+		n.total.addConfig(config, delta)
+		n.owner(config.Owner).addConfig(config, delta)
+	}
+}
+
+func (n *namespaceUsage) addGroup(group *model.ConfigGroup, delta int) {
+	if group != nil {
+		n.total.addGroup(group, delta)
+		n.owner(group.Owner).addGroup(group, delta)
+	}
+}
+
+// QuotaService enforces the namespace quota against everything stored in the
+// namespace, and the quota of the calling principal against what that
+// principal owns there. Usage is counted from storage once per namespace and
+// then kept up to date by the Track methods.
+type QuotaService struct {
+	configs    model.ConfigRepository
+	groups     model.ConfigGroupRepository
+	namespaces NamespaceService
+	policy     QuotaPolicy
+	metrics    *MetricsService
+	usageTTL   time.Duration
+	now        func() time.Time
+	tracer     trace.Tracer
+
+	mu    sync.Mutex
+	usage map[string]*namespaceUsage
+}
+
+func NewQuotaService(configs model.ConfigRepository, groups model.ConfigGroupRepository, namespaces NamespaceService, policy *QuotaPolicy, metrics *MetricsService) *QuotaService {
+	s := &QuotaService{
+		configs:    configs,
+		groups:     groups,
+		namespaces: namespaces,
+		metrics:    metrics,
+		usageTTL:   DefaultUsageTTL,
+		now:        time.Now,
+		tracer:     noopTracer,
+		usage:      make(map[string]*namespaceUsage),
+	}
+	if policy != nil {
+		s.policy = *policy
+	}
+	return s
+}
+
+// SetUsageTTL sets how long usage counted from storage is trusted.
+func (s *QuotaService) SetUsageTTL(ttl time.Duration) {
+	s.usageTTL = ttl
+}
+
+// SetTracer traces quota checks and usage counts with tracer.
+func (s *QuotaService) SetTracer(tracer trace.Tracer) {
+	s.tracer = tracer
+}
+
+// tighter keeps the smaller of two limits, where zero means unlimited.
+func tighter[T int | int64](a T, b T) T {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// quotas returns the quota of the namespace in ctx and the quota and subject
+// of the calling principal. Anonymous callers share the default quota.
+func (s *QuotaService) quotas(ctx context.Context) (namespace model.Quota, principal model.Quota, subject string) {
+	principal = s.policy.Default
+	subject = model.SubjectFromContext(ctx)
+	if override, ok := s.policy.Principals[subject]; ok && subject != "" {
+		principal = override
+	}
+	if stored, err := s.namespaces.GetNamespace(model.NamespaceFromContext(ctx), ctx); err == nil {
+		namespace = stored.Quota
+	}
+	return namespace, principal, subject
+}
+
+// entryQuota combines two quotas for the limits on a single entry, where the
+// strictest configured value wins.
+func entryQuota(a model.Quota, b model.Quota) model.Quota {
+	return model.Quota{
+		MaxMembersPerGroup:    tighter(a.MaxMembersPerGroup, b.MaxMembersPerGroup),
+		MaxParametersPerEntry: tighter(a.MaxParametersPerEntry, b.MaxParametersPerEntry),
+	}
+}
+
+func encodedSize(v interface{}) int64 {
+	data, _ := json.Marshal(v)
+	return int64(len(data))
+}
+
+// load returns the cached usage of the namespace in ctx, counting it from
+// storage when it is missing or older than the usage TTL.
+func (s *QuotaService) load(ctx context.Context) (_ *namespaceUsage, err error) {
+	namespace := model.NamespaceFromContext(ctx)
+	s.mu.Lock()
+	cached, ok := s.usage[namespace]
+	s.mu.Unlock()
+	if ok && s.now().Sub(cached.loadedAt) < s.usageTTL {
+		return cached, nil
+	}
+
+	ctx, span := s.tracer.Start(ctx, "QuotaService.CountUsage", trace.WithAttributes(model.AttrNamespace.String(namespace)))
+	defer func() { endSpan(span, err) }()
+	configs, err := s.configs.ListConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.groups.ListConfigGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usage := &namespaceUsage{total: newUsage(), owners: make(map[string]*Usage), loadedAt: s.now()}
+	for i := range configs {
+		usage.addConfig(&configs[i], 1)
+	}
+	for i := range groups {
+		usage.addGroup(&groups[i], 1)
+	}
+	span.SetAttributes(model.AttrResultCount.Int(len(configs) + len(groups)))
+
+	s.mu.Lock()
+	s.usage[namespace] = usage
+	s.observe(namespace, usage.total)
+	s.mu.Unlock()
+	return usage, nil
+}
+
+// Usage returns what the namespace in ctx currently stores.
+func (s *QuotaService) Usage(ctx context.Context) (*Usage, error) {
+	usage, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return usage.total.copy(), nil
+}
+
+// check runs check against the namespace usage under the namespace quota and,
+// when the caller owns the entry being written, against the caller's usage
+// under the principal quota.
+func (s *QuotaService) check(owner string, ctx context.Context, check func(quota model.Quota, usage *Usage) error) error {
+	namespaceQuota, principalQuota, subject := s.quotas(ctx)
+	usage, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := check(namespaceQuota, usage.total); err != nil {
+		return err
+	}
+	if owner != subject {
+		return nil
+	}
+	return check(principalQuota, usage.owner(subject))
+}
+
+// TrackConfig updates the cached usage after config before was replaced by
+// after. Either may be nil for a create or a delete.
+func (s *QuotaService) TrackConfig(before *model.Config, after *model.Config, ctx context.Context) {
+	s.track(ctx, func(usage *namespaceUsage) {
+		usage.addConfig(before, -1)
+		usage.addConfig(after, 1)
+	})
+}
+
+// TrackGroup updates the cached usage after group before was replaced by
+// after. Either may be nil for a create or a delete.
+func (s *QuotaService) TrackGroup(before *model.ConfigGroup, after *model.ConfigGroup, ctx context.Context) {
+	s.track(ctx, func(usage *namespaceUsage) {
+		usage.addGroup(before, -1)
+		usage.addGroup(after, 1)
+	})
+}
+
+func (s *QuotaService) track(ctx context.Context, update func(usage *namespaceUsage)) {
+	if s == nil {
+		return
+	}
+	namespace := model.NamespaceFromContext(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if usage, ok := s.usage[namespace]; ok {
+		update(usage)
+		s.observe(namespace, usage.total)
+	}
+}
+
+// observe exports the usage of namespace. The caller must hold s.mu.
+func (s *QuotaService) observe(namespace string, usage *Usage) {
+	if s.metrics == nil {
+		return
+	}
+	versions := 0
+	for _, count := range usage.Versions {
+		versions += count
+	}
+	s.metrics.QuotaUsage.WithLabelValues(namespace, "configs").Set(float64(usage.Configs))
+	s.metrics.QuotaUsage.WithLabelValues(namespace, "versions").Set(float64(versions))
+	s.metrics.QuotaUsage.WithLabelValues(namespace, "groups").Set(float64(usage.Groups))
+	s.metrics.QuotaUsage.WithLabelValues(namespace, "group_members").Set(float64(usage.GroupMembers))
+	s.metrics.QuotaUsage.WithLabelValues(namespace, "bytes").Set(float64(usage.TotalBytes))
+}
+
+func checkLimit(limit string, max int64, requested int64, tooLarge bool) error {
+	if max > 0 && requested > max {
+		return &QuotaError{QuotaExceeded: model.QuotaExceeded{Limit: limit, Max: max, Requested: requested}, TooLarge: tooLarge}
+	}
+	return nil
+}
+
+// CheckConfig validates writing config over existing, which is nil for a new
+// entry.
+func (s *QuotaService) CheckConfig(config *model.Config, existing *model.Config, ctx context.Context) (err error) {
+	if s == nil {
+		return nil
+	}
+	ctx, span := s.tracer.Start(ctx, "QuotaService.CheckConfig", trace.WithAttributes(model.ConfigAttributes(ctx, config.Name, config.Version)...))
+	defer func() { endSpan(span, err) }()
+	namespaceQuota, principalQuota, _ := s.quotas(ctx)
+	quota := entryQuota(namespaceQuota, principalQuota)
+	if err := checkLimit("parametersPerEntry", int64(quota.MaxParametersPerEntry), int64(len(config.Parameters)), true); err != nil {
+		return err
+	}
+
+	return s.check(config.Owner, ctx, func(quota model.Quota, usage *Usage) error {
+		added := encodedSize(config)
+		if existing != nil {
+			added -= encodedSize(existing)
+		} else {
+			if usage.Versions[config.Name] == 0 {
+				if err := checkLimit("configs", int64(quota.MaxConfigs), int64(usage.Configs+1), false); err != nil {
+					return err
+				}
+			}
+			if err := checkLimit("versionsPerConfig", int64(quota.MaxVersionsPerConfig), int64(usage.Versions[config.Name]+1), false); err != nil {
+				return err
+			}
+		}
+		return checkLimit("totalBytes", quota.MaxTotalBytes, usage.TotalBytes+added, true)
+	})
+}
+
+// CheckGroup validates writing group over existing, which is nil for a new
+// entry.
+func (s *QuotaService) CheckGroup(group *model.ConfigGroup, existing *model.ConfigGroup, ctx context.Context) (err error) {
+	if s == nil {
+		return nil
+	}
+	ctx, span := s.tracer.Start(ctx, "QuotaService.CheckGroup", trace.WithAttributes(model.GroupAttributes(ctx, group.Name, group.Version)...))
+	defer func() { endSpan(span, err) }()
+	namespaceQuota, principalQuota, _ := s.quotas(ctx)
+	quota := entryQuota(namespaceQuota, principalQuota)
+	if err := checkLimit("membersPerGroup", int64(quota.MaxMembersPerGroup), int64(len(group.Configurations)), true); err != nil {
+		return err
+	}
+	for _, member := range group.Configurations {
+		if err := checkLimit("parametersPerEntry", int64(quota.MaxParametersPerEntry), int64(len(member.Parameters)), true); err != nil {
+			return err
+		}
+	}
+
+	return s.check(group.Owner, ctx, func(quota model.Quota, usage *Usage) error {
+		added := encodedSize(group)
+		if existing != nil {
+			added -= encodedSize(existing)
+		} else if err := checkLimit("groups", int64(quota.MaxGroups), int64(usage.Groups+1), false); err != nil {
+			return err
+		}
+		return checkLimit("totalBytes", quota.MaxTotalBytes, usage.TotalBytes+added, true)
+	})
+}
+
+// CheckGroupMember validates adding member to group, which must already exist.
+// The member counts against the owner of the group.
+func (s *QuotaService) CheckGroupMember(member *model.ConfigForGroup, group *model.ConfigGroup, ctx context.Context) (err error) {
+	if s == nil || group == nil {
+		return nil
+	}
+	ctx, span := s.tracer.Start(ctx, "QuotaService.CheckGroupMember", trace.WithAttributes(model.GroupAttributes(ctx, group.Name, group.Version)...))
+	span.SetAttributes(model.AttrConfigName.String(member.Name))
+	defer func() { endSpan(span, err) }()
+	namespaceQuota, principalQuota, _ := s.quotas(ctx)
+	quota := entryQuota(namespaceQuota, principalQuota)
+	if err := checkLimit("parametersPerEntry", int64(quota.MaxParametersPerEntry), int64(len(member.Parameters)), true); err != nil {
+		return err
+	}
+	if err := checkLimit("membersPerGroup", int64(quota.MaxMembersPerGroup), int64(len(group.Configurations)+1), false); err != nil {
+		return err
+	}
+
+	return s.check(group.Owner, ctx, func(quota model.Quota, usage *Usage) error {
+		return checkLimit("totalBytes", quota.MaxTotalBytes, usage.TotalBytes+encodedSize(member), true)
+	})
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+	"log/slog"
+	"projekat/model"
+	"time"
+)
+
+// maxCASAttempts bounds how often a replica retries when other replicas keep
+// winning the check-and-set race on the same window counter. A request that
+// still loses is denied rather than counted by the local limiter.
+const maxCASAttempts = 10
+
+type RateLimitService struct {
+	repo     model.RateLimitRepository
+	fallback *rate.Limiter
+	limit    uint64
+	window   time.Duration
+	now      func() time.Time
+	Tracer   trace.Tracer
+}
+
+// NewRateLimitService returns a limiter that allows limit requests per window.
+// When repo is nil, or the shared backend fails, the in-process token bucket
+// with the same average rate is used instead.
+func NewRateLimitService(repo model.RateLimitRepository, limit int, window time.Duration, tracer trace.Tracer) *RateLimitService {
+	return &RateLimitService{
+		repo:     repo,
+		fallback: rate.NewLimiter(rate.Limit(float64(limit)/window.Seconds()), limit),
+		limit:    uint64(limit),
+		window:   window,
+		now:      time.Now,
+		Tracer:   tracer,
+	}
+}
+
+// SetClock replaces the time source of the shared and the local limiter,
+// which lets tests move between windows.
+func (s *RateLimitService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+func (s *RateLimitService) Allow(bucket string, ctx context.Context) bool {
+	if s.repo == nil {
+		return s.fallback.AllowN(s.now(), 1)
+	}
+
+	ctx, span := s.Tracer.Start(ctx, "RateLimitService.Allow")
+	defer span.End()
+	span.SetAttributes(attribute.String("ratelimit.bucket", bucket))
+
+	allowed, err := s.allowSlidingWindow(bucket, ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Shared rate limiter unavailable, using local limiter", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(attribute.Bool("ratelimit.fallback", true))
+		return s.fallback.AllowN(s.now(), 1)
+	}
+
+	span.SetAttributes(attribute.Bool("ratelimit.allowed", allowed))
+	span.SetStatus(codes.Ok, "")
+	return allowed
+}
+
+// allowSlidingWindow approximates a sliding window by weighting the previous
+// fixed window's count by how much of it still overlaps the sliding window.
+// Only storage errors are returned; losing the counter race maxCASAttempts
+// times denies the request.
+func (s *RateLimitService) allowSlidingWindow(bucket string, ctx context.Context) (bool, error) {
+	now := s.now()
+	current := now.Truncate(s.window)
+	previous := current.Add(-s.window)
+	overlap := 1 - float64(now.Sub(current))/float64(s.window)
+
+	currentKey := windowKey(bucket, current)
+	previousCount, _, err := s.repo.GetCounter(windowKey(bucket, previous), ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		count, index, err := s.repo.GetCounter(currentKey, ctx)
+		if err != nil {
+			return false, err
+		}
+
+		if float64(previousCount)*overlap+float64(count) >= float64(s.limit) {
+			return false, nil
+		}
+
+		ok, err := s.repo.SetCounter(currentKey, count+1, index, ctx)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			if index == 0 {
+				// First hit in a new window: the counter from two windows ago
+				// can no longer affect any decision.
+				_ = s.repo.DeleteCounter(windowKey(bucket, previous.Add(-s.window)), ctx)
+			}
+			return true, nil
+		}
+	}
+
+	slog.DebugContext(ctx, "Rate limit counter is too contended, denying request", "key", currentKey)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("ratelimit.contended", true))
+	return false, nil
+}
+
+func windowKey(bucket string, start time.Time) string {
+	return fmt.Sprintf("%s/%d", bucket, start.Unix())
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"projekat/model"
+	"strings"
+)
+
+const (
+	encryptedPrefix = "enc:v1:"
+	// MaskedValue replaces secret parameters for callers without reveal access.
+	MaskedValue = model.MaskedValue
+)
+
+var (
+	ErrNoKeyring      = errors.New("secret parameters require a master key file")
+	ErrUnknownKey     = errors.New("secret was encrypted with an unknown master key")
+	ErrSecretNotFound = errors.New("secret parameter is not a parameter of the config")
+)
+
+// Keyring is the master key file. Keys are base64-encoded 256-bit AES keys;
+// new data keys are wrapped with Active, older keys stay for decryption until
+// every secret has been re-wrapped.
+type Keyring struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+type SecretService struct {
+	active   string
+	keys     map[string]cipher.AEAD
+	stateKey []byte
+}
+
+func LoadKeyring(file string) (*SecretService, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading master key file: %w", err)
+	}
+	var keyring Keyring
+	if err := json.Unmarshal(data, &keyring); err != nil {
+		return nil, fmt.Errorf("parsing master key file: %w", err)
+	}
+	return NewSecretService(keyring)
+}
+
+func NewSecretService(keyring Keyring) (*SecretService, error) {
+	s := &SecretService{active: keyring.Active, keys: make(map[string]cipher.AEAD)}
+	for id, encoded := range keyring.Keys {
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("master key id %q must not contain ':'", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("master key %q must be 32 base64-encoded bytes", id)
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		s.keys[id] = aead
+		if id == s.active {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte("audit-state"))
+			s.stateKey = mac.Sum(nil)
+		}
+	}
+	if _, ok := s.keys[s.active]; !ok {
+		return nil, fmt.Errorf("active master key %q is not in the key file", s.active)
+	}
+	return s, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// Encrypt seals value under a fresh data key and wraps that key with the
+// active master key. The parameter name is bound as additional data so a
+// ciphertext cannot be moved to another parameter.
+func (s *SecretService) Encrypt(parameter string, value string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(s.keys[s.active], dataKey, []byte(s.active))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(value), []byte(parameter))
+	if err != nil {
+		return "", err
+	}
+	return envelope(s.active, wrapped, ciphertext), nil
+}
+
+// StateKey returns the key audit entries use to hash plaintext secret values.
+// It is derived from the active master key and never used for encryption.
+func (s *SecretService) StateKey() []byte {
+	return s.stateKey
+}
+
+// Check encrypts and decrypts a probe value to confirm the active master key
+// is loaded and usable.
+func (s *SecretService) Check(ctx context.Context) error {
+	if s == nil {
+		return ErrNoKeyring
+	}
+	sealed, err := s.Encrypt("health", "probe")
+	if err != nil {
+		return err
+	}
+	if _, err := s.Decrypt("health", sealed); err != nil {
+		return err
+	}
+	return nil
+}
+
+func envelope(keyID string, wrapped []byte, ciphertext []byte) string {
+	return encryptedPrefix + keyID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext)
+}
+
+func (s *SecretService) unwrap(value string) (keyID string, dataKey []byte, ciphertext []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	master, ok := s.keys[parts[0]]
+	if !ok {
+		return "", nil, nil, ErrUnknownKey
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	ciphertext, err = base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	dataKey, err = open(master, wrapped, []byte(parts[0]))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return parts[0], dataKey, ciphertext, nil
+}
+
+func (s *SecretService) Decrypt(parameter string, value string) (string, error) {
+	_, dataKey, ciphertext, err := s.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, ciphertext, []byte(parameter))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap wraps the data key of value with the active master key when it was
+// wrapped by an older one. The encrypted parameter value itself is unchanged.
+func (s *SecretService) Rewrap(value string) (string, bool, error) {
+	keyID, dataKey, ciphertext, err := s.unwrap(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == s.active {
+		return value, false, nil
+	}
+	wrapped, err := seal(s.keys[s.active], dataKey, []byte(s.active))
+	if err != nil {
+		return "", false, err
+	}
+	return envelope(s.active, wrapped, ciphertext), true, nil
+}
+
+// EncryptConfig encrypts every parameter listed in config.Secrets in place.
+func (s *SecretService) EncryptConfig(config *model.Config) error {
+	return s.encryptParameters(config.Parameters, config.Secrets)
+}
+
+// EncryptConfigForGroup encrypts every parameter listed in config.Secrets in
+// place.
+func (s *SecretService) EncryptConfigForGroup(config *model.ConfigForGroup) error {
+	return s.encryptParameters(config.Parameters, config.Secrets)
+}
+
+func (s *SecretService) encryptParameters(parameters map[string]string, secrets []string) error {
+	if len(secrets) == 0 {
+		return nil
+	}
+	if s == nil {
+		return ErrNoKeyring
+	}
+	for _, name := range secrets {
+		value, ok := parameters[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		}
+		if IsEncrypted(value) {
+			continue
+		}
+		encrypted, err := s.Encrypt(name, value)
+		if err != nil {
+			return err
+		}
+		parameters[name] = encrypted
+	}
+	return nil
+}
+
+// RevealConfig returns a copy of config with its secrets decrypted.
+func (s *SecretService) RevealConfig(config *model.Config) (*model.Config, error) {
+	if len(config.Secrets) == 0 {
+		return config, nil
+	}
+	parameters, err := s.revealParameters(config.Parameters, config.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	revealed := *config
+	revealed.Parameters = parameters
+	return &revealed, nil
+}
+
+// RevealConfigForGroup returns a copy of config with its secrets decrypted.
+func (s *SecretService) RevealConfigForGroup(config *model.ConfigForGroup) (*model.ConfigForGroup, error) {
+	if len(config.Secrets) == 0 {
+		return config, nil
+	}
+	parameters, err := s.revealParameters(config.Parameters, config.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	revealed := *config
+	revealed.Parameters = parameters
+	return &revealed, nil
+}
+
+// RevealConfigGroup returns a copy of group with the secrets of every member
+// decrypted.
+func (s *SecretService) RevealConfigGroup(group *model.ConfigGroup) (*model.ConfigGroup, error) {
+	revealed := *group
+	revealed.Configurations = make([]model.ConfigForGroup, len(group.Configurations))
+	for i := range group.Configurations {
+		member, err := s.RevealConfigForGroup(&group.Configurations[i])
+		if err != nil {
+			return nil, err
+		}
+		revealed.Configurations[i] = *member
+	}
+	return &revealed, nil
+}
+
+// revealParameters returns a copy of parameters with secrets decrypted.
+func (s *SecretService) revealParameters(parameters map[string]string, secrets []string) (map[string]string, error) {
+	if s == nil {
+		return nil, ErrNoKeyring
+	}
+	revealed := copyParameters(parameters)
+	for _, name := range secrets {
+		if value, ok := revealed[name]; ok && IsEncrypted(value) {
+			plaintext, err := s.Decrypt(name, value)
+			if err != nil {
+				return nil, fmt.Errorf("decrypting %s: %w", name, err)
+			}
+			revealed[name] = plaintext
+		}
+	}
+	return revealed, nil
+}
+
+// MaskConfig returns a copy of config with its explicit secrets and every
+// parameter matching a secret pattern replaced by MaskedValue.
+func MaskConfig(config *model.Config) *model.Config {
+	return config.Redacted()
+}
+
+func copyConfig(config *model.Config) *model.Config {
+	copied := *config
+	copied.Parameters = copyParameters(config.Parameters)
+	return &copied
+}
+
+func copyParameters(parameters map[string]string) map[string]string {
+	copied := make(map[string]string, len(parameters))
+	for k, v := range parameters {
+		copied[k] = v
+	}
+	return copied
+}
+
+// RewrapConfig re-wraps every secret of config under the active master key
+// and reports whether anything changed.
+func (s *SecretService) RewrapConfig(config *model.Config) (bool, error) {
+	return s.rewrapParameters(config.Parameters, config.Secrets)
+}
+
+// RewrapConfigGroup re-wraps the secrets of every member of group under the
+// active master key and reports whether anything changed.
+func (s *SecretService) RewrapConfigGroup(group *model.ConfigGroup) (bool, error) {
+	changed := false
+	for i := range group.Configurations {
+		member := &group.Configurations[i]
+		updated, err := s.rewrapParameters(member.Parameters, member.Secrets)
+		if err != nil {
+			return false, fmt.Errorf("member %s: %w", member.Name, err)
+		}
+		changed = changed || updated
+	}
+	return changed, nil
+}
+
+func (s *SecretService) rewrapParameters(parameters map[string]string, secrets []string) (bool, error) {
+	changed := false
+	for _, name := range secrets {
+		value, ok := parameters[name]
+		if !ok || !IsEncrypted(value) {
+			continue
+		}
+		rewrapped, updated, err := s.Rewrap(value)
+		if err != nil {
+			return false, fmt.Errorf("re-wrapping %s: %w", name, err)
+		}
+		if updated {
+			parameters[name] = rewrapped
+			changed = true
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"projekat/model"
+)
+
+// noopTracer is used by services that were not given a tracer.
+var noopTracer = noop.NewTracerProvider().Tracer("projekat/services")
+
+// endSpan records err on span and ends it. Only failures of the service
+// itself mark the span failed; missing entries, quota and validation errors
+// are the caller's and are recorded as events only.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		if !callerError(err) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+func callerError(err error) bool {
+	var quotaErr *QuotaError
+	switch {
+	case errors.Is(err, model.ErrNotFound), errors.As(err, &quotaErr):
+		return true
+	case errors.Is(err, ErrInvalidNamespace), errors.Is(err, ErrNamespaceExists), errors.Is(err, ErrNamespaceNotFound),
+		errors.Is(err, ErrNamespaceNotEmpty), errors.Is(err, ErrNamespaceReserved):
+		return true
+	case errors.Is(err, ErrNoKeyring), errors.Is(err, ErrSecretNotFound):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"log/slog"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"testing"
+	"time"
+)
+
+func TestAuditRecordsMutations(t *testing.T) {
+	repo := repositories.NewAuditInMemRepository()
+	audit := services.NewAuditService(repo, noop.NewTracerProvider().Tracer("test"))
+	configs := services.NewConfigService(repositories.NewConfigInMemRepository()).WithAudit(audit)
+
+	ctx := model.ContextWithPrincipal(context.Background(), &model.Principal{Subject: "alice"})
+	require.NoError(t, configs.AddConfig("db_config", 1, map[string]string{"user": "a"}, ctx))
+	require.NoError(t, configs.DeleteConfig("db_config", 1, ctx))
+
+	events, next, err := audit.Query("config/db_config", time.Time{}, 0, 10, context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, next)
+	require.Len(t, events, 2)
+
+	assert.Equal(t, model.AuditActionCreate, events[0].Action)
+	assert.Equal(t, "alice", events[0].Actor)
+	assert.Empty(t, events[0].BeforeHash)
+	assert.NotEmpty(t, events[0].AfterHash)
+	assert.Equal(t, model.AuditActionDelete, events[1].Action)
+	assert.Equal(t, events[0].AfterHash, events[1].BeforeHash)
+	assert.Equal(t, events[0].Hash, events[1].PrevHash)
+
+	result, err := audit.Verify(context.Background())
+	require.NoError(t, err)
+	assert.True(t, result.Valid())
+}
+
+func TestAuditQueryPagination(t *testing.T) {
+	audit := services.NewAuditService(repositories.NewAuditInMemRepository(), noop.NewTracerProvider().Tracer("test"))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, audit.Record(model.AuditActionCreate, "config/a/v1.0", nil, i, context.Background()))
+	}
+
+	page, next, err := audit.Query("", time.Time{}, 0, 2, context.Background())
+	require.NoError(t, err)
+	assert.Len(t, page, 2)
+	assert.Equal(t, uint64(2), next)
+
+	page, next, err = audit.Query("", time.Time{}, 4, 2, context.Background())
+	require.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Zero(t, next)
+}
+
+func TestAuditVerifyDetectsTampering(t *testing.T) {
+	repo := repositories.NewAuditInMemRepository()
+	audit := services.NewAuditService(repo, noop.NewTracerProvider().Tracer("test"))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, audit.Record(model.AuditActionCreate, "config/a/v1.0", nil, i, context.Background()))
+	}
+
+	repo.Events[1].Actor = "mallory"
+	result, err := audit.Verify(context.Background())
+	require.NoError(t, err)
+	assert.False(t, result.Valid())
+
+	repo.Events[1].Actor = services.SystemActor
+	repo.Events = append(repo.Events[:1], repo.Events[2:]...)
+	result, err = audit.Verify(context.Background())
+	require.NoError(t, err)
+	assert.False(t, result.Valid())
+}
+
+// countingAuditRepository counts the events read from the wrapped repository.
+type countingAuditRepository struct {
+	model.AuditRepository
+	read int
+}
+
+func (r *countingAuditRepository) ListEvents(ctx context.Context) ([]model.AuditEvent, error) {
+	events, err := r.AuditRepository.ListEvents(ctx)
+	r.read += len(events)
+	return events, err
+}
+
+func (r *countingAuditRepository) ListEventRange(first uint64, last uint64, ctx context.Context) ([]model.AuditEvent, error) {
+	events, err := r.AuditRepository.ListEventRange(first, last, ctx)
+	r.read += len(events)
+	return events, err
+}
+
+func TestAuditQueryReadsOnlyThePage(t *testing.T) {
+	_, client := newMemoryKV(t)
+	tracer := noop.NewTracerProvider().Tracer("test")
+	repo := &countingAuditRepository{AuditRepository: repositories.NewAudit(client, repositories.NewKeyspace("test"), slog.Default(), tracer)}
+	audit := services.NewAuditService(repo, tracer)
+	ctx := context.Background()
+	for i := 0; i < 150; i++ {
+		resource := "config/a/v1.0"
+		if i%2 == 1 {
+			resource = "config/b/v1.0"
+		}
+		require.NoError(t, audit.Record(model.AuditActionCreate, resource, nil, i, ctx))
+	}
+
+	page, next, err := audit.Query("", time.Time{}, 60, 5, ctx)
+	require.NoError(t, err)
+	require.Len(t, page, 5)
+	assert.Equal(t, uint64(61), page[0].Sequence)
+	assert.Equal(t, uint64(65), next)
+	assert.Equal(t, 6, repo.read)
+
+	// Reads cross transaction batches and skip events of other resources.
+	page, next, err = audit.Query("config/b", time.Time{}, 0, 70, ctx)
+	require.NoError(t, err)
+	require.Len(t, page, 70)
+	assert.Equal(t, uint64(140), next)
+	page, next, err = audit.Query("config/b", time.Time{}, next, 70, ctx)
+	require.NoError(t, err)
+	assert.Len(t, page, 5)
+	assert.Zero(t, next)
+}
+
+func TestAuditQueryScanLimit(t *testing.T) {
+	audit := services.NewAuditService(repositories.NewAuditInMemRepository(), noop.NewTracerProvider().Tracer("test"))
+	ctx := context.Background()
+	for i := 0; i < 1005; i++ {
+		require.NoError(t, audit.Record(model.AuditActionCreate, "config/a/v1.0", nil, nil, ctx))
+	}
+
+	// A filter matching nothing stops after the scan limit with a cursor.
+	page, next, err := audit.Query("config/b", time.Time{}, 0, 10, ctx)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+	assert.Equal(t, uint64(1000), next)
+	page, next, err = audit.Query("config/b", time.Time{}, next, 10, ctx)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+	assert.Zero(t, next)
+}
+
+// failingAuditRepository cannot reach storage.
+type failingAuditRepository struct {
+	model.AuditRepository
+}
+
+func (failingAuditRepository) GetHead(ctx context.Context) (*model.AuditHead, uint64, error) {
+	return nil, 0, model.ErrStorageUnavailable
+}
+
+func TestAuditRecordFailuresAreCounted(t *testing.T) {
+	metrics := services.NewMetricsService()
+	audit := services.NewAuditService(failingAuditRepository{}, noop.NewTracerProvider().Tracer("test"))
+	audit.SetMetrics(metrics)
+	configs := services.NewConfigService(repositories.NewConfigInMemRepository()).WithAudit(audit)
+
+	// The mutation itself succeeds.
+	require.NoError(t, configs.AddConfig("db", 1, nil, context.Background()))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.AuditRecordFailures.WithLabelValues(model.AuditActionCreate)))
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"projekat/model"
+	"projekat/services"
+	"testing"
+	"time"
+)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, secret []byte, claims map[string]interface{}) string {
+	unsigned := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticateHS256Token(t *testing.T) {
+	secret := []byte("test-secret")
+	verifier, err := services.NewJWTVerifier(secret, "", "config-api", "")
+	require.NoError(t, err)
+	auth, err := services.NewAuthService("", verifier)
+	require.NoError(t, err)
+
+	token := signHS256(t, secret, map[string]interface{}{
+		"sub":   "alice",
+		"iss":   "config-api",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"writer"},
+	})
+	principal, err := auth.AuthenticateBearer(token)
+	require.NoError(t, err)
+	assert.Equal(t, &model.Principal{Subject: "alice", Method: model.AuthMethodJWT, Roles: []string{"writer"}}, principal)
+
+	expired := signHS256(t, secret, map[string]interface{}{"sub": "alice", "iss": "config-api", "exp": time.Now().Add(-time.Hour).Unix()})
+	_, err = auth.AuthenticateBearer(expired)
+	assert.ErrorIs(t, err, services.ErrUnauthenticated)
+
+	forged := signHS256(t, []byte("other-secret"), map[string]interface{}{"sub": "alice", "iss": "config-api", "exp": time.Now().Add(time.Hour).Unix()})
+	_, err = auth.AuthenticateBearer(forged)
+	assert.ErrorIs(t, err, services.ErrUnauthenticated)
+}
+
+func TestAuthenticateES256TokenFromJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	jwks := map[string]interface{}{"keys": []map[string]string{{
+		"kty": "EC",
+		"kid": "k1",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}}}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(jwksFile, data, 0o600))
+
+	verifier, err := services.NewJWTVerifier(nil, jwksFile, "", "")
+	require.NoError(t, err)
+	auth, err := services.NewAuthService("", verifier)
+	require.NoError(t, err)
+
+	unsigned := encodeSegment(t, map[string]string{"alg": "ES256", "kid": "k1"}) + "." +
+		encodeSegment(t, map[string]interface{}{"sub": "ci", "exp": time.Now().Add(time.Hour).Unix()})
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	principal, err := auth.AuthenticateBearer(unsigned + "." + base64.RawURLEncoding.EncodeToString(signature))
+	require.NoError(t, err)
+	assert.Equal(t, "ci", principal.Subject)
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	entries := []services.APIKeyEntry{{Principal: "deployer", Hash: services.HashAPIKey("s3cret"), Roles: []string{"admin"}}}
+	data, err := json.Marshal(entries)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keysFile, data, 0o600))
+
+	auth, err := services.NewAuthService(keysFile, nil)
+	require.NoError(t, err)
+	assert.True(t, auth.Enabled())
+
+	principal, err := auth.AuthenticateAPIKey("s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, "deployer", principal.Subject)
+	assert.Equal(t, model.AuthMethodAPIKey, principal.Method)
+
+	_, err = auth.AuthenticateAPIKey("wrong")
+	assert.ErrorIs(t, err, services.ErrUnauthenticated)
+}
+
+func TestAPIKeyFileInYAML(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "keys.yaml")
+	data := "- principal: deployer\n  hash: " + services.HashAPIKey("s3cret") + "\n  roles: [admin]\n"
+	require.NoError(t, os.WriteFile(keysFile, []byte(data), 0o600))
+
+	auth, err := services.NewAuthService(keysFile, nil)
+	require.NoError(t, err)
+	principal, err := auth.AuthenticateAPIKey("s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, "deployer", principal.Subject)
+	assert.Equal(t, []string{"admin"}, principal.Roles)
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"projekat/middleware"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"testing"
+	"time"
+)
+
+const testPolicy = `
+roles:
+  - name: reader
+    permissions:
+      - resource: "*"
+        names: ["*"]
+        actions: [read]
+  - name: payments-writer
+    permissions:
+      - resource: config
+        names: ["payments-*"]
+        actions: [write, delete]
+  - name: billing-writer
+    permissions:
+      - resource: config
+        names: ["*"]
+        namespaces: ["billing"]
+        actions: [write]
+  - name: ops
+    permissions:
+      - resource: group
+        names: ["*"]
+        actions: [admin]
+bindings:
+  - subjects: ["team-a"]
+    roles: [payments-writer]
+  - subjects: ["team-billing"]
+    roles: [billing-writer]
+  - subjects: ["*"]
+    roles: [reader]
+`
+
+func loadTestPolicy(t *testing.T) *services.AuthorizationService {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(testPolicy), 0o600))
+	policy, err := services.LoadPolicy(file)
+	require.NoError(t, err)
+	authz, err := services.NewAuthorizationService(policy)
+	require.NoError(t, err)
+	return authz
+}
+
+func TestAuthorizeScopedWrite(t *testing.T) {
+	authz := loadTestPolicy(t)
+	teamA := &model.Principal{Subject: "team-a"}
+	teamB := &model.Principal{Subject: "team-b"}
+
+	assert.True(t, authz.Authorize(teamA, model.ActionWrite, model.ResourceConfig, "payments-db", ""))
+	assert.False(t, authz.Authorize(teamA, model.ActionWrite, model.ResourceConfig, "billing-db", ""))
+	assert.False(t, authz.Authorize(teamB, model.ActionWrite, model.ResourceConfig, "payments-db", ""))
+	assert.True(t, authz.Authorize(teamB, model.ActionRead, model.ResourceConfig, "payments-db", ""))
+	assert.True(t, authz.Authorize(nil, model.ActionRead, model.ResourceGroup, "payments", ""))
+}
+
+func TestAuthorizeRolesFromCredentials(t *testing.T) {
+	authz := loadTestPolicy(t)
+	operator := &model.Principal{Subject: "bob", Roles: []string{"ops"}}
+
+	assert.True(t, authz.Authorize(operator, model.ActionDelete, model.ResourceGroup, "anything", ""))
+	assert.False(t, authz.Authorize(operator, model.ActionDelete, model.ResourceConfig, "anything", ""))
+}
+
+func TestAuthorizeScopedToNamespace(t *testing.T) {
+	authz := loadTestPolicy(t)
+	billing := &model.Principal{Subject: "team-billing"}
+
+	assert.True(t, authz.Authorize(billing, model.ActionWrite, model.ResourceConfig, "db", "billing"))
+	assert.False(t, authz.Authorize(billing, model.ActionWrite, model.ResourceConfig, "db", "payments"))
+	assert.False(t, authz.Authorize(billing, model.ActionWrite, model.ResourceConfig, "db", ""))
+
+	// Grants without namespaces only cover the default namespace.
+	teamA := &model.Principal{Subject: "team-a"}
+	assert.True(t, authz.Authorize(teamA, model.ActionWrite, model.ResourceConfig, "payments-db", model.DefaultNamespace))
+	assert.False(t, authz.Authorize(teamA, model.ActionWrite, model.ResourceConfig, "payments-db", "billing"))
+
+	// The middleware checks the namespace of the request and records
+	// denials under it.
+	audit := services.NewAuditService(repositories.NewAuditInMemRepository(), noop.NewTracerProvider().Tracer("test"))
+	authorization := middleware.NewAuthorization(authz)
+	authorization.SetAudit(audit)
+	handler := authorization.Require(model.ActionWrite, model.ResourceConfig, "name", func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(namespace string) int {
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/config/db/1/", nil), map[string]string{"name": "db"})
+		ctx := model.ContextWithNamespace(model.ContextWithPrincipal(r.Context(), billing), namespace)
+		rec := httptest.NewRecorder()
+		handler(rec, r.WithContext(ctx))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, serve("billing"))
+	assert.Equal(t, http.StatusForbidden, serve("payments"))
+
+	events, _, err := audit.Query("ns/payments/", time.Time{}, 0, 10, context.Background())
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, model.AuditActionAccessDenied, events[0].Action)
+	assert.Equal(t, "ns/payments/config/db#write", events[0].Resource)
+}
+
+func TestAuthorizationPolicyRejectsUnknownRole(t *testing.T) {
+	_, err := services.NewAuthorizationService(&model.Policy{
+		Bindings: []model.RoleBinding{{Subjects: []string{"x"}, Roles: []string{"missing"}}},
+	})
+	assert.Error(t, err)
+}
+
+func TestAuthorizationMiddlewareFailsClosed(t *testing.T) {
+	var called bool
+	next := func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		assert.False(t, model.RevealFromContext(r.Context()))
+	}
+	serve := func(authz *middleware.Authorization, target string) int {
+		called = false
+		rec := httptest.NewRecorder()
+		authz.Require(model.ActionRead, model.ResourceConfig, "", next)(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+
+	// A missing authorizer is a wiring bug and must not grant anything.
+	var missing *middleware.Authorization
+	assert.Equal(t, http.StatusInternalServerError, serve(missing, "/config/db/1/?reveal=true"))
+	assert.False(t, called)
+	assert.Panics(t, func() { middleware.NewAuthorization(nil) })
+
+	// Without a policy requests pass, but secrets stay hidden.
+	open := middleware.NewOpenAuthorization()
+	assert.Equal(t, http.StatusOK, serve(open, "/config/db/1/"))
+	assert.True(t, called)
+	assert.Equal(t, http.StatusForbidden, serve(open, "/config/db/1/?reveal=true"))
+	assert.False(t, called)
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"testing"
+)
+
+type bootstrapFixture struct {
+	dir        string
+	configs    services.ConfigService
+	groups     services.ConfigGroupService
+	namespaces services.NamespaceService
+	bootstrap  services.BootstrapService
+}
+
+func newBootstrapFixture(t *testing.T, files map[string]string) bootstrapFixture {
+	f := bootstrapFixture{
+		dir:        t.TempDir(),
+		configs:    services.NewConfigService(repositories.NewConfigInMemRepository()),
+		groups:     services.NewConfigGroupService(repositories.NewConfigGroupInMemRepository()),
+		namespaces: services.NewNamespaceService(repositories.NewNamespaceInMemRepository()),
+	}
+	f.bootstrap = services.NewBootstrapService(f.configs, f.groups, f.namespaces)
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(f.dir, name), []byte(content), 0o600))
+	}
+	return f
+}
+
+var bootstrapFiles = map[string]string{
+	"db.yaml": `
+configs:
+  - name: db
+    version: 1.0
+    parameters:
+      host: db.internal
+groups:
+  - name: backend
+    version: 1.0
+    configurations:
+      - name: db
+        labels:
+          tier: data
+        parameters:
+          host: db.internal
+`,
+	"team.json": `{"namespace": "team-a", "configs": [{"name": "cache", "version": 2, "parameters": {"ttl": "5m"}}]}`,
+	"README.md": "not a bootstrap file",
+}
+
+func TestBootstrapAppliesDirectoryIdempotently(t *testing.T) {
+	f := newBootstrapFixture(t, bootstrapFiles)
+	ctx := context.Background()
+
+	report, err := f.bootstrap.Apply(f.dir, services.BootstrapFailOnConflict, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Files)
+	assert.ElementsMatch(t, []string{"config/db/v1.0", "configGroup/backend/v1.0", "ns/team-a/config/cache/v2.0"}, report.Created)
+
+	config, err := f.configs.GetConfig("db", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "db.internal", config.Parameters["host"])
+	group, err := f.groups.GetConfigGroup("backend", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "data", group.Configurations[0].Labels["tier"])
+	_, err = f.namespaces.GetNamespace("team-a", ctx)
+	require.NoError(t, err)
+	_, err = f.configs.GetConfig("cache", 2, model.ContextWithNamespace(ctx, "team-a"))
+	require.NoError(t, err)
+
+	// A restart with the same files changes nothing, even when conflicts fail.
+	report, err = f.bootstrap.Apply(f.dir, services.BootstrapFailOnConflict, ctx)
+	require.NoError(t, err)
+	assert.Empty(t, report.Created)
+	assert.Empty(t, report.Updated)
+	assert.Len(t, report.Unchanged, 3)
+}
+
+func TestBootstrapConflictModes(t *testing.T) {
+	ctx := context.Background()
+	edited := func(t *testing.T) bootstrapFixture {
+		f := newBootstrapFixture(t, bootstrapFiles)
+		require.NoError(t, f.configs.AddConfig("db", 1, map[string]string{"host": "edited"}, ctx))
+		return f
+	}
+
+	t.Run("skip-if-exists", func(t *testing.T) {
+		f := edited(t)
+		report, err := f.bootstrap.Apply(f.dir, services.BootstrapSkipIfExists, ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"config/db/v1.0"}, report.Skipped)
+		assert.Len(t, report.Created, 2)
+		config, err := f.configs.GetConfig("db", 1, ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "edited", config.Parameters["host"])
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		f := edited(t)
+		report, err := f.bootstrap.Apply(f.dir, services.BootstrapOverwrite, ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"config/db/v1.0"}, report.Updated)
+		config, err := f.configs.GetConfig("db", 1, ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "db.internal", config.Parameters["host"])
+	})
+
+	t.Run("fail-on-conflict", func(t *testing.T) {
+		f := edited(t)
+		_, err := f.bootstrap.Apply(f.dir, services.BootstrapFailOnConflict, ctx)
+		require.ErrorIs(t, err, services.ErrBootstrapConflict)
+		assert.Contains(t, err.Error(), "config/db/v1.0")
+		// Nothing is written when any entry conflicts.
+		_, err = f.groups.GetConfigGroup("backend", 1, ctx)
+		assert.Error(t, err)
+	})
+}
+
+func TestBootstrapRejectsInvalidFiles(t *testing.T) {
+	ctx := context.Background()
+	for name, files := range map[string]map[string]string{
+		"unknown field":   {"a.yaml": "configs:\n  - name: db\n    version: 1\n    params: {}\n"},
+		"missing version": {"a.json": `{"configs": [{"name": "db"}]}`},
+		"duplicate": {
+			"a.yaml": "configs:\n  - name: db\n    version: 1\n",
+			"b.yaml": "configs:\n  - name: db\n    version: 1\n",
+		},
+		"invalid namespace": {"a.yaml": "namespace: Team_A\n"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newBootstrapFixture(t, files)
+			_, err := f.bootstrap.Apply(f.dir, services.BootstrapOverwrite, ctx)
+			require.Error(t, err)
+			_, err = f.configs.GetConfig("db", 1, ctx)
+			assert.Error(t, err)
+		})
+	}
+
+	f := newBootstrapFixture(t, nil)
+	_, err := f.bootstrap.Apply(f.dir, "merge", ctx)
+	assert.ErrorContains(t, err, "unknown bootstrap mode")
+	_, err = f.bootstrap.Apply(filepath.Join(f.dir, "missing"), services.BootstrapOverwrite, ctx)
+	assert.Error(t, err)
+}
+
+// failingConfigRepository fails every read with an error that merely
+// mentions "not found".
+type failingConfigRepository struct {
+	model.ConfigRepository
+}
+
+func (r failingConfigRepository) GetConfig(name string, version float32, ctx context.Context) (*model.Config, error) {
+	return nil, errors.New("rpc error: leader not found")
+}
+
+func TestBootstrapStorageErrorsAreNotMissingEntries(t *testing.T) {
+	f := newBootstrapFixture(t, bootstrapFiles)
+	configs := services.NewConfigService(failingConfigRepository{repositories.NewConfigInMemRepository()})
+	bootstrap := services.NewBootstrapService(configs, f.groups, f.namespaces)
+
+	_, err := bootstrap.Apply(f.dir, services.BootstrapFailOnConflict, context.Background())
+	require.ErrorContains(t, err, "leader not found")
+	assert.NotErrorIs(t, err, services.ErrBootstrapInvalid)
+	assert.NotErrorIs(t, err, services.ErrBootstrapConflict)
+}
@@ -0,0 +1,201 @@
+package tests
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"projekat/handlers"
+	"projekat/metrics"
+	"projekat/middleware"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	kv, _ := newMemoryKV(t)
+	metrics := metrics.NewBreaker(prometheus.NewRegistry())
+	breaker := repositories.NewCircuitBreaker(repositories.BreakerOptions{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond}, metrics)
+	client, err := repositories.NewConsulClient(repositories.ConsulOptions{Address: kv.address, Breaker: breaker}, noop.NewTracerProvider().Tracer("test"))
+	require.NoError(t, err)
+	repo := repositories.New(client, repositories.Keyspace{}, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	ctx := context.Background()
+	require.NoError(t, repo.AddConfig(model.NewConfig("db", 1, map[string]string{"host": "db"}), ctx))
+
+	kv.down.Store(true)
+	for i := 0; i < 2; i++ {
+		_, err = repo.GetConfig("db", 1, ctx)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, model.ErrStorageUnavailable)
+	}
+	assert.Equal(t, repositories.CircuitOpen, breaker.State())
+
+	// Calls fail fast without reaching Consul.
+	_, err = repo.GetConfig("db", 1, ctx)
+	assert.ErrorIs(t, err, model.ErrStorageUnavailable)
+	assert.ErrorIs(t, repo.AddConfig(model.NewConfig("db", 2, nil), ctx), model.ErrStorageUnavailable)
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.Rejected))
+	assert.Equal(t, float64(repositories.CircuitOpen), testutil.ToFloat64(metrics.State))
+
+	// A failed trial call opens the circuit again.
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, repositories.CircuitHalfOpen, breaker.State())
+	_, err = repo.GetConfig("db", 1, ctx)
+	assert.NotErrorIs(t, err, model.ErrStorageUnavailable)
+	assert.Equal(t, repositories.CircuitOpen, breaker.State())
+
+	// A successful one closes it.
+	kv.down.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	_, err = repo.GetConfig("db", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, repositories.CircuitClosed, breaker.State())
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.Transitions.WithLabelValues("open")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.Transitions.WithLabelValues("half_open")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.Transitions.WithLabelValues("closed")))
+}
+
+func TestStaleReadsWhileStorageIsDown(t *testing.T) {
+	kv, _ := newMemoryKV(t)
+	breaker := repositories.NewCircuitBreaker(repositories.BreakerOptions{FailureThreshold: 1, OpenTimeout: time.Minute}, nil)
+	client, err := repositories.NewConsulClient(repositories.ConsulOptions{Address: kv.address, Breaker: breaker}, noop.NewTracerProvider().Tracer("test"))
+	require.NoError(t, err)
+	keys := repositories.NewKeyspace("test")
+	storage := repositories.New(client, keys, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	ctx := context.Background()
+	require.NoError(t, storage.AddConfig(model.NewConfig("db", 1, map[string]string{"host": "cached"}), ctx))
+	require.NoError(t, storage.AddConfig(model.NewConfig("db", 2, map[string]string{"host": "snapshot"}), ctx))
+
+	// The snapshot is taken while Consul is up and loaded by a fresh process.
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	require.NoError(t, repositories.NewSnapshotFile(file, client, keys, slog.Default()).Save(ctx))
+	snapshot := repositories.NewSnapshotFile(file, client, keys, slog.Default())
+	require.NoError(t, snapshot.Load())
+
+	cache := repositories.NewStorageCache(client, keys, repositories.CacheOptions{Size: 10, TTL: time.Millisecond}, nil, slog.Default())
+	repo := repositories.FallbackConfigRepository(repositories.CacheConfigRepository(storage, cache), keys, cache, snapshot)
+	handler := handlers.NewConfigHandler(slog.Default(), services.NewConfigService(repo), noop.NewTracerProvider().Tracer("test"))
+	router := mux.NewRouter()
+	router.Use(middleware.AdaptStaleHandler)
+	router.HandleFunc("/config/{name}/{version}/", handler.Get).Methods("GET")
+	router.HandleFunc("/config/{name}/{version}/", handler.DelPostHandler).Methods("DELETE")
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/config/db/1.0/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Warning"))
+	cachedAt := time.Now()
+	// Let the entry expire so the next read goes to Consul.
+	time.Sleep(5 * time.Millisecond)
+
+	kv.down.Store(true)
+	_, err = storage.ListConfigs(ctx)
+	require.Error(t, err)
+	require.Equal(t, repositories.CircuitOpen, breaker.State())
+
+	rec = serve(http.MethodGet, "/config/db/1.0/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "cached")
+	assert.Equal(t, `110 - "Response is Stale"`, rec.Header().Get("Warning"))
+	since, err := time.Parse(time.RFC3339, rec.Header().Get(middleware.StaleSinceHeader))
+	require.NoError(t, err)
+	assert.WithinDuration(t, cachedAt, since, 2*time.Second)
+
+	rec = serve(http.MethodGet, "/config/db/2.0/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "snapshot")
+	assert.NotEmpty(t, rec.Header().Get(middleware.StaleSinceHeader))
+
+	configs, err := repo.ListConfigs(ctx)
+	require.NoError(t, err)
+	assert.Len(t, configs, 2)
+
+	// Data that was never read cannot be served, and writes fail fast.
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodGet, "/config/db/3.0/").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodDelete, "/config/db/1.0/").Code)
+}
+
+func TestCircuitBreakerIgnoresCallsFromEarlierStates(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/slow") {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(consul.Close)
+	breaker := repositories.NewCircuitBreaker(repositories.BreakerOptions{FailureThreshold: 1, OpenTimeout: time.Minute}, nil)
+	client, err := repositories.NewConsulClient(repositories.ConsulOptions{Address: consul.Listener.Addr().String(), Breaker: breaker}, noop.NewTracerProvider().Tracer("test"))
+	require.NoError(t, err)
+
+	// A call let through while the circuit was closed is still in flight
+	// when another one opens it.
+	done := make(chan error)
+	go func() {
+		_, _, err := client.KV().Get("slow", nil)
+		done <- err
+	}()
+	<-started
+	_, _, err = client.KV().Get("failing", nil)
+	require.Error(t, err)
+	require.Equal(t, repositories.CircuitOpen, breaker.State())
+
+	// Its late success says nothing about Consul now.
+	close(release)
+	require.NoError(t, <-done)
+	assert.Equal(t, repositories.CircuitOpen, breaker.State())
+}
+
+func TestStaleLabelQueriesWhileStorageIsDown(t *testing.T) {
+	kv, _ := newMemoryKV(t)
+	breaker := repositories.NewCircuitBreaker(repositories.BreakerOptions{FailureThreshold: 1, OpenTimeout: time.Minute}, nil)
+	client, err := repositories.NewConsulClient(repositories.ConsulOptions{Address: kv.address, Breaker: breaker}, noop.NewTracerProvider().Tracer("test"))
+	require.NoError(t, err)
+	keys := repositories.NewKeyspace("test")
+	groups := repositories.NewCG(client, keys, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	ctx := context.Background()
+	require.NoError(t, groups.AddConfigGroup(model.NewConfigGroup("payments", 1, []model.ConfigForGroup{
+		*model.NewConfigForGroup("db", map[string]string{"tier": "backend"}, map[string]string{"host": "db"}),
+		*model.NewConfigForGroup("web", map[string]string{"tier": "frontend"}, map[string]string{"host": "web"}),
+	}), ctx))
+
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	require.NoError(t, repositories.NewSnapshotFile(file, client, keys, slog.Default()).Save(ctx))
+	snapshot := repositories.NewSnapshotFile(file, client, keys, slog.Default())
+	require.NoError(t, snapshot.Load())
+	repo := repositories.FallbackConfigForGroupRepository(repositories.NewCFG(client, keys, slog.Default(), noop.NewTracerProvider().Tracer("test")), keys, nil, snapshot)
+
+	kv.down.Store(true)
+	_, err = groups.ListConfigGroups(ctx)
+	require.Error(t, err)
+	require.Equal(t, repositories.CircuitOpen, breaker.State())
+
+	staleCtx, staleness := model.ContextWithStaleness(ctx)
+	configs, err := repo.GetConfigsByLabels("payments", 1, map[string]string{"tier": "backend"}, staleCtx)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	assert.Equal(t, "db", configs[0].Name)
+	assert.False(t, staleness.Since().IsZero())
+
+	// Writes still fail fast.
+	err = repo.DeleteConfigsByLabels("payments", 1, map[string]string{"tier": "backend"}, ctx)
+	assert.ErrorIs(t, err, model.ErrStorageUnavailable)
+}
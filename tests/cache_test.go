@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"context"
+	"github.com/hashicorp/consul/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"projekat/metrics"
+	"projekat/middleware"
+	"projekat/model"
+	"projekat/repositories"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCacheServesReadsAndInvalidatesOnWrite(t *testing.T) {
+	_, client := newMemoryKV(t)
+	keys := repositories.NewKeyspace("test")
+	metrics := metrics.NewCache(prometheus.NewRegistry())
+	cache := repositories.NewStorageCache(client, keys, repositories.CacheOptions{Size: 2, TTL: time.Minute}, metrics, slog.Default())
+	repo := repositories.CacheConfigRepository(repositories.New(client, keys, slog.Default(), noop.NewTracerProvider().Tracer("test")), cache)
+	ctx := context.Background()
+
+	require.NoError(t, repo.AddConfig(model.NewConfig("db", 1, map[string]string{"host": "one"}), ctx))
+	config, err := repo.GetConfig("db", 1, ctx)
+	require.NoError(t, err)
+	config.Parameters["host"] = "changed by the caller"
+	config, err = repo.GetConfig("db", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "one", config.Parameters["host"])
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.Misses.WithLabelValues("config")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.Hits.WithLabelValues("config")))
+
+	// Writes through the cache are visible at once.
+	require.NoError(t, repo.AddConfig(model.NewConfig("db", 1, map[string]string{"host": "two"}), ctx))
+	config, err = repo.GetConfig("db", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "two", config.Parameters["host"])
+
+	// Cache-Control: no-cache reads through.
+	_, err = repo.GetConfig("db", 1, model.ContextWithCacheBypass(ctx))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.Bypasses.WithLabelValues("config")))
+
+	for version := float32(2); version <= 3; version++ {
+		require.NoError(t, repo.AddConfig(model.NewConfig("db", version, map[string]string{"host": "db"}), ctx))
+		_, err = repo.GetConfig("db", version, ctx)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.Evictions.WithLabelValues("size")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.Entries))
+
+	// Missing configs are not cached.
+	_, err = repo.GetConfig("missing", 1, ctx)
+	assert.Error(t, err)
+	_, err = repo.GetConfig("missing", 1, ctx)
+	assert.Error(t, err)
+}
+
+func TestCacheFollowsWritesOfOtherReplicas(t *testing.T) {
+	_, client := newMemoryKV(t)
+	keys := repositories.NewKeyspace("test")
+	cache := repositories.NewStorageCache(client, keys, repositories.CacheOptions{Size: 10, TTL: time.Hour}, nil, slog.Default())
+	storage := repositories.New(client, keys, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	repo := repositories.CacheConfigRepository(storage, cache)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, storage.AddConfig(model.NewConfig("db", 1, map[string]string{"host": "one"}), ctx))
+	go cache.Watch(ctx)
+	config, err := repo.GetConfig("db", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "one", config.Parameters["host"])
+
+	// Another replica writes straight to Consul. The write is repeated in
+	// case it lands before the watch has made its first query.
+	assert.Eventually(t, func() bool {
+		require.NoError(t, storage.AddConfig(model.NewConfig("db", 1, map[string]string{"host": "two"}), ctx))
+		config, err := repo.GetConfig("db", 1, ctx)
+		return err == nil && config.Parameters["host"] == "two"
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestCacheIgnoresIdempotencyRecords(t *testing.T) {
+	_, client := newMemoryKV(t)
+	keys := repositories.NewKeyspace("test")
+	metrics := metrics.NewCache(prometheus.NewRegistry())
+	cache := repositories.NewStorageCache(client, keys, repositories.CacheOptions{Size: 10, TTL: time.Hour}, metrics, slog.Default())
+	storage := repositories.New(client, keys, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	repo := repositories.CacheConfigRepository(storage, cache)
+	ctx, cancel := context.WithCancel(model.ContextWithNamespace(context.Background(), "billing"))
+	defer cancel()
+
+	require.NoError(t, storage.AddConfig(model.NewConfig("db", 1, map[string]string{"host": "one"}), ctx))
+	go cache.Watch(ctx)
+	_, err := repo.GetConfig("db", 1, ctx)
+	require.NoError(t, err)
+	// Wait for the watch to pick up writes to namespaced configs.
+	assert.Eventually(t, func() bool {
+		require.NoError(t, storage.AddConfig(model.NewConfig("db", 1, map[string]string{"host": "two"}), ctx))
+		config, err := repo.GetConfig("db", 1, ctx)
+		return err == nil && config.Parameters["host"] == "two"
+	}, 2*time.Second, 20*time.Millisecond)
+	// Let the watch catch up with the writes repeated above.
+	time.Sleep(100 * time.Millisecond)
+	_, err = repo.GetConfig("db", 1, ctx)
+	require.NoError(t, err)
+	hits := testutil.ToFloat64(metrics.Hits.WithLabelValues("config"))
+
+	// Idempotent requests in the same namespace keep the cached entries.
+	for i := 0; i < 3; i++ {
+		_, err := client.KV().Put(&api.KVPair{Key: "test/ns/billing/idempotency_requests/key-" + strconv.Itoa(i) + "/", Value: []byte("{}")}, nil)
+		require.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+	}
+	_, err = repo.GetConfig("db", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, hits+1, testutil.ToFloat64(metrics.Hits.WithLabelValues("config")))
+}
+
+func TestCacheEntriesExpire(t *testing.T) {
+	_, client := newMemoryKV(t)
+	metrics := metrics.NewCache(prometheus.NewRegistry())
+	cache := repositories.NewStorageCache(client, repositories.Keyspace{}, repositories.CacheOptions{Size: 10, TTL: 10 * time.Millisecond}, metrics, slog.Default())
+	repo := repositories.CacheConfigGroupRepository(repositories.NewCG(client, repositories.Keyspace{}, slog.Default(), noop.NewTracerProvider().Tracer("test")), cache)
+	ctx := context.Background()
+
+	require.NoError(t, repo.AddConfigGroup(model.NewConfigGroup("app", 1, nil), ctx))
+	_, err := repo.GetConfigGroup("app", 1, ctx)
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = repo.GetConfigGroup("app", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.Hits.WithLabelValues("config_group")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.Misses.WithLabelValues("config_group")))
+}
+
+func TestCacheControlNoCache(t *testing.T) {
+	var bypass bool
+	handler := middleware.AdaptCacheControlHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bypass = model.CacheBypassFromContext(r.Context())
+	}))
+
+	for header, want := range map[string]bool{"": false, "max-age=60": false, "max-age=0, No-Cache": true} {
+		req := httptest.NewRequest(http.MethodGet, "/config/db/1.0/", nil)
+		if header != "" {
+			req.Header.Set("Cache-Control", header)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, want, bypass, header)
+	}
+}
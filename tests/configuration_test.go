@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"projekat/configuration"
+	"projekat/model"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	return file
+}
+
+func TestConfigurationPrecedence(t *testing.T) {
+	file := writeConfigFile(t, `
+environment: development
+server:
+  port: "9000"
+  writeTimeout: 45s
+storage:
+  host: consul.file
+  port: "8600"
+rateLimit:
+  requests: 20
+`)
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("DB", "consul.env")
+	t.Setenv("PORT", "9100")
+	t.Setenv("STORAGE_KEY_PREFIX", "staging/projekat")
+
+	cfg, options, err := configuration.Load([]string{"--server.port", "9200", "--rate-limit.requests=30"})
+	require.NoError(t, err)
+	assert.Equal(t, file, options.File)
+	assert.False(t, options.PrintConfig)
+
+	assert.Equal(t, "9200", cfg.Server.Port)
+	assert.Equal(t, 45*time.Second, cfg.Server.WriteTimeout)
+	assert.Equal(t, "consul.env:8600", cfg.Storage.Address())
+	assert.Equal(t, "staging/projekat", cfg.Storage.KeyPrefix)
+	assert.Equal(t, 30, cfg.RateLimit.Requests)
+	assert.Equal(t, time.Minute, cfg.RateLimit.Window)
+	// The file's environment picks the development CORS defaults.
+	assert.Equal(t, "development", cfg.Environment)
+	assert.Equal(t, []string{"http://localhost:8081"}, cfg.CORS.AllowedOrigins)
+}
+
+func TestConfigurationRejectsInvalidSettings(t *testing.T) {
+	_, _, err := configuration.Load([]string{"--config", writeConfigFile(t, "storage:\n  hots: consul\n")})
+	assert.ErrorContains(t, err, "hots")
+
+	t.Setenv("RATE_LIMIT_REQUESTS", "many")
+	_, _, err = configuration.Load(nil)
+	assert.ErrorContains(t, err, "RATE_LIMIT_REQUESTS")
+
+	t.Setenv("RATE_LIMIT_REQUESTS", "")
+	_, _, err = configuration.Load([]string{"--rate-limit.backend", "redis", "--tracing.sample-ratio", "2", "--tls.cert-file", "cert.pem"})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "rate limit backend")
+	assert.ErrorContains(t, err, "sample ratio")
+	assert.ErrorContains(t, err, "certificate and key")
+
+	_, _, err = configuration.Load([]string{"--no-such-flag"})
+	assert.Error(t, err)
+
+	_, _, err = configuration.Load([]string{"--storage.key-prefix", "staging//projekat"})
+	assert.ErrorContains(t, err, "key prefix")
+
+	t.Setenv("BOOTSTRAP_MODE", "merge")
+	_, _, err = configuration.Load(nil)
+	assert.ErrorContains(t, err, "bootstrap mode")
+}
+
+func TestPrintConfigRedactsSecrets(t *testing.T) {
+	t.Setenv("AUTH_JWT_SECRET", "hunter2")
+	cfg, options, err := configuration.Load([]string{"--print-config"})
+	require.NoError(t, err)
+	assert.True(t, options.PrintConfig)
+	assert.Equal(t, "hunter2", cfg.Auth.JWTSecret)
+
+	var out bytes.Buffer
+	require.NoError(t, cfg.Print(&out))
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.Contains(t, out.String(), model.MaskedValue)
+	assert.Contains(t, out.String(), "readTimeout: 2s")
+
+	// The mask is not a secret, so loading it back fails instead of
+	// starting with it.
+	t.Setenv("AUTH_JWT_SECRET", "")
+	_, _, err = configuration.Load([]string{"--config", writeConfigFile(t, out.String())})
+	assert.ErrorContains(t, err, "redaction mask")
+
+	// A printed configuration without secrets can be loaded back as is.
+	cfg, _, err = configuration.Load(nil)
+	require.NoError(t, err)
+	out.Reset()
+	require.NoError(t, cfg.Print(&out))
+	reloaded, _, err := configuration.Load([]string{"--config", writeConfigFile(t, out.String())})
+	require.NoError(t, err)
+	var again bytes.Buffer
+	require.NoError(t, reloaded.Print(&again))
+	assert.Equal(t, out.String(), again.String())
+}
+
+func TestSecretsHaveNoFlags(t *testing.T) {
+	for _, flag := range []string{"--auth.jwt-secret=hunter2", "--storage.token=hunter2"} {
+		_, _, err := configuration.Load([]string{flag})
+		assert.ErrorContains(t, err, "flag provided but not defined")
+	}
+
+	file := filepath.Join(t.TempDir(), "jwt-secret")
+	require.NoError(t, os.WriteFile(file, []byte("hunter2\n"), 0o600))
+	cfg, _, err := configuration.Load([]string{"--auth.jwt-secret-file", file})
+	require.NoError(t, err)
+	secret, err := cfg.Auth.Secret()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hunter2"), secret)
+
+	t.Setenv("AUTH_JWT_SECRET", "hunter2")
+	_, _, err = configuration.Load([]string{"--auth.jwt-secret-file", file})
+	assert.ErrorContains(t, err, "must not both be set")
+}
+
+func TestConfigurationRejectsTOML(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(file, []byte("logLevel = \"info\"\n"), 0o600))
+	_, _, err := configuration.Load([]string{"--config", file})
+	assert.ErrorContains(t, err, "TOML is not supported")
+}
+
+func TestTracingIsInsecureOnlyInDevelopment(t *testing.T) {
+	assert.False(t, configuration.Defaults("production").Tracing.Insecure)
+	assert.True(t, configuration.Defaults("development").Tracing.Insecure)
+
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("TRACING_INSECURE", "true")
+	cfg, _, err := configuration.Load(nil)
+	require.NoError(t, err)
+	assert.True(t, cfg.Tracing.Insecure)
+}
@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"projekat/model"
+	"projekat/repositories"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsul answers KV reads with a stored config after failing the first
+// failures requests with 503, and records what it was sent.
+type fakeConsul struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, string(body))
+	fail := len(f.requests) <= f.failures
+	f.mu.Unlock()
+
+	if fail {
+		http.Error(w, "No cluster leader", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method == http.MethodPut {
+		_, _ = w.Write([]byte("true"))
+		return
+	}
+	config, _ := json.Marshal(model.NewConfig("db", 1, map[string]string{"host": "localhost"}))
+	_ = json.NewEncoder(w).Encode([]map[string]interface{}{{
+		"Key":   "configs/db/v1.0",
+		"Value": base64.StdEncoding.EncodeToString(config),
+	}})
+}
+
+func newConsulRepository(t *testing.T, options repositories.ConsulOptions) *repositories.ConfigConsulRepository {
+	tracer := noop.NewTracerProvider().Tracer("test")
+	client, err := repositories.NewConsulClient(options, tracer)
+	require.NoError(t, err)
+	return repositories.New(client, repositories.Keyspace{}, slog.Default(), tracer)
+}
+
+func TestConsulClientRetriesTransientErrors(t *testing.T) {
+	consul := &fakeConsul{failures: 2}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+	retry := repositories.RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	repo := newConsulRepository(t, repositories.ConsulOptions{Address: server.Listener.Addr().String(), Retry: retry})
+	config, err := repo.GetConfig("db", 1, context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", config.Parameters["host"])
+	assert.Len(t, consul.requests, 3)
+
+	// Once the attempts are used up the last error is returned.
+	consul.requests, consul.failures = nil, 5
+	_, err = repo.GetConfig("db", 1, context.Background())
+	assert.Error(t, err)
+	assert.Len(t, consul.requests, 3)
+}
+
+func TestConsulClientDoesNotResendWrites(t *testing.T) {
+	// reset drops the connection of every request without answering, as if
+	// it broke after the write was committed.
+	var mu sync.Mutex
+	var methods []string
+	reset := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		drop := reset
+		mu.Unlock()
+		if drop {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		http.Error(w, "No cluster leader", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	retry := repositories.RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	client, err := repositories.NewConsulClient(repositories.ConsulOptions{Address: server.Listener.Addr().String(), Retry: retry}, noop.NewTracerProvider().Tracer("test"))
+	require.NoError(t, err)
+
+	writes := map[string]func() error{
+		"cas": func() error {
+			_, _, err := client.KV().CAS(&api.KVPair{Key: "audit/head", Value: []byte("1"), ModifyIndex: 7}, nil)
+			return err
+		},
+		"txn": func() error {
+			_, _, _, err := client.Txn().Txn(api.TxnOps{{KV: &api.KVTxnOp{Verb: api.KVCAS, Key: "audit/1", Value: []byte("e"), Index: 0}}}, nil)
+			return err
+		},
+	}
+	for _, broken := range []bool{false, true} {
+		for name, write := range writes {
+			mu.Lock()
+			methods, reset = nil, broken
+			mu.Unlock()
+			assert.Error(t, write(), name)
+			mu.Lock()
+			assert.Equal(t, []string{http.MethodPut}, methods, "%s resent after reset=%v", name, broken)
+			mu.Unlock()
+		}
+	}
+
+	// Reads are still retried after a reset connection.
+	mu.Lock()
+	methods = nil
+	mu.Unlock()
+	_, _, err = client.KV().Get("configs/db/v1.0", nil)
+	assert.Error(t, err)
+	mu.Lock()
+	assert.Len(t, methods, 3)
+	mu.Unlock()
+}
+
+func TestConsulClientSendsTokenAndTenancy(t *testing.T) {
+	consul := &fakeConsul{}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("file-token\n"), 0o600))
+
+	repo := newConsulRepository(t, repositories.ConsulOptions{
+		Address:    server.Listener.Addr().String(),
+		TokenFile:  tokenFile,
+		Datacenter: "dc2",
+		Namespace:  "team-a",
+		Partition:  "billing",
+	})
+	_, err := repo.GetConfig("db", 1, context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, consul.requests, 1)
+	req := consul.requests[0]
+	assert.Equal(t, "file-token", req.Header.Get("X-Consul-Token"))
+	assert.Equal(t, "dc2", req.URL.Query().Get("dc"))
+	assert.Equal(t, "team-a", req.URL.Query().Get("ns"))
+	assert.Equal(t, "billing", req.URL.Query().Get("partition"))
+}
+
+func TestConsulClientTLS(t *testing.T) {
+	consul := &fakeConsul{}
+	server := httptest.NewTLSServer(consul)
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, ca, 0o600))
+
+	repo := newConsulRepository(t, repositories.ConsulOptions{
+		Address: server.Listener.Addr().String(),
+		TLS:     repositories.ConsulTLS{Enabled: true, CAFile: caFile, ServerName: "example.com"},
+	})
+	_, err := repo.GetConfig("db", 1, context.Background())
+	require.NoError(t, err)
+	assert.NotNil(t, consul.requests[0].TLS)
+
+	// Without the CA the agent's certificate is not trusted.
+	untrusted := newConsulRepository(t, repositories.ConsulOptions{
+		Address: server.Listener.Addr().String(),
+		TLS:     repositories.ConsulTLS{Enabled: true},
+	})
+	_, err = untrusted.GetConfig("db", 1, context.Background())
+	assert.Error(t, err)
+}
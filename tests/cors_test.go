@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"github.com/rs/cors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"projekat/configuration"
+	"testing"
+)
+
+func TestCORSRejectsWildcardWithCredentials(t *testing.T) {
+	cfg := configuration.CORSConfiguration{
+		AllowedOrigins:   []string{"*"},
+		AllowCredentials: true,
+	}
+	assert.Error(t, cfg.Validate())
+
+	cfg.AllowCredentials = false
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestCORSEnvironmentDefaults(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+	cfg, _, err := configuration.Load(nil)
+	require.NoError(t, err)
+	production := cfg.CORS
+	assert.Empty(t, production.AllowedOrigins)
+	assert.False(t, production.AllowCredentials)
+	assert.NoError(t, production.Validate())
+
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example, https://b.example")
+	cfg, _, err = configuration.Load(nil)
+	require.NoError(t, err)
+	development := cfg.CORS
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, development.AllowedOrigins)
+	assert.True(t, development.AllowCredentials)
+	assert.NoError(t, development.Validate())
+}
+
+func TestCORSEmptyOriginsDenyAll(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+	cfg, _, err := configuration.Load(nil)
+	require.NoError(t, err)
+	handler := cors.New(cfg.CORS.Options(nil)).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/config/db/1/", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	cfg.CORS.AllowedOrigins = []string{"https://app.example"}
+	handler = cors.New(cfg.CORS.Options(nil)).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req.Header.Set("Origin", "https://app.example")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "https://app.example", rec.Header().Get("Access-Control-Allow-Origin"))
+}
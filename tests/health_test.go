@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"projekat/configuration"
+	"projekat/handlers"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthServiceReportsEveryDependency(t *testing.T) {
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	health := services.NewHealthService(50*time.Millisecond).
+		WithCheck("consul", func(ctx context.Context) error { return nil }).
+		WithCheck("storage", func(ctx context.Context) error { return errors.New("write failed") }).
+		WithCheck("tracing", slow)
+
+	report := health.Check(context.Background())
+	assert.Equal(t, services.HealthDown, report.Status)
+	require.Len(t, report.Dependencies, 3)
+	assert.Equal(t, "consul", report.Dependencies[0].Name)
+	assert.Equal(t, services.HealthUp, report.Dependencies[0].Status)
+	assert.Equal(t, services.HealthDown, report.Dependencies[1].Status)
+	assert.Equal(t, "write failed", report.Dependencies[1].Error)
+	assert.Equal(t, services.HealthDown, report.Dependencies[2].Status)
+	assert.GreaterOrEqual(t, report.Dependencies[2].LatencyMs, 50.0)
+
+	healthy := services.NewHealthService(time.Second).WithCheck("consul", func(ctx context.Context) error { return nil })
+	assert.True(t, healthy.Check(context.Background()).Healthy())
+
+	// An optional dependency is reported but only degrades the service.
+	degraded := healthy.WithOptionalCheck("tracing", func(ctx context.Context) error { return errors.New("collector unreachable") })
+	report = degraded.Check(context.Background())
+	assert.Equal(t, services.HealthDegraded, report.Status)
+	assert.True(t, report.Healthy())
+	assert.True(t, report.Dependencies[1].Optional)
+	assert.Equal(t, "collector unreachable", report.Dependencies[1].Error)
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	var failing error
+	health := services.NewHealthService(time.Second).
+		WithCheck("storage", func(ctx context.Context) error { return failing }).
+		WithOptionalCheck("tracing", func(ctx context.Context) error { return errors.New("collector unreachable") })
+	handler := handlers.NewHealthHandler(health)
+
+	serve := func(h http.HandlerFunc) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, serve(handler.Live).Code)
+	assert.Equal(t, http.StatusOK, serve(handler.Ready).Code)
+
+	failing = errors.New("consul unreachable")
+	assert.Equal(t, http.StatusOK, serve(handler.Live).Code)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(handler.Ready).Code)
+
+	// Anonymous callers see which dependency is down but not why.
+	rec := serve(handler.Health)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "unreachable")
+	var report services.HealthReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, services.HealthDown, report.Status)
+	require.Len(t, report.Dependencies, 2)
+	assert.Equal(t, services.HealthDown, report.Dependencies[0].Status)
+	assert.Empty(t, report.Dependencies[0].Error)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	handler.Health(rec, req.WithContext(model.ContextWithPrincipal(req.Context(), &model.Principal{Subject: "ops"})))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, "consul unreachable", report.Dependencies[0].Error)
+}
+
+type countingHealthRepository struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (r *countingHealthRepository) CheckLeader(ctx context.Context) error {
+	return nil
+}
+
+func (r *countingHealthRepository) CheckReadWrite(ctx context.Context) error {
+	r.calls.Add(1)
+	<-r.release
+	return ctx.Err()
+}
+
+func TestHealthProbeIsShared(t *testing.T) {
+	storage := &countingHealthRepository{release: make(chan struct{})}
+	repo := repositories.ShareHealthRepository(storage, 50*time.Millisecond)
+
+	// A caller giving up does not fail the probe for the others.
+	cancelled, cancel := context.WithCancel(context.Background())
+	results := make(chan error, 5)
+	go func() { results <- repo.CheckReadWrite(cancelled) }()
+	require.Eventually(t, func() bool { return storage.calls.Load() == 1 }, time.Second, time.Millisecond)
+	for i := 0; i < 4; i++ {
+		go func() { results <- repo.CheckReadWrite(context.Background()) }()
+	}
+	cancel()
+	assert.ErrorIs(t, <-results, context.Canceled)
+	close(storage.release)
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, <-results)
+	}
+	assert.Equal(t, int32(1), storage.calls.Load())
+
+	// The result is reused until it is ttl old.
+	assert.NoError(t, repo.CheckReadWrite(context.Background()))
+	assert.Equal(t, int32(1), storage.calls.Load())
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, repo.CheckReadWrite(context.Background()))
+	assert.Equal(t, int32(2), storage.calls.Load())
+}
+
+func TestKeyHealthChecks(t *testing.T) {
+	var missing *services.SecretService
+	assert.ErrorIs(t, missing.Check(context.Background()), services.ErrNoKeyring)
+
+	secrets, err := services.NewSecretService(services.Keyring{
+		Active: "k1",
+		Keys:   map[string]string{"k1": newMasterKey(t)},
+	})
+	require.NoError(t, err)
+	assert.NoError(t, secrets.Check(context.Background()))
+
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeSelfSignedCert(t, dir, "health")
+	reloader, err := configuration.NewCertificateReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+	assert.NoError(t, reloader.Check(context.Background()))
+
+	// A broken file on disk keeps the old certificate but fails the check.
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	assert.Error(t, reloader.Reload())
+	assert.Error(t, reloader.Check(context.Background()))
+	_, err = reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+}
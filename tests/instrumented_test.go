@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"projekat/metrics"
+	"projekat/model"
+	"projekat/repositories"
+	"testing"
+)
+
+func TestInstrumentedRepositoryRecordsOperations(t *testing.T) {
+	metrics := metrics.NewStorage(prometheus.NewRegistry())
+	repo := repositories.InstrumentConfigRepository(repositories.NewConfigInMemRepository(), "inmem", metrics)
+	ctx := context.Background()
+
+	require.NoError(t, repo.AddConfig(model.NewConfig("db_config", 1, map[string]string{"host": "db"}), ctx))
+	_, err := repo.GetConfig("db_config", 1, ctx)
+	require.NoError(t, err)
+	_, err = repo.GetConfig("missing", 1, ctx)
+	require.Error(t, err)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.Duration))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.Errors.WithLabelValues("inmem", "config", "get", "not_found")))
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.PayloadSize))
+}
+
+func TestInstrumentWithoutMetricsReturnsRepository(t *testing.T) {
+	repo := repositories.NewConfigInMemRepository()
+	assert.Equal(t, repo, repositories.InstrumentConfigRepository(repo, "inmem", nil))
+
+	var rateLimits model.RateLimitRepository
+	assert.Nil(t, repositories.InstrumentRateLimitRepository(rateLimits, "consul", metrics.NewStorage(prometheus.NewRegistry())))
+}
+
+func TestInstrumentedRepositorySamplesPayloadSizes(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := metrics.NewStorage(registry)
+	repo := repositories.InstrumentConfigRepository(repositories.NewConfigInMemRepository(), "inmem", metrics)
+	ctx := context.Background()
+	require.NoError(t, repo.AddConfig(model.NewConfig("db_config", 1, nil), ctx))
+
+	for i := 0; i < 32; i++ {
+		_, err := repo.GetConfig("db_config", 1, ctx)
+		require.NoError(t, err)
+	}
+	// Only the first get and the seventeenth are measured.
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	samples := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() != "storage_payload_size_bytes" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "operation" {
+					samples[label.GetValue()] = metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]uint64{"add": 1, "get": 2}, samples)
+}
+
+func TestInstrumentedRepositoryClassifiesErrorsBySentinel(t *testing.T) {
+	metrics := metrics.NewStorage(prometheus.NewRegistry())
+	repo := repositories.InstrumentConfigRepository(failingConfigRepository{}, "consul", metrics)
+
+	_, err := repo.GetConfig("db_config", 1, context.Background())
+	require.Error(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.Errors.WithLabelValues("consul", "config", "get", "other")))
+}
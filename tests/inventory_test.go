@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"strings"
+	"testing"
+)
+
+func TestInventoryCollector(t *testing.T) {
+	configs := repositories.NewConfigInMemRepository()
+	groups := repositories.NewConfigGroupInMemRepository()
+	namespaces := services.NewNamespaceService(repositories.NewNamespaceInMemRepository())
+	ctx := context.Background()
+	require.NoError(t, namespaces.AddNamespace(&model.Namespace{Name: "team-a"}, ctx))
+
+	teamA := model.ContextWithNamespace(ctx, "team-a")
+	configService := services.NewConfigService(configs)
+	require.NoError(t, configService.AddConfig("db", 1, nil, teamA))
+	require.NoError(t, configService.AddConfig("db", 2, nil, teamA))
+	require.NoError(t, configService.AddConfig("cache", 1, nil, teamA))
+	require.NoError(t, configService.AddConfig("db", 1, nil, ctx))
+
+	groupService := services.NewConfigGroupService(groups)
+	require.NoError(t, groupService.AddConfigGroup("app", 1, []model.ConfigForGroup{
+		{Name: "db", Labels: map[string]string{"env": "prod", "region": "eu"}},
+		{Name: "cache", Labels: map[string]string{"env": "dev", "region": "eu"}},
+	}, teamA))
+
+	inventory := services.NewInventoryCollector(configs, groups, namespaces)
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(inventory))
+
+	// Nothing is reported until the first refresh.
+	count, err := testutil.GatherAndCount(registry)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	require.NoError(t, inventory.Refresh(ctx))
+	expected := `
+# HELP config_inventory_configs Number of distinct config names per namespace.
+# TYPE config_inventory_configs gauge
+config_inventory_configs{namespace="default"} 1
+config_inventory_configs{namespace="team-a"} 2
+# HELP config_inventory_versions Number of stored config versions per namespace.
+# TYPE config_inventory_versions gauge
+config_inventory_versions{namespace="default"} 1
+config_inventory_versions{namespace="team-a"} 3
+# HELP config_inventory_groups Number of stored config group versions per namespace.
+# TYPE config_inventory_groups gauge
+config_inventory_groups{namespace="default"} 0
+config_inventory_groups{namespace="team-a"} 1
+# HELP config_inventory_group_members Number of configs held by config groups per namespace.
+# TYPE config_inventory_group_members gauge
+config_inventory_group_members{namespace="default"} 0
+config_inventory_group_members{namespace="team-a"} 2
+# HELP config_inventory_label_values Number of distinct values of each group member label per namespace.
+# TYPE config_inventory_label_values gauge
+config_inventory_label_values{label="env",namespace="team-a"} 2
+config_inventory_label_values{label="region",namespace="team-a"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"config_inventory_configs", "config_inventory_versions", "config_inventory_groups",
+		"config_inventory_group_members", "config_inventory_label_values"))
+
+	// Scrapes serve the cached counts until the next refresh.
+	require.NoError(t, configService.AddConfig("queue", 1, nil, teamA))
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "config_inventory_configs"))
+	require.NoError(t, inventory.Refresh(ctx))
+	count, err = testutil.GatherAndCount(registry, "config_inventory_last_refresh_timestamp_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP config_inventory_configs Number of distinct config names per namespace.
+# TYPE config_inventory_configs gauge
+config_inventory_configs{namespace="default"} 1
+config_inventory_configs{namespace="team-a"} 3
+`), "config_inventory_configs"))
+}
@@ -0,0 +1,279 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"projekat/model"
+	"projekat/repositories"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memoryKV is a minimal Consul KV with check-and-set, transactions, reads
+// in transactions and blocking queries. While down is set it answers every request with 503.
+type memoryKV struct {
+	mu    sync.Mutex
+	index uint64
+	pairs map[string]*api.KVPair
+	down  atomic.Bool
+	// failTxn fails the n-th transaction from when it is set.
+	failTxn atomic.Int32
+	// address is where the fake agent listens.
+	address string
+}
+
+func newMemoryKV(t *testing.T) (*memoryKV, *api.Client) {
+	kv := &memoryKV{pairs: map[string]*api.KVPair{}}
+	server := httptest.NewServer(kv)
+	t.Cleanup(server.Close)
+	kv.address = server.Listener.Addr().String()
+	client, err := repositories.NewConsulClient(repositories.ConsulOptions{Address: kv.address}, noop.NewTracerProvider().Tracer("test"))
+	require.NoError(t, err)
+	return kv, client
+}
+
+func (m *memoryKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.down.Load() {
+		http.Error(w, "No cluster leader", http.StatusServiceUnavailable)
+		return
+	}
+	if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index > 0 {
+		for m.currentIndex() <= index && r.Context().Err() == nil {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(m.index, 10))
+
+	if r.URL.Path == "/v1/txn" {
+		if m.failTxn.Add(-1) == 0 {
+			http.Error(w, "rpc error", http.StatusInternalServerError)
+			return
+		}
+		var ops []struct{ KV *api.KVTxnOp }
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i, op := range ops {
+			if current := m.pairs[op.KV.Key]; op.KV.Verb != api.KVGetOrEmpty && op.KV.Index != modifyIndex(current) {
+				w.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(w).Encode(api.TxnResponse{Errors: api.TxnErrors{{OpIndex: i, What: "index mismatch"}}})
+				return
+			}
+		}
+		var response api.TxnResponse
+		for _, op := range ops {
+			switch op.KV.Verb {
+			case api.KVGetOrEmpty:
+				pair := m.pairs[op.KV.Key]
+				if pair == nil {
+					pair = &api.KVPair{Key: op.KV.Key}
+				}
+				response.Results = append(response.Results, &api.TxnResult{KV: pair})
+			case api.KVDeleteCAS:
+				m.index++
+				delete(m.pairs, op.KV.Key)
+			default:
+				m.put(op.KV.Key, op.KV.Value, op.KV.Flags)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodPut:
+		value := make([]byte, r.ContentLength)
+		_, _ = r.Body.Read(value)
+		if cas := query.Get("cas"); cas != "" {
+			index, _ := strconv.ParseUint(cas, 10, 64)
+			if index != modifyIndex(m.pairs[key]) {
+				_, _ = w.Write([]byte("false"))
+				return
+			}
+		}
+		m.put(key, value, 0)
+		_, _ = w.Write([]byte("true"))
+	case http.MethodDelete:
+		m.index++
+		delete(m.pairs, key)
+		_, _ = w.Write([]byte("true"))
+	default:
+		var matches []*api.KVPair
+		for k, pair := range m.pairs {
+			if k == key || ((query.Has("recurse") || query.Has("keys")) && strings.HasPrefix(k, key)) {
+				matches = append(matches, pair)
+			}
+		}
+		if len(matches) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if query.Has("keys") {
+			keys := make([]string, 0, len(matches))
+			for _, pair := range matches {
+				keys = append(keys, pair.Key)
+			}
+			_ = json.NewEncoder(w).Encode(keys)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(matches)
+	}
+}
+
+func (m *memoryKV) put(key string, value []byte, flags uint64) {
+	m.index++
+	m.pairs[key] = &api.KVPair{Key: key, Value: value, Flags: flags, ModifyIndex: m.index}
+}
+
+func (m *memoryKV) currentIndex() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.index
+}
+
+func (m *memoryKV) keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.pairs))
+	for key := range m.pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func modifyIndex(pair *api.KVPair) uint64 {
+	if pair == nil {
+		return 0
+	}
+	return pair.ModifyIndex
+}
+
+func TestKeyspacePrefixesKeys(t *testing.T) {
+	kv, client := newMemoryKV(t)
+	staging := repositories.New(client, repositories.NewKeyspace("/staging/alati/"), slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	production := repositories.New(client, repositories.NewKeyspace("production"), slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	ctx := context.Background()
+
+	require.NoError(t, staging.AddConfig(model.NewConfig("db", 1, map[string]string{"host": "staging"}), ctx))
+	require.NoError(t, production.AddConfig(model.NewConfig("db", 1, map[string]string{"host": "production"}), ctx))
+	assert.Equal(t, []string{"production/configs/db/v1.0", "staging/alati/configs/db/v1.0"}, kv.keys())
+
+	config, err := staging.GetConfig("db", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "staging", config.Parameters["host"])
+	configs, err := production.ListConfigs(ctx)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	assert.Equal(t, "production", configs[0].Parameters["host"])
+}
+
+func TestEnsureLayout(t *testing.T) {
+	kv, client := newMemoryKV(t)
+	keys := repositories.NewKeyspace("staging")
+	ctx := context.Background()
+
+	require.NoError(t, repositories.EnsureLayout(ctx, client, keys))
+	assert.Equal(t, []string{"staging/layout"}, kv.keys())
+	require.NoError(t, repositories.EnsureLayout(ctx, client, keys))
+
+	kv.put("staging/layout", []byte(`{"version":2}`), 0)
+	assert.ErrorIs(t, repositories.EnsureLayout(ctx, client, keys), repositories.ErrLayoutVersion)
+}
+
+func TestMigrateMovesDataBetweenPrefixes(t *testing.T) {
+	kv, client := newMemoryKV(t)
+	ctx := context.Background()
+	// Data written before key prefixes existed, next to another application.
+	root := repositories.New(client, repositories.Keyspace{}, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	for i := 1; i <= 70; i++ {
+		require.NoError(t, root.AddConfig(model.NewConfig("db", float32(i), map[string]string{"host": "db"}), ctx))
+	}
+	kv.put("other-app/settings", []byte("keep"), 0)
+
+	to := repositories.NewKeyspace("production")
+	result, err := repositories.Migrate(ctx, client, repositories.Keyspace{}, to)
+	require.NoError(t, err)
+	assert.Equal(t, 70, result.Keys)
+	assert.Equal(t, repositories.LayoutVersion, result.FromVersion)
+
+	keys := kv.keys()
+	assert.Len(t, keys, 72)
+	assert.Contains(t, keys, "other-app/settings")
+	assert.Contains(t, keys, "production/layout")
+	assert.Contains(t, keys, "production/configs/db/v70.0")
+	require.NoError(t, repositories.EnsureLayout(ctx, client, to))
+
+	moved := repositories.New(client, to, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	config, err := moved.GetConfig("db", 70, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "db", config.Parameters["host"])
+
+	// A target that already holds data is left alone.
+	_, err = repositories.Migrate(ctx, client, repositories.NewKeyspace("staging"), to)
+	assert.ErrorContains(t, err, "already holds data")
+	_, err = repositories.Migrate(ctx, client, to, to)
+	assert.Error(t, err)
+}
+
+func TestMigrateResumesAfterPartialCopy(t *testing.T) {
+	kv, client := newMemoryKV(t)
+	ctx := context.Background()
+	root := repositories.New(client, repositories.Keyspace{}, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	for i := 1; i <= 70; i++ {
+		require.NoError(t, root.AddConfig(model.NewConfig("db", float32(i), nil), ctx))
+	}
+	to := repositories.NewKeyspace("production")
+
+	// The second batch of 64 copies fails after the first was applied.
+	kv.failTxn.Store(2)
+	_, err := repositories.Migrate(ctx, client, repositories.Keyspace{}, to)
+	require.ErrorContains(t, err, "copying keys")
+	keys := kv.keys()
+	assert.Len(t, keys, 70+64+1)
+	assert.Contains(t, keys, "production/migration")
+	assert.NotContains(t, keys, "production/layout")
+
+	_, err = repositories.Migrate(ctx, client, repositories.NewKeyspace("staging"), to)
+	assert.ErrorContains(t, err, "is being migrated from")
+
+	result, err := repositories.Migrate(ctx, client, repositories.Keyspace{}, to)
+	require.NoError(t, err)
+	assert.True(t, result.Resumed)
+	assert.Equal(t, 70, result.Keys)
+	keys = kv.keys()
+	assert.Len(t, keys, 71)
+	assert.Contains(t, keys, "production/layout")
+	assert.NotContains(t, keys, "production/migration")
+	require.NoError(t, repositories.EnsureLayout(ctx, client, to))
+}
+
+func TestMigrateRejectsTargetOfAnotherLayout(t *testing.T) {
+	kv, client := newMemoryKV(t)
+	ctx := context.Background()
+	root := repositories.New(client, repositories.Keyspace{}, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+	require.NoError(t, root.AddConfig(model.NewConfig("db", 1, nil), ctx))
+	kv.put("production/layout", []byte(`{"version":2}`), 0)
+
+	_, err := repositories.Migrate(ctx, client, repositories.Keyspace{}, repositories.NewKeyspace("production"))
+	assert.ErrorIs(t, err, repositories.ErrLayoutVersion)
+	assert.Contains(t, kv.keys(), "configs/db/v1.0")
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"projekat/configuration"
+	"projekat/middleware"
+	"projekat/model"
+	"testing"
+)
+
+func TestLoggerAddsRequestContext(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := configuration.NewLogger("info", &out)
+	require.NoError(t, err)
+
+	ctx := model.ContextWithRequestID(context.Background(), "req-1")
+	ctx = model.ContextWithRoute(ctx, "/config/{name}/{version}/")
+	ctx = model.ContextWithPrincipal(ctx, &model.Principal{Subject: "team-a"})
+	logger.InfoContext(ctx, "hello", "name", "db_config")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "INFO", line["level"])
+	assert.Equal(t, "hello", line["msg"])
+	assert.Equal(t, "db_config", line["name"])
+	assert.Equal(t, "req-1", line["request_id"])
+	assert.Equal(t, "/config/{name}/{version}/", line["route"])
+	assert.Equal(t, "team-a", line["principal"])
+}
+
+func TestLoggerLevel(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := configuration.NewLogger("warn", &out)
+	require.NoError(t, err)
+
+	logger.Info("hidden")
+	logger.Debug("hidden")
+	assert.Empty(t, out.String())
+	logger.Warn("shown")
+	assert.Contains(t, out.String(), "shown")
+
+	_, err = configuration.NewLogger("loud", &out)
+	assert.Error(t, err)
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var requestID, route string
+	router := mux.NewRouter()
+	router.Use(middleware.AdaptRequestIDHandler)
+	router.HandleFunc("/config/{name}/", func(w http.ResponseWriter, r *http.Request) {
+		requestID = model.RequestIDFromContext(r.Context())
+		route = model.RouteFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/config/db/", nil)
+	req.Header.Set(middleware.RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "abc-123", requestID)
+	assert.Equal(t, "abc-123", rec.Header().Get(middleware.RequestIDHeader))
+	assert.Equal(t, "/config/{name}/", route)
+
+	req = httptest.NewRequest(http.MethodGet, "/config/db/", nil)
+	req.Header.Set(middleware.RequestIDHeader, "bad id\n")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.NotEqual(t, "bad id\n", requestID)
+	assert.Len(t, requestID, 32)
+	assert.Equal(t, requestID, rec.Header().Get(middleware.RequestIDHeader))
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"projekat/middleware"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"strings"
+	"testing"
+)
+
+func TestMetricsLabelledByRouteAndStatus(t *testing.T) {
+	metricsService := services.NewMetricsService()
+	metrics := middleware.NewMetrics(metricsService)
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return middleware.AdaptPrometheusHandler(next, metrics)
+	})
+	router.HandleFunc("/config/{name}/{version}/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, float64(1), testutil.ToFloat64(metricsService.HttpRequestsInFlight.WithLabelValues(r.Method, "/config/{name}/{version}/")))
+		if mux.Vars(r)["name"] == "missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"db"}`))
+	})
+
+	for _, path := range []string{"/config/db/1/", "/config/db/2/", "/config/missing/1/"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}")))
+	}
+
+	route := "/config/{name}/{version}/"
+	assert.Equal(t, float64(2), testutil.ToFloat64(metricsService.HttpRequests.WithLabelValues(http.MethodPost, route, "none", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsService.HttpRequests.WithLabelValues(http.MethodPost, route, "none", "404")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricsService.HttpRequestsInFlight.WithLabelValues(http.MethodPost, route)))
+	assert.Equal(t, 2, testutil.CollectAndCount(metricsService.HttpRequestDuration))
+	assert.Equal(t, 2, testutil.CollectAndCount(metricsService.HttpResponseSize))
+
+	// Deprecated aliases keep counting.
+	assert.Equal(t, float64(3), testutil.ToFloat64(metricsService.HttpTotalRequests.WithLabelValues()))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsService.HttpUnsuccessfulRequests.WithLabelValues()))
+}
+
+func TestMetricsLabelledByNamespace(t *testing.T) {
+	metricsService := services.NewMetricsService()
+	metrics := middleware.NewMetrics(metricsService)
+	namespaces := repositories.NewNamespaceInMemRepository()
+	namespaces.Namespaces["billing"] = model.Namespace{Name: "billing"}
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return middleware.AdaptPrometheusHandler(next, metrics)
+	})
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Use(func(next http.Handler) http.Handler {
+		return middleware.AdaptNamespaceHandler(next, middleware.NewNamespaces(services.NewNamespaceService(namespaces)))
+	})
+	router.NotFoundHandler = middleware.AdaptPrometheusHandler(http.NotFoundHandler(), metrics)
+	router.HandleFunc("/ns/{namespace}/config/{name}/{version}/", func(w http.ResponseWriter, r *http.Request) {})
+
+	serve := func(path string, authorized bool) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorized {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve("/ns/billing/config/db/1/", true)
+	serve("/ns/billing/config/db/1/", false)
+	serve("/missing", true)
+
+	route := "/ns/{namespace}/config/{name}/{version}/"
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsService.HttpRequests.WithLabelValues(http.MethodGet, route, "billing", "200")))
+	// Responses written by other middleware and unmatched routes are counted.
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsService.HttpRequests.WithLabelValues(http.MethodGet, route, "none", "401")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsService.HttpRequests.WithLabelValues(http.MethodGet, "unmatched", "none", "404")))
+	// The deprecated metrics keep their original labels.
+	assert.Equal(t, float64(2), testutil.ToFloat64(metricsService.RequestsPerTimeUnit.WithLabelValues(http.MethodGet, route, "seconds")))
+}
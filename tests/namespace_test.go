@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"testing"
+)
+
+func TestNamespaceLifecycle(t *testing.T) {
+	service := services.NewNamespaceService(repositories.NewNamespaceInMemRepository())
+	ctx := context.Background()
+
+	assert.ErrorIs(t, service.AddNamespace(&model.Namespace{Name: "Team_A"}, ctx), services.ErrInvalidNamespace)
+	require.NoError(t, service.AddNamespace(&model.Namespace{Name: "team-a", Quota: model.Quota{MaxConfigs: 5}}, ctx))
+	assert.ErrorIs(t, service.AddNamespace(&model.Namespace{Name: "team-a"}, ctx), services.ErrNamespaceExists)
+
+	namespace, err := service.GetNamespace("team-a", ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5, namespace.Quota.MaxConfigs)
+
+	_, err = service.GetNamespace(model.DefaultNamespace, ctx)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, service.DeleteNamespace(model.DefaultNamespace, ctx), services.ErrNamespaceReserved)
+
+	require.NoError(t, service.DeleteNamespace("team-a", ctx))
+	_, err = service.GetNamespace("team-a", ctx)
+	assert.ErrorIs(t, err, services.ErrNamespaceNotFound)
+}
+
+// brokenNamespaceRepository fails every lookup with a storage error.
+type brokenNamespaceRepository struct {
+	model.NamespaceRepository
+}
+
+func (r brokenNamespaceRepository) GetNamespace(name string, ctx context.Context) (*model.Namespace, error) {
+	return nil, errors.New("rpc error: no cluster leader")
+}
+
+func TestNamespaceStorageErrorsAreNotMissing(t *testing.T) {
+	service := services.NewNamespaceService(brokenNamespaceRepository{repositories.NewNamespaceInMemRepository()})
+	ctx := context.Background()
+
+	for _, name := range []string{"team-a", model.DefaultNamespace} {
+		_, err := service.GetNamespace(name, ctx)
+		assert.ErrorContains(t, err, "no cluster leader")
+		assert.NotErrorIs(t, err, services.ErrNamespaceNotFound)
+	}
+	err := service.DeleteNamespace("team-a", ctx)
+	assert.ErrorContains(t, err, "no cluster leader")
+	assert.NotErrorIs(t, err, services.ErrNamespaceNotFound)
+	assert.ErrorContains(t, service.AddNamespace(&model.Namespace{Name: "team-a"}, ctx), "no cluster leader")
+}
+
+func TestConfigsAreIsolatedByNamespace(t *testing.T) {
+	service := services.NewConfigService(repositories.NewConfigInMemRepository())
+	teamA := model.ContextWithNamespace(context.Background(), "team-a")
+	teamB := model.ContextWithNamespace(context.Background(), "team-b")
+
+	require.NoError(t, service.AddConfig("db_config", 1, map[string]string{"host": "a"}, teamA))
+	require.NoError(t, service.AddConfig("db_config", 1, map[string]string{"host": "b"}, teamB))
+
+	config, err := service.GetConfig("db_config", 1, teamA)
+	require.NoError(t, err)
+	assert.Equal(t, "a", config.Parameters["host"])
+
+	_, err = service.GetConfig("db_config", 1, context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"projekat/handlers"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"strings"
+	"testing"
+)
+
+func newQuotaFixture(t *testing.T, quota model.Quota, policy *services.QuotaPolicy) (services.ConfigService, *services.MetricsService, context.Context) {
+	configs := repositories.NewConfigInMemRepository()
+	groups := repositories.NewConfigGroupInMemRepository()
+	namespaces := services.NewNamespaceService(repositories.NewNamespaceInMemRepository())
+	ctx := context.Background()
+	require.NoError(t, namespaces.AddNamespace(&model.Namespace{Name: "team-a", Quota: quota}, ctx))
+
+	metrics := services.NewMetricsService()
+	quotas := services.NewQuotaService(configs, groups, namespaces, policy, metrics)
+	return services.NewConfigService(configs).WithQuota(quotas), metrics, model.ContextWithNamespace(ctx, "team-a")
+}
+
+func TestQuotaLimitsConfigsAndVersions(t *testing.T) {
+	service, metrics, ctx := newQuotaFixture(t, model.Quota{MaxConfigs: 1, MaxVersionsPerConfig: 2}, nil)
+
+	require.NoError(t, service.AddConfig("a", 1, nil, ctx))
+	require.NoError(t, service.AddConfig("a", 2, nil, ctx))
+	// Overwriting an existing version does not count as a new one.
+	require.NoError(t, service.AddConfig("a", 2, map[string]string{"k": "v"}, ctx))
+
+	var quotaErr *services.QuotaError
+	require.ErrorAs(t, service.AddConfig("a", 3, nil, ctx), &quotaErr)
+	assert.Equal(t, "versionsPerConfig", quotaErr.Limit)
+	assert.False(t, quotaErr.TooLarge)
+
+	require.ErrorAs(t, service.AddConfig("b", 1, nil, ctx), &quotaErr)
+	assert.Equal(t, "configs", quotaErr.Limit)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.QuotaUsage.WithLabelValues("team-a", "versions")))
+}
+
+func TestQuotaRejectsOversizedPayloads(t *testing.T) {
+	service, _, ctx := newQuotaFixture(t, model.Quota{MaxParametersPerEntry: 2, MaxTotalBytes: 200}, nil)
+
+	var quotaErr *services.QuotaError
+	require.ErrorAs(t, service.AddConfig("a", 1, map[string]string{"1": "", "2": "", "3": ""}, ctx), &quotaErr)
+	assert.Equal(t, "parametersPerEntry", quotaErr.Limit)
+	assert.True(t, quotaErr.TooLarge)
+
+	require.NoError(t, service.AddConfig("a", 1, map[string]string{"1": "x"}, ctx))
+	big := map[string]string{"1": string(make([]byte, 200))}
+	require.ErrorAs(t, service.AddConfig("b", 1, big, ctx), &quotaErr)
+	assert.Equal(t, "totalBytes", quotaErr.Limit)
+	assert.True(t, quotaErr.TooLarge)
+}
+
+func TestQuotaErrorResponse(t *testing.T) {
+	service, _, ctx := newQuotaFixture(t, model.Quota{MaxParametersPerEntry: 1}, nil)
+	handler := handlers.NewConfigHandler(slog.Default(), service, noop.NewTracerProvider().Tracer("test"))
+
+	req := httptest.NewRequest(http.MethodPost, "/config/", strings.NewReader(`{"name":"a","version":1,"parameters":{"1":"","2":""}}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.CreatePostHandler(rec, req.WithContext(model.ContextWithRequestID(ctx, "req-1")))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	var body model.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "req-1", body.RequestID)
+	require.NotNil(t, body.Quota)
+	assert.Equal(t, model.QuotaExceeded{Limit: "parametersPerEntry", Max: 1, Requested: 2}, *body.Quota)
+}
+
+func TestQuotaPerPrincipal(t *testing.T) {
+	policy := &services.QuotaPolicy{Principals: map[string]model.Quota{"ci": {MaxConfigs: 1}}}
+	service, _, ctx := newQuotaFixture(t, model.Quota{MaxConfigs: 10}, policy)
+	ci := model.ContextWithPrincipal(ctx, &model.Principal{Subject: "ci"})
+
+	// Configs created by others do not count against ci.
+	require.NoError(t, service.AddConfig("x", 1, nil, model.ContextWithPrincipal(ctx, &model.Principal{Subject: "ops"})))
+	require.NoError(t, service.AddConfig("a", 1, nil, ci))
+	var quotaErr *services.QuotaError
+	require.ErrorAs(t, service.AddConfig("b", 1, nil, ci), &quotaErr)
+	require.NoError(t, service.AddConfig("b", 1, nil, ctx))
+
+	config, err := service.GetConfig("a", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", config.Owner)
+	// Deleting frees the quota again.
+	require.NoError(t, service.DeleteConfig("a", 1, ci))
+	require.NoError(t, service.AddConfig("c", 1, nil, ci))
+}
+
+// countingConfigRepository counts full scans of the wrapped repository.
+type countingConfigRepository struct {
+	model.ConfigRepository
+	lists int
+}
+
+func (r *countingConfigRepository) ListConfigs(ctx context.Context) ([]model.Config, error) {
+	r.lists++
+	return r.ConfigRepository.ListConfigs(ctx)
+}
+
+func TestQuotaUsageIsCounted(t *testing.T) {
+	configs := &countingConfigRepository{ConfigRepository: repositories.NewConfigInMemRepository()}
+	namespaces := services.NewNamespaceService(repositories.NewNamespaceInMemRepository())
+	metrics := services.NewMetricsService()
+	quotas := services.NewQuotaService(configs, repositories.NewConfigGroupInMemRepository(), namespaces, &services.QuotaPolicy{Default: model.Quota{MaxConfigs: 3}}, metrics)
+	service := services.NewConfigService(configs).WithQuota(quotas)
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, service.AddConfig(name, 1, nil, ctx))
+	}
+	require.NoError(t, service.DeleteConfig("c", 1, ctx))
+	require.NoError(t, service.AddConfig("d", 1, nil, ctx))
+	assert.Equal(t, 1, configs.lists)
+	assert.Equal(t, float64(3), testutil.ToFloat64(metrics.QuotaUsage.WithLabelValues(model.DefaultNamespace, "configs")))
+
+	// Writes that bypass the service are picked up once the usage expires.
+	require.NoError(t, configs.AddConfig(model.NewConfig("e", 1, nil), ctx))
+	require.NoError(t, configs.DeleteConfig("a", 1, ctx))
+	require.NoError(t, configs.DeleteConfig("b", 1, ctx))
+	var quotaErr *services.QuotaError
+	require.ErrorAs(t, service.AddConfig("f", 1, nil, ctx), &quotaErr)
+	quotas.SetUsageTTL(0)
+	require.NoError(t, service.AddConfig("f", 1, nil, ctx))
+	assert.Equal(t, 2, configs.lists)
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+	"projekat/repositories"
+	"projekat/services"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type failingRateLimitRepository struct{}
+
+func (failingRateLimitRepository) GetCounter(key string, ctx context.Context) (uint64, uint64, error) {
+	return 0, 0, errors.New("consul unreachable")
+}
+
+func (failingRateLimitRepository) SetCounter(key string, count uint64, index uint64, ctx context.Context) (bool, error) {
+	return false, errors.New("consul unreachable")
+}
+
+func (failingRateLimitRepository) DeleteCounter(key string, ctx context.Context) error {
+	return errors.New("consul unreachable")
+}
+
+// contendedRateLimitRepository loses every check-and-set to another replica.
+type contendedRateLimitRepository struct {
+	*repositories.RateLimitInMemRepository
+	attempts atomic.Int32
+}
+
+func (r *contendedRateLimitRepository) SetCounter(key string, count uint64, index uint64, ctx context.Context) (bool, error) {
+	r.attempts.Add(1)
+	return false, nil
+}
+
+func TestRateLimitSharedAcrossReplicas(t *testing.T) {
+	repo := repositories.NewRateLimitInMemRepository()
+	tracer := noop.NewTracerProvider().Tracer("test")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	replicas := make([]*services.RateLimitService, 3)
+	for i := range replicas {
+		replicas[i] = services.NewRateLimitService(repo, 10, time.Minute, tracer)
+		replicas[i].SetClock(func() time.Time { return start })
+	}
+
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 90; i++ {
+		wg.Add(1)
+		go func(limiter *services.RateLimitService) {
+			defer wg.Done()
+			if limiter.Allow("global", context.Background()) {
+				atomic.AddInt64(&allowed, 1)
+			}
+		}(replicas[i%len(replicas)])
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(10), allowed)
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	repo := repositories.NewRateLimitInMemRepository()
+	limiter := services.NewRateLimitService(repo, 10, time.Minute, noop.NewTracerProvider().Tracer("test"))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.SetClock(func() time.Time { return now })
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, limiter.Allow("global", context.Background()))
+	}
+	assert.False(t, limiter.Allow("global", context.Background()))
+
+	// Halfway into the next window half of the previous window still counts.
+	now = now.Add(90 * time.Second)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if limiter.Allow("global", context.Background()) {
+			allowed++
+		}
+	}
+	assert.Equal(t, 5, allowed)
+}
+
+func TestRateLimitFallsBackToLocalLimiter(t *testing.T) {
+	limiter := services.NewRateLimitService(failingRateLimitRepository{}, 3, time.Minute, noop.NewTracerProvider().Tracer("test"))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.SetClock(func() time.Time { return now })
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if limiter.Allow("global", context.Background()) {
+			allowed++
+		}
+	}
+	assert.Equal(t, 3, allowed)
+
+	// The local bucket refills with the injected clock too.
+	now = now.Add(20 * time.Second)
+	assert.True(t, limiter.Allow("global", context.Background()))
+	assert.False(t, limiter.Allow("global", context.Background()))
+}
+
+func TestRateLimitDeniesWhenCounterIsContended(t *testing.T) {
+	repo := &contendedRateLimitRepository{RateLimitInMemRepository: repositories.NewRateLimitInMemRepository()}
+	limiter := services.NewRateLimitService(repo, 10, time.Minute, noop.NewTracerProvider().Tracer("test"))
+	limiter.SetClock(func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) })
+
+	// The local limiter would allow it; contention is not an outage.
+	assert.False(t, limiter.Allow("global", context.Background()))
+	assert.Equal(t, int32(10), repo.attempts.Load())
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"testing"
+)
+
+func TestIsSecretParameter(t *testing.T) {
+	assert.True(t, model.IsSecretParameter("password", nil))
+	assert.True(t, model.IsSecretParameter("DB_PASSWORD", nil))
+	assert.True(t, model.IsSecretParameter("githubToken", nil))
+	assert.True(t, model.IsSecretParameter("host", []string{"host"}))
+	assert.False(t, model.IsSecretParameter("username", nil))
+}
+
+func TestSetSecretPatterns(t *testing.T) {
+	defer func() { require.NoError(t, model.SetSecretPatterns(model.DefaultSecretPatterns)) }()
+
+	require.NoError(t, model.SetSecretPatterns([]string{"PIN*"}))
+	assert.True(t, model.IsSecretParameter("pin_code", nil))
+	assert.False(t, model.IsSecretParameter("password", nil))
+
+	assert.Error(t, model.SetSecretPatterns([]string{"[a-"}))
+}
+
+func TestRedactedLeavesOriginalUntouched(t *testing.T) {
+	config := model.NewConfig("db_config", 2, map[string]string{"username": "pera", "password": "pera", "host": "db"})
+	config.Secrets = []string{"host"}
+
+	redacted := config.Redacted()
+
+	assert.Equal(t, map[string]string{"username": "pera", "password": model.MaskedValue, "host": model.MaskedValue}, redacted.Parameters)
+	assert.Equal(t, "pera", config.Parameters["password"])
+	assert.Equal(t, "db", config.Parameters["host"])
+}
+
+func TestGroupReadsAreRedactedUnlessRevealed(t *testing.T) {
+	groups := repositories.NewConfigGroupInMemRepository()
+	service := services.NewConfigGroupService(groups)
+	ctx := context.Background()
+	member := model.ConfigForGroup{Name: "db", Parameters: map[string]string{"api_key": "abc", "port": "5432"}}
+	require.NoError(t, service.AddConfigGroup("group", 1, []model.ConfigForGroup{member}, ctx))
+
+	group, err := service.GetConfigGroup("group", 1, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, model.MaskedValue, group.Configurations[0].Parameters["api_key"])
+	assert.Equal(t, "5432", group.Configurations[0].Parameters["port"])
+
+	group, err = service.GetConfigGroup("group", 1, model.ContextWithReveal(ctx))
+	require.NoError(t, err)
+	assert.Equal(t, "abc", group.Configurations[0].Parameters["api_key"])
+}
+
+func TestAuditStateHashCoversSecretValues(t *testing.T) {
+	key := []byte("state-key")
+	first := model.NewConfig("db_config", 2, map[string]string{"password": "pera"})
+	second := model.NewConfig("db_config", 2, map[string]string{"password": "mika"})
+
+	// Secrets matched by name are hashed through an HMAC of their value.
+	assert.NotEqual(t, services.StateHash(first, key), services.StateHash(second, key))
+	assert.Equal(t, services.StateHash(first, key), services.StateHash(model.NewConfig("db_config", 2, map[string]string{"password": "pera"}), key))
+	assert.NotContains(t, services.StateHash(first, key), "pera")
+	// Without a key they cannot be told apart.
+	assert.Equal(t, services.StateHash(first, nil), services.StateHash(second, nil))
+	assert.NotEqual(t, services.StateHash(first, nil), services.StateHash(model.NewConfig("db_config", 3, map[string]string{"password": "pera"}), nil))
+
+	// Explicit secrets are stored encrypted and hashed as ciphertext.
+	secrets, err := services.NewSecretService(services.Keyring{Active: "k1", Keys: map[string]string{"k1": newMasterKey(t)}})
+	require.NoError(t, err)
+	rotated := model.NewConfig("db", 1, map[string]string{"token": "pera"})
+	rotated.Secrets = []string{"token"}
+	require.NoError(t, secrets.EncryptConfig(rotated))
+	changed := model.NewConfig("db", 1, map[string]string{"token": "mika"})
+	changed.Secrets = []string{"token"}
+	require.NoError(t, secrets.EncryptConfig(changed))
+	assert.NotEqual(t, services.StateHash(rotated, nil), services.StateHash(changed, nil))
+}
@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"net/http"
+	"net/http/httptest"
+	"projekat/middleware"
+	"projekat/model"
+	"projekat/services"
+	"testing"
+	"time"
+)
+
+func TestErrorBodiesCarryRequestID(t *testing.T) {
+	limiter := services.NewRateLimitService(nil, 1, time.Minute, noop.NewTracerProvider().Tracer("test"))
+	router := mux.NewRouter()
+	router.Use(middleware.AdaptRequestIDHandler)
+	router.Handle("/config/", middleware.RateLimit(limiter, func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/config/", nil)
+		req.Header.Set(middleware.RequestIDHeader, "client-42")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if i == 0 {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			continue
+		}
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var body model.ErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, "client-42", body.RequestID)
+		assert.NotEmpty(t, body.Message)
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"testing"
+)
+
+func newMasterKey(t *testing.T) string {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestSecretsEncryptedAtRestAndMasked(t *testing.T) {
+	secrets, err := services.NewSecretService(services.Keyring{
+		Active: "k1",
+		Keys:   map[string]string{"k1": newMasterKey(t)},
+	})
+	require.NoError(t, err)
+	repo := repositories.NewConfigInMemRepository()
+	service := services.NewConfigService(repo).WithSecrets(secrets)
+	ctx := context.Background()
+
+	parameters := map[string]string{"username": "pera", "password": "pera"}
+	require.NoError(t, service.AddConfigWithSecrets("db_config", 2, parameters, []string{"password"}, ctx))
+	assert.Equal(t, "pera", parameters["password"])
+
+	stored, err := repo.GetConfig("db_config", 2, ctx)
+	require.NoError(t, err)
+	assert.True(t, services.IsEncrypted(stored.Parameters["password"]))
+	assert.Equal(t, "pera", stored.Parameters["username"])
+
+	masked, err := service.GetConfig("db_config", 2, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, services.MaskedValue, masked.Parameters["password"])
+
+	revealed, err := service.GetConfig("db_config", 2, model.ContextWithReveal(ctx))
+	require.NoError(t, err)
+	assert.Equal(t, "pera", revealed.Parameters["password"])
+}
+
+func TestSecretsRequireKeyring(t *testing.T) {
+	service := services.NewConfigService(repositories.NewConfigInMemRepository())
+
+	err := service.AddConfigWithSecrets("db_config", 2, map[string]string{"password": "pera"}, []string{"password"}, context.Background())
+	assert.ErrorIs(t, err, services.ErrNoKeyring)
+
+	secrets, err := services.NewSecretService(services.Keyring{Active: "k1", Keys: map[string]string{"k1": newMasterKey(t)}})
+	require.NoError(t, err)
+	err = service.WithSecrets(secrets).AddConfigWithSecrets("db_config", 2, map[string]string{}, []string{"password"}, context.Background())
+	assert.ErrorIs(t, err, services.ErrSecretNotFound)
+}
+
+func TestSecretsMasterKeyRotation(t *testing.T) {
+	oldKey, newKey := newMasterKey(t), newMasterKey(t)
+	before, err := services.NewSecretService(services.Keyring{Active: "k1", Keys: map[string]string{"k1": oldKey}})
+	require.NoError(t, err)
+	encrypted, err := before.Encrypt("password", "pera")
+	require.NoError(t, err)
+
+	after, err := services.NewSecretService(services.Keyring{Active: "k2", Keys: map[string]string{"k1": oldKey, "k2": newKey}})
+	require.NoError(t, err)
+	rewrapped, changed, err := after.Rewrap(encrypted)
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	retired, err := services.NewSecretService(services.Keyring{Active: "k2", Keys: map[string]string{"k2": newKey}})
+	require.NoError(t, err)
+	_, err = retired.Decrypt("password", encrypted)
+	assert.ErrorIs(t, err, services.ErrUnknownKey)
+	plaintext, err := retired.Decrypt("password", rewrapped)
+	require.NoError(t, err)
+	assert.Equal(t, "pera", plaintext)
+
+	// A ciphertext is bound to its parameter name.
+	_, err = retired.Decrypt("username", rewrapped)
+	assert.Error(t, err)
+}
+
+func TestGroupMemberSecretsEncryptedAtRest(t *testing.T) {
+	secrets, err := services.NewSecretService(services.Keyring{
+		Active: "k1",
+		Keys:   map[string]string{"k1": newMasterKey(t)},
+	})
+	require.NoError(t, err)
+	groups := repositories.NewConfigGroupInMemRepository()
+	groupService := services.NewConfigGroupService(groups).WithSecrets(secrets)
+	memberService := services.NewConfigForGroupService(repositories.ConfigForGroupInMemRepository{ConfigGroups: groups}).WithSecrets(secrets)
+	ctx := context.Background()
+
+	member := model.ConfigForGroup{Name: "db", Parameters: map[string]string{"host": "db", "password": "pera"}, Secrets: []string{"password"}}
+	require.NoError(t, groupService.AddConfigGroup("app", 1, []model.ConfigForGroup{member}, ctx))
+	assert.Equal(t, "pera", member.Parameters["password"])
+	parameters := map[string]string{"token": "mika"}
+	require.NoError(t, memberService.AddToConfigGroupWithSecrets("cache", map[string]string{"tier": "cache"}, parameters, []string{"token"}, "app", 1, ctx))
+	assert.Equal(t, "mika", parameters["token"])
+
+	stored, err := groups.GetConfigGroup("app", 1, ctx)
+	require.NoError(t, err)
+	require.Len(t, stored.Configurations, 2)
+	assert.True(t, services.IsEncrypted(stored.Configurations[0].Parameters["password"]))
+	assert.Equal(t, "db", stored.Configurations[0].Parameters["host"])
+	assert.True(t, services.IsEncrypted(stored.Configurations[1].Parameters["token"]))
+
+	masked, err := memberService.GetConfigsByLabels("app", 1, map[string]string{"tier": "cache"}, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, services.MaskedValue, masked[0].Parameters["token"])
+	revealed, err := groupService.GetConfigGroup("app", 1, model.ContextWithReveal(ctx))
+	require.NoError(t, err)
+	assert.Equal(t, "pera", revealed.Configurations[0].Parameters["password"])
+	assert.Equal(t, "mika", revealed.Configurations[1].Parameters["token"])
+
+	// Without a keyring group secrets are refused like config secrets.
+	err = services.NewConfigGroupService(groups).AddConfigGroup("app", 2, []model.ConfigForGroup{member}, ctx)
+	assert.ErrorIs(t, err, services.ErrNoKeyring)
+}
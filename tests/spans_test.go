@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"projekat/handlers"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"testing"
+)
+
+func newRecordingTracer(t *testing.T) (*tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return recorder, tp
+}
+
+func findSpan(spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestConsulRepositorySpans(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	config, err := json.Marshal(model.NewConfig("db", 1, map[string]string{"host": "localhost"}))
+	require.NoError(t, err)
+
+	var traceparent string
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{{
+			"Key":   "configs/db/v1.0",
+			"Value": base64.StdEncoding.EncodeToString(config),
+		}})
+	}))
+	defer consul.Close()
+	recorder, tp := newRecordingTracer(t)
+	client, err := repositories.NewConsulClient(repositories.ConsulOptions{Address: consul.Listener.Addr().String()}, tp.Tracer("test"))
+	require.NoError(t, err)
+	repo := repositories.New(client, repositories.Keyspace{}, slog.Default(), tp.Tracer("test"))
+
+	_, err = repo.GetConfig("db", 1, context.Background())
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	repoSpan := findSpan(spans, "ConfigConsulRepository.GetConfig")
+	require.NotNil(t, repoSpan)
+	attrs := spanAttributes(repoSpan)
+	assert.Equal(t, "db", attrs[model.AttrConfigName].AsString())
+	assert.Equal(t, 1.0, attrs[model.AttrConfigVersion].AsFloat64())
+	assert.Equal(t, "configs/db/v1.0", attrs[model.AttrStorageKey].AsString())
+	assert.Equal(t, int64(len(config)), attrs[model.AttrValueSize].AsInt64())
+	assert.Equal(t, "consul", attrs["db.system"].AsString())
+
+	consulSpan := findSpan(spans, "Consul GET /v1/kv")
+	require.NotNil(t, consulSpan)
+	assert.Equal(t, repoSpan.SpanContext().SpanID(), consulSpan.Parent().SpanID())
+	assert.Equal(t, int64(http.StatusOK), spanAttributes(consulSpan)["http.response.status_code"].AsInt64())
+	assert.Contains(t, traceparent, consulSpan.SpanContext().TraceID().String())
+}
+
+func TestHandlerRecordsErrors(t *testing.T) {
+	recorder, tp := newRecordingTracer(t)
+	handler := handlers.NewConfigHandler(slog.Default(), services.NewConfigService(repositories.NewConfigInMemRepository()), tp.Tracer("test"))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/config/{name}/{version}/", handler.Get)
+	req := httptest.NewRequest(http.MethodGet, "/config/missing/1.0/", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// A 404 is recorded, but the request did not fail on our side.
+	span := findSpan(recorder.Ended(), "ConfigHandler.Get")
+	require.NotNil(t, span)
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.Equal(t, "missing", spanAttributes(span)[model.AttrConfigName].AsString())
+	require.Len(t, span.Events(), 1)
+	assert.Equal(t, "exception", span.Events()[0].Name)
+
+	recorder, tp = newRecordingTracer(t)
+	handler = handlers.NewConfigHandler(slog.Default(), services.NewConfigService(failingConfigRepository{}), tp.Tracer("test"))
+	router = mux.NewRouter()
+	router.HandleFunc("/config/{name}/{version}/", handler.Get)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config/db/1.0/", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	span = findSpan(recorder.Ended(), "ConfigHandler.Get")
+	require.NotNil(t, span)
+	assert.Equal(t, codes.Error, span.Status().Code)
+}
+
+func TestServiceSpans(t *testing.T) {
+	recorder, tp := newRecordingTracer(t)
+	tracer := tp.Tracer("test")
+	namespaces := services.NewNamespaceService(repositories.NewNamespaceInMemRepository()).WithTracer(tracer)
+	configs := repositories.NewConfigInMemRepository()
+	groups := repositories.NewConfigGroupInMemRepository()
+	quota := services.NewQuotaService(configs, groups, namespaces, &services.QuotaPolicy{}, nil)
+	quota.SetTracer(tracer)
+	service := services.NewConfigService(configs).WithQuota(quota).WithTracer(tracer)
+	ctx := context.Background()
+
+	require.NoError(t, service.AddConfig("db", 1, map[string]string{"host": "db"}, ctx))
+	spans := recorder.Ended()
+	add := findSpan(spans, "ConfigService.AddConfig")
+	require.NotNil(t, add)
+	assert.Equal(t, "db", spanAttributes(add)[model.AttrConfigName].AsString())
+	check := findSpan(spans, "QuotaService.CheckConfig")
+	require.NotNil(t, check)
+	assert.Equal(t, add.SpanContext().SpanID(), check.Parent().SpanID())
+	require.NotNil(t, findSpan(spans, "QuotaService.CountUsage"))
+
+	// A missing entry is recorded on the span without failing it.
+	_, err := service.GetConfig("missing", 1, ctx)
+	require.Error(t, err)
+	get := findSpan(recorder.Ended(), "ConfigService.GetConfig")
+	require.NotNil(t, get)
+	assert.Equal(t, codes.Unset, get.Status().Code)
+	require.Len(t, get.Events(), 1)
+
+	_, err = services.NewConfigService(failingConfigRepository{}).WithTracer(tracer).GetConfig("db", 1, ctx)
+	require.Error(t, err)
+	var failed sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "ConfigService.GetConfig" && span.Status().Code == codes.Error {
+			failed = span
+		}
+	}
+	assert.NotNil(t, failed)
+}
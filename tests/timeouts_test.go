@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"projekat/handlers"
+	"projekat/model"
+	"projekat/repositories"
+	"projekat/services"
+	"testing"
+	"time"
+)
+
+// newSlowConsul serves every KV read after delay, or gives up when the
+// caller does, and returns its address.
+func newSlowConsul(t *testing.T, delay time.Duration) string {
+	config, err := json.Marshal(model.NewConfig("db", 1, map[string]string{"host": "localhost"}))
+	require.NoError(t, err)
+
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{{
+			"Key":   "configs/db/v1.0",
+			"Value": base64.StdEncoding.EncodeToString(config),
+		}})
+	}))
+	t.Cleanup(consul.Close)
+	return consul.Listener.Addr().String()
+}
+
+func TestStorageReadTimeout(t *testing.T) {
+	options := repositories.ConsulOptions{
+		Address:  newSlowConsul(t, time.Second),
+		Timeouts: repositories.StorageTimeouts{Read: 50 * time.Millisecond, List: 50 * time.Millisecond},
+	}
+	client, err := repositories.NewConsulClient(options, noop.NewTracerProvider().Tracer("test"))
+	require.NoError(t, err)
+	repo := repositories.New(client, repositories.Keyspace{}, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+
+	start := time.Now()
+	_, err = repo.GetConfig("db", 1, context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	handler := handlers.NewConfigHandler(slog.Default(), services.NewConfigService(repo), noop.NewTracerProvider().Tracer("test"))
+	router := mux.NewRouter()
+	router.HandleFunc("/config/{name}/{version}/", handler.Get)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config/db/1.0/", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+}
+
+func TestStorageCallsWithinBudget(t *testing.T) {
+	options := repositories.ConsulOptions{
+		Address:  newSlowConsul(t, 10*time.Millisecond),
+		Timeouts: repositories.StorageTimeouts{Read: time.Second, List: time.Second, Write: time.Second},
+	}
+	client, err := repositories.NewConsulClient(options, noop.NewTracerProvider().Tracer("test"))
+	require.NoError(t, err)
+	repo := repositories.New(client, repositories.Keyspace{}, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+
+	config, err := repo.GetConfig("db", 1, context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", config.Parameters["host"])
+}
+
+func TestStorageFollowsCallerCancellation(t *testing.T) {
+	options := repositories.ConsulOptions{Address: newSlowConsul(t, time.Second)}
+	client, err := repositories.NewConsulClient(options, noop.NewTracerProvider().Tracer("test"))
+	require.NoError(t, err)
+	repo := repositories.New(client, repositories.Keyspace{}, slog.Default(), noop.NewTracerProvider().Tracer("test"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = repo.GetConfig("db", 1, ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestNotFoundStatusFollowsTheSentinel(t *testing.T) {
+	tracer := noop.NewTracerProvider().Tracer("test")
+	groups := handlers.NewConfigGroupHandler(services.NewConfigGroupService(repositories.NewConfigGroupInMemRepository()), tracer)
+	router := mux.NewRouter()
+	router.HandleFunc("/config/{name}/{version}/", handlers.NewConfigHandler(slog.Default(), services.NewConfigService(repositories.NewConfigInMemRepository()), tracer).Get)
+	router.HandleFunc("/group/{name}/{version}/", groups.GetConfigGroup)
+	router.HandleFunc("/broken/{name}/{version}/", handlers.NewConfigHandler(slog.Default(), services.NewConfigService(failingConfigRepository{}), tracer).Get)
+	serve := func(path string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve("/config/db/1.0/"))
+	assert.Equal(t, http.StatusNotFound, serve("/group/backend/1.5/"))
+	// A storage error that merely mentions "not found" is not a 404.
+	assert.Equal(t, http.StatusInternalServerError, serve("/broken/db/1.0/"))
+}
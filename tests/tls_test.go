@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"os"
+	"path/filepath"
+	"projekat/configuration"
+	"projekat/model"
+	"projekat/services"
+	"testing"
+	"time"
+)
+
+func writeSelfSignedCert(t *testing.T, dir string, commonName string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return certFile, keyFile, cert
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, first := writeSelfSignedCert(t, dir, "first")
+
+	reloader, err := configuration.NewCertificateReloader(certFile, keyFile, certFile)
+	require.NoError(t, err)
+	cfg, err := reloader.TLSConfig("require")
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+
+	served, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, first.Raw, served.Certificate[0])
+
+	_, _, second := writeSelfSignedCert(t, dir, "second")
+	require.NoError(t, reloader.Reload())
+
+	served, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, second.Raw, served.Certificate[0])
+}
+
+func TestClientAuthRequiresCABundle(t *testing.T) {
+	certFile, keyFile, _ := writeSelfSignedCert(t, t.TempDir(), "server")
+	reloader, err := configuration.NewCertificateReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+
+	_, err = reloader.TLSConfig("require")
+	assert.Error(t, err)
+}
+
+func TestAuthenticateClientCertificate(t *testing.T) {
+	_, _, cert := writeSelfSignedCert(t, t.TempDir(), "billing-service")
+	auth, err := services.NewAuthService("", nil)
+	require.NoError(t, err)
+
+	_, err = auth.AuthenticateCertificate(cert)
+	assert.ErrorIs(t, err, services.ErrUnauthenticated)
+
+	auth.EnableClientCertificates()
+	principal, err := auth.AuthenticateCertificate(cert)
+	require.NoError(t, err)
+	assert.Equal(t, &model.Principal{Subject: "billing-service", Method: model.AuthMethodMTLS}, principal)
+}
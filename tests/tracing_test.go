@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"path/filepath"
+	"projekat/configuration"
+	"testing"
+	"time"
+)
+
+func TestTracerProviderWritesSpansToFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	tp, _, err := configuration.NewTracerProvider(configuration.TracingConfiguration{
+		Exporter:    configuration.TracingExporterStdout,
+		File:        file,
+		SampleRatio: 1,
+		ServiceName: "test-service",
+	})
+	require.NoError(t, err)
+
+	_, span := tp.Tracer("test").Start(context.Background(), "GetConfig")
+	span.End()
+	require.NoError(t, tp.Shutdown(context.Background()))
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"GetConfig"`)
+	assert.Contains(t, string(data), "test-service")
+}
+
+func TestTracerProviderSamplingFollowsParent(t *testing.T) {
+	tp, _, err := configuration.NewTracerProvider(configuration.TracingConfiguration{
+		Exporter:    configuration.TracingExporterNone,
+		SampleRatio: 0,
+		ServiceName: "test-service",
+	})
+	require.NoError(t, err)
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+	tracer := tp.Tracer("test")
+
+	// New traces are dropped at ratio 0 but still get IDs for the logs.
+	_, root := tracer.Start(context.Background(), "root")
+	assert.False(t, root.SpanContext().IsSampled())
+	assert.True(t, root.SpanContext().IsValid())
+
+	// A sampled caller keeps the trace sampled.
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	_, child := tracer.Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "child")
+	assert.True(t, child.SpanContext().IsSampled())
+}
+
+func TestTracerProviderToleratesMissingCollector(t *testing.T) {
+	for _, exporter := range []string{configuration.TracingExporterOTLPGRPC, configuration.TracingExporterOTLPHTTP} {
+		tp, status, err := configuration.NewTracerProvider(configuration.TracingConfiguration{
+			Exporter:    exporter,
+			Endpoint:    "127.0.0.1:1",
+			Insecure:    true,
+			SampleRatio: 1,
+			ServiceName: "test-service",
+		})
+		require.NoError(t, err, exporter)
+
+		_, span := tp.Tracer("test").Start(context.Background(), "request")
+		span.End()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_ = tp.Shutdown(ctx)
+		cancel()
+		// gRPC keeps retrying past the shutdown deadline, so only the HTTP
+		// exporter has reported its failure by now.
+		if exporter == configuration.TracingExporterOTLPHTTP {
+			assert.Error(t, status.Check(context.Background()))
+		}
+	}
+}
+
+func TestTracerProviderRejectsInvalidConfiguration(t *testing.T) {
+	_, _, err := configuration.NewTracerProvider(configuration.TracingConfiguration{Exporter: "jaeger", SampleRatio: 1})
+	assert.Error(t, err)
+
+	_, _, err = configuration.NewTracerProvider(configuration.TracingConfiguration{Exporter: configuration.TracingExporterNone, SampleRatio: 1.5})
+	assert.Error(t, err)
+}